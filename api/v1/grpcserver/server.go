@@ -0,0 +1,366 @@
+// Package grpcserver serves the gokv gRPC api defined in api/v1/gokvpb, on top of the
+// same store and transaction logger as the http api.
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"github.com/shubham1172/gokv/api/v1/gokvpb"
+	"github.com/shubham1172/gokv/internal/logger"
+	"github.com/shubham1172/gokv/pkg/store"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"log"
+	"math"
+	"net"
+	"time"
+)
+
+const (
+	// defaultScanLimit is the page size of Scan if no limit is given.
+	defaultScanLimit = 100
+	// maxScanLimit is the max page size of Scan.
+	maxScanLimit = 1000
+	// defaultMaxTxnSize is the max size in bytes of a transaction if it is not configured.
+	defaultMaxTxnSize = 4 << 20
+	// messageOverhead is the size in bytes allowed for the fields of a message besides its keys and values.
+	messageOverhead = 64 << 10
+)
+
+const messageKeyMissing string = "Key missing in the request"
+const messageValueMissing string = "Value missing in the request"
+const messageInvalidTTL string = "Invalid ttl, expected a positive duration"
+const messageInvalidLimit string = "Invalid limit, expected a number between 0 and 1000"
+const messageTxnEmpty string = "Operations missing in the request"
+const messageWatchUnavailable string = "Watching changes is not enabled"
+const messageResumeUnsupported string = "The transaction log does not support resuming"
+
+// eventTypes are the types of the changes streamed by Watch.
+var eventTypes = map[store.ChangeType]gokvpb.EventType{
+	store.ChangePut:    gokvpb.EventType_EVENT_TYPE_PUT,
+	store.ChangeDelete: gokvpb.EventType_EVENT_TYPE_DELETE,
+	store.ChangeExpire: gokvpb.EventType_EVENT_TYPE_EXPIRE,
+	store.ChangeEvict:  gokvpb.EventType_EVENT_TYPE_EVICT,
+}
+
+// server holds the dependencies shared by the rpcs.
+type server struct {
+	gokvpb.UnimplementedKVServer
+
+	store       *store.Store
+	logger      logger.TransactionLogger
+	asyncWrites bool       // Answer writes without waiting for the transaction log
+	maxTxnSize  int64      // Max size in bytes of a transaction
+	hub         *store.Hub // Hub publishing the changes persisted to the transaction log, nil if watching is disabled
+}
+
+// Option configures the gRPC server.
+type Option func(*server)
+
+// WithAsyncWrites answers writes without waiting for them to be persisted, see logger.Apply.
+func WithAsyncWrites() Option {
+	return func(s *server) {
+		s.asyncWrites = true
+	}
+}
+
+// WithMaxTxnSize sets the max size in bytes of a transaction. A size <= 0 stands for the default.
+func WithMaxTxnSize(n int64) Option {
+	return func(s *server) {
+		if n > 0 {
+			s.maxTxnSize = n
+		}
+	}
+}
+
+// WithHub streams the changes published to h by the transaction log on Watch.
+func WithHub(h *store.Hub) Option {
+	return func(s *server) {
+		s.hub = h
+	}
+}
+
+// storeError returns the gRPC status standing for an error returned by the store.
+func storeError(err error) error {
+	switch err {
+	case store.ErrorKeyNotFound:
+		return status.Error(codes.NotFound, err.Error())
+	case store.ErrorKeySizeTooLarge, store.ErrorValueSizeTooLarge, store.ErrorInvalidOp:
+		return status.Error(codes.InvalidArgument, err.Error())
+	case store.ErrorVersionMismatch:
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case store.ErrorStoreFull:
+		return status.Error(codes.ResourceExhausted, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+// expiry returns the time at which a key put with ttl expires, zero if ttl is absent.
+func expiry(ttl *durationpb.Duration, now time.Time) (time.Time, error) {
+	if ttl == nil {
+		return time.Time{}, nil
+	}
+	if err := ttl.CheckValid(); err != nil || ttl.AsDuration() <= 0 {
+		return time.Time{}, status.Error(codes.InvalidArgument, messageInvalidTTL)
+	}
+	return now.Add(ttl.AsDuration()), nil
+}
+
+// timestamp returns t as a protobuf timestamp, nil if t is zero.
+func timestamp(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(t)
+}
+
+// apply applies the operations with logger.Apply and returns the gRPC status standing for its error.
+func (s *server) apply(ops []store.Op) ([]uint64, error) {
+	versions, err := logger.Apply(s.store, ops, s.asyncWrites)
+	if err == logger.ErrorLogFailed {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	} else if err != nil {
+		return nil, storeError(err)
+	}
+	return versions, nil
+}
+
+// Get returns the value of a key.
+func (s *server) Get(ctx context.Context, req *gokvpb.GetRequest) (*gokvpb.GetResponse, error) {
+	if req.Key == "" {
+		return nil, status.Error(codes.InvalidArgument, messageKeyMissing)
+	}
+
+	e, err := s.store.GetEntry(req.Key)
+	if err != nil {
+		return nil, storeError(err)
+	}
+
+	return &gokvpb.GetResponse{Value: e.Value, ContentType: e.ContentType, Version: e.Version, ExpiresAt: timestamp(e.ExpiresAt)}, nil
+}
+
+// Put puts a value against a key.
+func (s *server) Put(ctx context.Context, req *gokvpb.PutRequest) (*gokvpb.PutResponse, error) {
+	if req.Key == "" {
+		return nil, status.Error(codes.InvalidArgument, messageKeyMissing)
+	}
+	if len(req.Value) == 0 {
+		return nil, status.Error(codes.InvalidArgument, messageValueMissing)
+	}
+
+	expiresAt, err := expiry(req.Ttl, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	op := store.Op{Type: store.OpPut, Key: req.Key, Value: req.Value, ContentType: req.ContentType, ExpiresAt: expiresAt}
+	if req.Version != nil {
+		op.Cond = store.IfVersion(*req.Version)
+	}
+
+	versions, err := s.apply([]store.Op{op})
+	if err != nil {
+		return nil, err
+	}
+
+	return &gokvpb.PutResponse{Version: versions[0]}, nil
+}
+
+// Delete deletes a key.
+func (s *server) Delete(ctx context.Context, req *gokvpb.DeleteRequest) (*gokvpb.DeleteResponse, error) {
+	if req.Key == "" {
+		return nil, status.Error(codes.InvalidArgument, messageKeyMissing)
+	}
+
+	op := store.Op{Type: store.OpDelete, Key: req.Key}
+	if req.Version != nil {
+		op.Cond = store.IfVersion(*req.Version)
+	}
+
+	if _, err := s.apply([]store.Op{op}); err != nil {
+		return nil, err
+	}
+
+	return &gokvpb.DeleteResponse{}, nil
+}
+
+// Scan returns a page of the key-value pairs in a range.
+func (s *server) Scan(ctx context.Context, req *gokvpb.ScanRequest) (*gokvpb.ScanResponse, error) {
+	limit := int(req.Limit)
+	if limit == 0 {
+		limit = defaultScanLimit
+	}
+	if limit < 0 || limit > maxScanLimit {
+		return nil, status.Error(codes.InvalidArgument, messageInvalidLimit)
+	}
+
+	start, end := req.Start, req.End
+	if req.Prefix != "" {
+		if start < req.Prefix {
+			start = req.Prefix
+		}
+		if prefixEnd := store.PrefixEnd(req.Prefix); end == "" || end > prefixEnd {
+			end = prefixEnd
+		}
+	}
+
+	// fetch an extra pair to find out if there is a next page
+	kvs, err := s.store.Scan(start, end, limit+1)
+	if err != nil {
+		return nil, storeError(err)
+	}
+
+	res := &gokvpb.ScanResponse{Kvs: make([]*gokvpb.KeyValue, 0, len(kvs))}
+	if len(kvs) > limit {
+		res.Next = kvs[limit].Key
+		kvs = kvs[:limit]
+	}
+	for _, kv := range kvs {
+		res.Kvs = append(res.Kvs, &gokvpb.KeyValue{Key: kv.Key, Value: kv.Value, ContentType: kv.ContentType, Version: kv.Version})
+	}
+
+	return res, nil
+}
+
+// Watch streams the changes of the keys starting with a prefix once they are persisted to the transaction log.
+func (s *server) Watch(req *gokvpb.WatchRequest, stream gokvpb.KV_WatchServer) error {
+	if s.hub == nil {
+		return status.Error(codes.Unimplemented, messageWatchUnavailable)
+	}
+
+	var follower logger.Follower
+	if req.Since != nil {
+		var ok bool
+		follower, ok = s.logger.(logger.Follower)
+		if !ok {
+			return status.Error(codes.Unimplemented, messageResumeUnsupported)
+		}
+	}
+
+	// the watcher is registered before the log is read, so that no change falls in between
+	watcher := s.hub.Watch(req.Prefix)
+	defer watcher.Close()
+
+	err := logger.Follow(stream.Context(), watcher, follower, req.GetSince(), func(n store.Notification) error {
+		return stream.Send(&gokvpb.WatchResponse{
+			Sequence:    n.Sequence,
+			Type:        eventTypes[n.Type],
+			Key:         n.Key,
+			Value:       n.Value,
+			ContentType: n.ContentType,
+			ExpiresAt:   timestamp(n.ExpiresAt),
+		})
+	}, nil)
+
+	if err == store.ErrorWatcherLagged {
+		return status.Error(codes.Aborted, err.Error())
+	} else if errors.Is(err, logger.ErrorCompacted) {
+		return status.Error(codes.OutOfRange, logger.ErrorCompacted.Error())
+	} else if ctxErr := stream.Context().Err(); ctxErr != nil {
+		return status.FromContextError(ctxErr).Err()
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+// Txn applies operations atomically.
+func (s *server) Txn(ctx context.Context, req *gokvpb.TxnRequest) (*gokvpb.TxnResponse, error) {
+	if len(req.Ops) == 0 {
+		return nil, status.Error(codes.InvalidArgument, messageTxnEmpty)
+	}
+
+	now := time.Now()
+	ops := make([]store.Op, len(req.Ops))
+	for i, op := range req.Ops {
+		if op.Key == "" {
+			return nil, status.Errorf(codes.InvalidArgument, "key missing in operation %d", i)
+		}
+
+		switch op.Type {
+		case gokvpb.OpType_OP_TYPE_PUT:
+			if len(op.Value) == 0 {
+				return nil, status.Errorf(codes.InvalidArgument, "value missing in operation %d", i)
+			}
+			ops[i].Type = store.OpPut
+		case gokvpb.OpType_OP_TYPE_DELETE:
+			ops[i].Type = store.OpDelete
+		default:
+			return nil, status.Errorf(codes.InvalidArgument, "invalid op %v in operation %d, expected put or delete", op.Type, i)
+		}
+
+		expiresAt, err := expiry(op.Ttl, now)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "%s in operation %d", messageInvalidTTL, i)
+		}
+
+		if op.Version != nil {
+			ops[i].Cond = store.IfVersion(*op.Version)
+		}
+
+		ops[i].Key, ops[i].Value, ops[i].ContentType, ops[i].ExpiresAt = op.Key, op.Value, op.ContentType, expiresAt
+	}
+
+	versions, err := s.apply(ops)
+	if err != nil {
+		return nil, err
+	}
+
+	return &gokvpb.TxnResponse{Versions: versions}, nil
+}
+
+// newServer returns the server of the gokv gRPC api on top of the given store and logger.
+func newServer(st *store.Store, l logger.TransactionLogger, opts ...Option) *server {
+	s := &server{store: st, logger: l, maxTxnSize: defaultMaxTxnSize}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// serverOptions returns the options of a gRPC server sized for the messages of s: requests may hold
+// a put of the largest key and value, or a transaction of the max size, and responses a full page of Scan.
+func (s *server) serverOptions() []grpc.ServerOption {
+	entry := int64(s.store.MaxKeySize()) + int64(s.store.MaxValueSize()) + messageOverhead
+
+	recv := entry
+	if s.maxTxnSize+messageOverhead > recv {
+		recv = s.maxTxnSize + messageOverhead
+	}
+
+	send := entry * maxScanLimit
+	if send < recv {
+		send = recv
+	}
+
+	return []grpc.ServerOption{grpc.MaxRecvMsgSize(messageSize(recv)), grpc.MaxSendMsgSize(messageSize(send))}
+}
+
+// messageSize returns n as a message size, which gRPC caps to the max int32.
+func messageSize(n int64) int {
+	if n > math.MaxInt32 {
+		return math.MaxInt32
+	}
+	return int(n)
+}
+
+// Register registers the gokv gRPC api on gs, on top of the given store and logger.
+// Writes are answered once they are persisted to the logger, unless configured otherwise.
+// The messages larger than the limits of gs are refused, Start sizes them for the store.
+func Register(gs *grpc.Server, st *store.Store, l logger.TransactionLogger, opts ...Option) {
+	gokvpb.RegisterKVServer(gs, newServer(st, l, opts...))
+}
+
+// Start the gRPC server on the given address.
+func Start(addr string, st *store.Store, l logger.TransactionLogger, opts ...Option) {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Fatalf("failed to listen on %s: %v", addr, err)
+	}
+
+	s := newServer(st, l, opts...)
+	gs := grpc.NewServer(s.serverOptions()...)
+	gokvpb.RegisterKVServer(gs, s)
+	log.Fatal(gs.Serve(lis))
+}
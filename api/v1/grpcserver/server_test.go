@@ -0,0 +1,314 @@
+package grpcserver
+
+import (
+	"bytes"
+	"context"
+	"github.com/shubham1172/gokv/api/v1/gokvpb"
+	"github.com/shubham1172/gokv/config"
+	"github.com/shubham1172/gokv/internal/logger"
+	"github.com/shubham1172/gokv/pkg/store"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"math"
+	"net"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// newTestClient serves the gRPC api on an in-process listener, on top of a store whose
+// changes are persisted to a bolt logger publishing them to a hub. The store takes values
+// of up to 16 bytes, unless opts say otherwise.
+func newTestClient(t *testing.T, opts ...store.Option) (gokvpb.KVClient, func()) {
+	hub := store.NewHub()
+	// the sizes are limited by the store
+	l, err := logger.NewBoltTransactionLogger(config.LoggingConfiguration{BoltFileName: filepath.Join(t.TempDir(), "transactions.db")},
+		logger.WithMaxSizes(store.MaxKeySize, math.MaxInt32), logger.WithHub(hub))
+	if err != nil {
+		t.Fatalf("could not create logger: %v", err)
+	}
+	go l.Run()
+
+	st := store.New(append([]store.Option{store.WithMaxValueSize(16), store.WithCommitFunc(logger.CommitFunc(l))}, opts...)...)
+
+	lis := bufconn.Listen(1 << 20)
+	s := newServer(st, l, WithHub(hub))
+	gs := grpc.NewServer(s.serverOptions()...)
+	gokvpb.RegisterKVServer(gs, s)
+	go gs.Serve(lis)
+
+	conn, err := grpc.Dial("bufconn", grpc.WithInsecure(), grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		return lis.DialContext(ctx)
+	}), grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(math.MaxInt32), grpc.MaxCallSendMsgSize(math.MaxInt32)))
+	if err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+
+	return gokvpb.NewKVClient(conn), func() {
+		conn.Close()
+		gs.Stop()
+		st.Close()
+		l.Stop()
+	}
+}
+
+func version(v uint64) *uint64 {
+	return &v
+}
+
+func TestKeys(t *testing.T) {
+	c, stop := newTestClient(t)
+	defer stop()
+	ctx := context.Background()
+
+	put, err := c.Put(ctx, &gokvpb.PutRequest{Key: "testKey", Value: []byte("testValue"), ContentType: "text/plain", Ttl: durationpb.New(time.Hour)})
+	if err != nil {
+		t.Fatalf("Expected err to be %v, got %v instead", nil, err)
+	}
+
+	got, err := c.Get(ctx, &gokvpb.GetRequest{Key: "testKey"})
+	if err != nil {
+		t.Fatalf("Expected err to be %v, got %v instead", nil, err)
+	}
+	if string(got.Value) != "testValue" || got.ContentType != "text/plain" || got.Version != put.Version {
+		t.Errorf("expected testValue text/plain at version %d, got %s %s at version %d instead", put.Version, got.Value, got.ContentType, got.Version)
+	}
+	if got.ExpiresAt == nil || time.Until(got.ExpiresAt.AsTime()) <= 0 {
+		t.Errorf("expected the key to expire in the future, got %v instead", got.ExpiresAt)
+	}
+
+	testCases := []struct {
+		name string
+		call func() error
+		want codes.Code
+	}{
+		{"get missing key", func() error {
+			_, err := c.Get(ctx, &gokvpb.GetRequest{Key: "missingKey"})
+			return err
+		}, codes.NotFound},
+		{"get without key", func() error {
+			_, err := c.Get(ctx, &gokvpb.GetRequest{})
+			return err
+		}, codes.InvalidArgument},
+		{"put without value", func() error {
+			_, err := c.Put(ctx, &gokvpb.PutRequest{Key: "testKey"})
+			return err
+		}, codes.InvalidArgument},
+		{"put value too large", func() error {
+			_, err := c.Put(ctx, &gokvpb.PutRequest{Key: "testKey", Value: make([]byte, 17)})
+			return err
+		}, codes.InvalidArgument},
+		{"put negative ttl", func() error {
+			_, err := c.Put(ctx, &gokvpb.PutRequest{Key: "testKey", Value: []byte("v"), Ttl: durationpb.New(-time.Second)})
+			return err
+		}, codes.InvalidArgument},
+		{"put if absent", func() error {
+			_, err := c.Put(ctx, &gokvpb.PutRequest{Key: "testKey", Value: []byte("v"), Version: version(0)})
+			return err
+		}, codes.FailedPrecondition},
+		{"delete stale version", func() error {
+			_, err := c.Delete(ctx, &gokvpb.DeleteRequest{Key: "testKey", Version: version(put.Version + 1)})
+			return err
+		}, codes.FailedPrecondition},
+		{"delete current version", func() error {
+			_, err := c.Delete(ctx, &gokvpb.DeleteRequest{Key: "testKey", Version: version(put.Version)})
+			return err
+		}, codes.OK},
+		{"get deleted key", func() error {
+			_, err := c.Get(ctx, &gokvpb.GetRequest{Key: "testKey"})
+			return err
+		}, codes.NotFound},
+		{"delete missing key", func() error {
+			_, err := c.Delete(ctx, &gokvpb.DeleteRequest{Key: "testKey"})
+			return err
+		}, codes.OK},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := status.Code(tc.call()); got != tc.want {
+				t.Errorf("expected code %v, got %v instead", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestScan(t *testing.T) {
+	c, stop := newTestClient(t)
+	defer stop()
+	ctx := context.Background()
+
+	for _, k := range []string{"a", "b/1", "b/2", "b/3", "c"} {
+		if _, err := c.Put(ctx, &gokvpb.PutRequest{Key: k, Value: []byte("v" + k)}); err != nil {
+			t.Fatalf("Expected err to be %v, got %v instead", nil, err)
+		}
+	}
+
+	testCases := []struct {
+		name     string
+		req      *gokvpb.ScanRequest
+		wantKeys []string
+		wantNext string
+		wantCode codes.Code
+	}{
+		{"every key", &gokvpb.ScanRequest{}, []string{"a", "b/1", "b/2", "b/3", "c"}, "", codes.OK},
+		{"range", &gokvpb.ScanRequest{Start: "b", End: "c"}, []string{"b/1", "b/2", "b/3"}, "", codes.OK},
+		{"prefix", &gokvpb.ScanRequest{Prefix: "b/"}, []string{"b/1", "b/2", "b/3"}, "", codes.OK},
+		{"prefix page", &gokvpb.ScanRequest{Prefix: "b/", Limit: 2}, []string{"b/1", "b/2"}, "b/3", codes.OK},
+		{"prefix next page", &gokvpb.ScanRequest{Prefix: "b/", Start: "b/3", Limit: 2}, []string{"b/3"}, "", codes.OK},
+		{"invalid limit", &gokvpb.ScanRequest{Limit: maxScanLimit + 1}, nil, "", codes.InvalidArgument},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := c.Scan(ctx, tc.req)
+			if got := status.Code(err); got != tc.wantCode {
+				t.Fatalf("expected code %v, got %v instead", tc.wantCode, got)
+			}
+
+			var keys []string
+			for _, kv := range res.GetKvs() {
+				keys = append(keys, kv.Key)
+				if string(kv.Value) != "v"+kv.Key || kv.Version == 0 {
+					t.Errorf("expected value v%s with a version, got %s at version %d instead", kv.Key, kv.Value, kv.Version)
+				}
+			}
+			if !reflect.DeepEqual(keys, tc.wantKeys) || res.GetNext() != tc.wantNext {
+				t.Errorf("expected keys %v and next %q, got %v and %q instead", tc.wantKeys, tc.wantNext, keys, res.GetNext())
+			}
+		})
+	}
+}
+
+func TestTxn(t *testing.T) {
+	c, stop := newTestClient(t)
+	defer stop()
+	ctx := context.Background()
+
+	if _, err := c.Put(ctx, &gokvpb.PutRequest{Key: "testKey1", Value: []byte("value1")}); err != nil {
+		t.Fatalf("Expected err to be %v, got %v instead", nil, err)
+	}
+
+	testCases := []struct {
+		name     string
+		ops      []*gokvpb.Op
+		wantCode codes.Code
+	}{
+		{"empty", nil, codes.InvalidArgument},
+		{"invalid op", []*gokvpb.Op{{Key: "testKey2", Value: []byte("value2")}}, codes.InvalidArgument},
+		{"missing value", []*gokvpb.Op{{Type: gokvpb.OpType_OP_TYPE_PUT, Key: "testKey2"}}, codes.InvalidArgument},
+		{"version mismatch", []*gokvpb.Op{
+			{Type: gokvpb.OpType_OP_TYPE_PUT, Key: "testKey2", Value: []byte("value2")},
+			{Type: gokvpb.OpType_OP_TYPE_DELETE, Key: "testKey1", Version: version(0)},
+		}, codes.FailedPrecondition},
+		{"applied", []*gokvpb.Op{
+			{Type: gokvpb.OpType_OP_TYPE_PUT, Key: "testKey2", Value: []byte("value2"), Version: version(0)},
+			{Type: gokvpb.OpType_OP_TYPE_DELETE, Key: "testKey1"},
+		}, codes.OK},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := c.Txn(ctx, &gokvpb.TxnRequest{Ops: tc.ops})
+			if got := status.Code(err); got != tc.wantCode {
+				t.Fatalf("expected code %v, got %v instead", tc.wantCode, got)
+			}
+			if err == nil && (len(res.Versions) != 2 || res.Versions[0] == 0 || res.Versions[1] != 0) {
+				t.Errorf("expected a version for the put and 0 for the delete, got %v instead", res.Versions)
+			}
+		})
+	}
+
+	// the failed transactions did not apply any operation
+	if _, err := c.Get(ctx, &gokvpb.GetRequest{Key: "testKey1"}); status.Code(err) != codes.NotFound {
+		t.Errorf("expected code %v, got %v instead", codes.NotFound, status.Code(err))
+	}
+	if res, err := c.Get(ctx, &gokvpb.GetRequest{Key: "testKey2"}); err != nil || string(res.Value) != "value2" {
+		t.Errorf("expected value2, got %v (%v) instead", res, err)
+	}
+}
+
+func TestLargeValue(t *testing.T) {
+	c, stop := newTestClient(t, store.WithMaxValueSize(8<<20))
+	defer stop()
+	ctx := context.Background()
+
+	// the value is larger than the default max message size of gRPC
+	value := bytes.Repeat([]byte("v"), 6<<20)
+	if _, err := c.Put(ctx, &gokvpb.PutRequest{Key: "testKey", Value: value}); err != nil {
+		t.Fatalf("Expected err to be %v, got %v instead", nil, err)
+	}
+
+	res, err := c.Get(ctx, &gokvpb.GetRequest{Key: "testKey"})
+	if err != nil {
+		t.Fatalf("Expected err to be %v, got %v instead", nil, err)
+	}
+	if !bytes.Equal(res.Value, value) {
+		t.Errorf("Expected the value of %d bytes, got %d bytes instead", len(value), len(res.Value))
+	}
+}
+
+func TestWatch(t *testing.T) {
+	c, stop := newTestClient(t)
+	defer stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	receive := func(stream gokvpb.KV_WatchClient) *gokvpb.WatchResponse {
+		res, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("Expected err to be %v, got %v instead", nil, err)
+		}
+		return res
+	}
+
+	// the watch is resumed from the start of the log, so that the changes applied before
+	// its stream is open on the server are read back instead of being missed
+	live, err := c.Watch(ctx, &gokvpb.WatchRequest{Prefix: "a/", Since: version(0)})
+	if err != nil {
+		t.Fatalf("Expected err to be %v, got %v instead", nil, err)
+	}
+
+	if _, err := c.Put(ctx, &gokvpb.PutRequest{Key: "b/1", Value: []byte("value1")}); err != nil {
+		t.Fatalf("Expected err to be %v, got %v instead", nil, err)
+	}
+	if _, err := c.Put(ctx, &gokvpb.PutRequest{Key: "a/1", Value: []byte("value1"), ContentType: "text/plain"}); err != nil {
+		t.Fatalf("Expected err to be %v, got %v instead", nil, err)
+	}
+	if _, err := c.Delete(ctx, &gokvpb.DeleteRequest{Key: "a/1"}); err != nil {
+		t.Fatalf("Expected err to be %v, got %v instead", nil, err)
+	}
+
+	first := receive(live)
+	if first.Type != gokvpb.EventType_EVENT_TYPE_PUT || first.Key != "a/1" || string(first.Value) != "value1" || first.ContentType != "text/plain" {
+		t.Errorf("expected the put of a/1, got %v instead", first)
+	}
+	second := receive(live)
+	if second.Type != gokvpb.EventType_EVENT_TYPE_DELETE || second.Key != "a/1" || second.Sequence <= first.Sequence {
+		t.Errorf("expected the delete of a/1 after sequence %d, got %v instead", first.Sequence, second)
+	}
+
+	// a watch resumed from the put first reads the delete back from the log
+	resumed, err := c.Watch(ctx, &gokvpb.WatchRequest{Prefix: "a/", Since: &first.Sequence})
+	if err != nil {
+		t.Fatalf("Expected err to be %v, got %v instead", nil, err)
+	}
+	if got := receive(resumed); got.Sequence != second.Sequence || got.Type != gokvpb.EventType_EVENT_TYPE_DELETE {
+		t.Errorf("expected the delete at sequence %d, got %v instead", second.Sequence, got)
+	}
+
+	// changes keep being streamed after the ones read back
+	if _, err := c.Put(ctx, &gokvpb.PutRequest{Key: "a/2", Value: []byte("value2")}); err != nil {
+		t.Fatalf("Expected err to be %v, got %v instead", nil, err)
+	}
+	for _, stream := range []gokvpb.KV_WatchClient{live, resumed} {
+		if got := receive(stream); got.Key != "a/2" || got.Sequence <= second.Sequence {
+			t.Errorf("expected the put of a/2 after sequence %d, got %v instead", second.Sequence, got)
+		}
+	}
+}
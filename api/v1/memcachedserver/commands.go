@@ -0,0 +1,268 @@
+package memcachedserver
+
+import (
+	"fmt"
+	"github.com/shubham1172/gokv/internal/logger"
+	"github.com/shubham1172/gokv/pkg/store"
+	"io"
+	"strconv"
+	"time"
+)
+
+// maxRelativeExpiry is the largest expiration time read as a number of seconds from now, larger ones are unix times.
+const maxRelativeExpiry = 60 * 60 * 24 * 30
+
+const (
+	replyStored     = "STORED"
+	replyNotStored  = "NOT_STORED"
+	replyExists     = "EXISTS"
+	replyNotFound   = "NOT_FOUND"
+	replyDeleted    = "DELETED"
+	replyTouched    = "TOUCHED"
+	replyError      = "ERROR"
+	replyBadFormat  = "CLIENT_ERROR bad command line format"
+	replyBadChunk   = "CLIENT_ERROR bad data chunk"
+	replyBadDelta   = "CLIENT_ERROR invalid numeric delta argument"
+	replyNonNumeric = "CLIENT_ERROR cannot increment or decrement non-numeric value"
+	replyTooLarge   = "SERVER_ERROR object too large for cache"
+)
+
+// expiry returns the time at which an item stored with an expiration time expires, zero if it never does.
+// expired is set if the item expires immediately, for a negative time or a unix time in the past.
+func expiry(exptime int64, now time.Time) (expiresAt time.Time, expired bool) {
+	switch {
+	case exptime == 0:
+		return time.Time{}, false
+	case exptime < 0:
+		return time.Time{}, true
+	case exptime <= maxRelativeExpiry:
+		return now.Add(time.Duration(exptime) * time.Second), false
+	}
+
+	expiresAt = time.Unix(exptime, 0)
+	return expiresAt, !expiresAt.After(now)
+}
+
+// get writes the items of the keys which exist, along with their cas unique for gets.
+func (c *conn) get(args []string) (string, error) {
+	if len(args) < 2 {
+		return replyError, nil
+	}
+
+	for _, k := range args[1:] {
+		e, err := c.store.GetEntry(k)
+		if err != nil {
+			continue
+		}
+
+		fmt.Fprintf(c.w, "VALUE %s %d %d", k, e.Flags, len(e.Value))
+		if args[0] == "gets" {
+			fmt.Fprintf(c.w, " %d", e.Version)
+		}
+		c.w.WriteString("\r\n")
+		c.w.Write(e.Value)
+		c.w.WriteString("\r\n")
+	}
+
+	return "END", nil
+}
+
+// set runs set, add, replace and cas: <command> <key> <flags> <exptime> <bytes> [<cas unique>],
+// followed by a data block of the given number of bytes. Add only stores an item whose key does
+// not exist, replace one whose key exists, and cas one whose cas unique has not changed.
+func (c *conn) set(args []string) (string, error) {
+	n := 5
+	if args[0] == "cas" {
+		n = 6
+	}
+	if len(args) != n {
+		return replyError, nil
+	}
+
+	f, err1 := strconv.ParseUint(args[2], 10, 32)
+	exptime, err2 := strconv.ParseInt(args[3], 10, 64)
+	size, err3 := strconv.Atoi(args[4])
+	if err1 != nil || err2 != nil || err3 != nil || size < 0 {
+		return replyBadFormat, nil
+	}
+
+	var unique uint64
+	if args[0] == "cas" {
+		var err error
+		if unique, err = strconv.ParseUint(args[5], 10, 64); err != nil {
+			return replyBadFormat, nil
+		}
+	}
+
+	// a data block larger than a value is skipped before it is buffered
+	if size > c.store.MaxValueSize() {
+		if _, err := c.r.Discard(size + 2); err != nil {
+			return "", err
+		}
+		return replyTooLarge, nil
+	}
+
+	data := make([]byte, size+2)
+	if _, err := io.ReadFull(c.r, data); err != nil {
+		return "", err
+	}
+	if data[size] != '\r' || data[size+1] != '\n' {
+		// the rest of the line is skipped, so that the next command can be read
+		if data[size+1] != '\n' {
+			if err := c.skipLine(); err != nil {
+				return "", err
+			}
+		}
+		return replyBadChunk, nil
+	}
+
+	key := args[1]
+	expiresAt, expired := expiry(exptime, time.Now())
+
+	op := store.Op{Type: store.OpPut, Key: key, Value: data[:size], Flags: uint32(f), ExpiresAt: expiresAt}
+	switch args[0] {
+	case "add":
+		op.Cond = store.IfAbsent()
+	case "replace":
+		op.Cond = store.IfPresent()
+	case "cas":
+		op.Cond = func(version uint64) bool { return version != 0 && version == unique }
+	}
+
+	// an item which expires immediately is stored and removed at once
+	if expired {
+		op = store.Op{Type: store.OpDelete, Key: key, Cond: op.Cond}
+	}
+
+	_, err := logger.Apply(c.store, []store.Op{op}, c.asyncWrites)
+	if err == store.ErrorVersionMismatch {
+		if args[0] != "cas" {
+			return replyNotStored, nil
+		}
+		if _, err := c.store.GetEntry(key); err == store.ErrorKeyNotFound {
+			return replyNotFound, nil
+		}
+		return replyExists, nil
+	}
+	if err != nil {
+		return errorReply(err), nil
+	}
+
+	return replyStored, nil
+}
+
+// delete runs delete <key>.
+func (c *conn) delete(args []string) (string, error) {
+	if len(args) != 2 {
+		return replyError, nil
+	}
+
+	_, err := logger.Apply(c.store, []store.Op{{Type: store.OpDelete, Key: args[1], Cond: store.IfPresent()}}, c.asyncWrites)
+	if err == store.ErrorVersionMismatch {
+		return replyNotFound, nil
+	}
+	if err != nil {
+		return errorReply(err), nil
+	}
+
+	return replyDeleted, nil
+}
+
+// incr runs incr and decr <key> <value>, which add or subtract a value to the decimal unsigned 64 bit
+// integer held by a key, and reply with the result. Increments wrap around, decrements stop at 0.
+// The key keeps its flags and its expiry.
+func (c *conn) incr(args []string) (string, error) {
+	if len(args) != 3 {
+		return replyError, nil
+	}
+
+	delta, err := strconv.ParseUint(args[2], 10, 64)
+	if err != nil {
+		return replyBadDelta, nil
+	}
+
+	for {
+		e, err := c.store.GetEntry(args[1])
+		if err == store.ErrorKeyNotFound {
+			return replyNotFound, nil
+		}
+		if err != nil {
+			return errorReply(err), nil
+		}
+
+		v, err := strconv.ParseUint(string(e.Value), 10, 64)
+		if err != nil {
+			return replyNonNumeric, nil
+		}
+
+		if args[0] == "incr" {
+			v += delta
+		} else if delta > v {
+			v = 0
+		} else {
+			v -= delta
+		}
+
+		// the increment is retried if the key was written since it was read
+		_, err = logger.Apply(c.store, []store.Op{{
+			Type:        store.OpPut,
+			Key:         args[1],
+			Value:       []byte(strconv.FormatUint(v, 10)),
+			ContentType: e.ContentType,
+			Flags:       e.Flags,
+			ExpiresAt:   e.ExpiresAt,
+			Cond:        store.IfVersion(e.Version),
+		}}, c.asyncWrites)
+		if err == store.ErrorVersionMismatch {
+			continue
+		}
+		if err != nil {
+			return errorReply(err), nil
+		}
+
+		return strconv.FormatUint(v, 10), nil
+	}
+}
+
+// touch runs touch <key> <exptime>, which sets the expiry of a key. The value is stored again with a new cas unique.
+func (c *conn) touch(args []string) (string, error) {
+	if len(args) != 3 {
+		return replyError, nil
+	}
+
+	exptime, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		return replyBadFormat, nil
+	}
+
+	for {
+		e, err := c.store.GetEntry(args[1])
+		if err == store.ErrorKeyNotFound {
+			return replyNotFound, nil
+		}
+		if err != nil {
+			return errorReply(err), nil
+		}
+
+		op := store.Op{Type: store.OpDelete, Key: args[1], Cond: store.IfVersion(e.Version)}
+		expiresAt, expired := expiry(exptime, time.Now())
+		if !expired {
+			op.Type, op.Value, op.ContentType, op.Flags, op.ExpiresAt = store.OpPut, e.Value, e.ContentType, e.Flags, expiresAt
+		}
+
+		// the touch is retried if the key was written since it was read
+		_, err = logger.Apply(c.store, []store.Op{op}, c.asyncWrites)
+		if err == store.ErrorVersionMismatch {
+			continue
+		}
+		if err != nil {
+			return errorReply(err), nil
+		}
+
+		return replyTouched, nil
+	}
+}
+
+func (c *conn) version(args []string) (string, error) {
+	return "VERSION gokv", nil
+}
@@ -0,0 +1,170 @@
+// Package memcachedserver serves the memcached text protocol on top of the store, so that memcached
+// clients can read and write its keys. The cas unique of an item is its version in the store, and
+// writes are persisted to the transaction log by the CommitFunc of the store like the writes of the http api.
+package memcachedserver
+
+import (
+	"bufio"
+	"github.com/shubham1172/gokv/pkg/store"
+	"log"
+	"net"
+	"strings"
+)
+
+// maxLineSize is the max size in bytes of a command line, longer lines close the connection.
+const maxLineSize = 64 << 10
+
+// server holds the dependencies shared by the connections.
+type server struct {
+	store       *store.Store
+	asyncWrites bool // Answer writes without waiting for the transaction log
+}
+
+// Option configures the memcached server.
+type Option func(*server)
+
+// WithAsyncWrites answers writes without waiting for them to be persisted, see logger.Apply.
+func WithAsyncWrites() Option {
+	return func(s *server) {
+		s.asyncWrites = true
+	}
+}
+
+// command is a memcached command.
+type command struct {
+	// run runs the command and returns its reply, or the last line of its reply for retrievals.
+	// An error is only returned if the connection failed.
+	run func(c *conn, args []string) (string, error)
+	// noreply is set for the commands whose reply is skipped if their last argument is noreply.
+	noreply bool
+}
+
+// commands are the supported commands by name.
+var commands = map[string]command{
+	"get":     {(*conn).get, false},
+	"gets":    {(*conn).get, false},
+	"set":     {(*conn).set, true},
+	"add":     {(*conn).set, true},
+	"replace": {(*conn).set, true},
+	"cas":     {(*conn).set, true},
+	"delete":  {(*conn).delete, true},
+	"incr":    {(*conn).incr, true},
+	"decr":    {(*conn).incr, true},
+	"touch":   {(*conn).touch, true},
+	"version": {(*conn).version, false},
+}
+
+// errorReply returns the reply standing for an error returned by the store.
+func errorReply(err error) string {
+	switch err {
+	case store.ErrorKeySizeTooLarge:
+		return replyBadFormat
+	case store.ErrorValueSizeTooLarge:
+		return replyTooLarge
+	case store.ErrorStoreFull:
+		return "SERVER_ERROR out of memory storing object"
+	}
+	return "SERVER_ERROR " + err.Error()
+}
+
+// conn serves the commands sent on a connection in order.
+type conn struct {
+	*server
+	r *bufio.Reader
+	w *bufio.Writer
+}
+
+// serve runs the commands sent on nc until it is closed.
+func (s *server) serve(nc net.Conn) {
+	defer nc.Close()
+
+	c := &conn{server: s, r: bufio.NewReaderSize(nc, maxLineSize), w: bufio.NewWriter(nc)}
+	for {
+		line, err := c.r.ReadSlice('\n')
+		if err != nil {
+			if err == bufio.ErrBufferFull {
+				c.w.WriteString("CLIENT_ERROR line too long\r\n")
+				c.w.Flush()
+			}
+			return
+		}
+
+		args := strings.Fields(string(line))
+		if len(args) == 0 {
+			c.w.WriteString("ERROR\r\n")
+		} else if args[0] == "quit" {
+			c.w.Flush()
+			return
+		} else if err := c.run(args); err != nil {
+			return
+		}
+
+		// the replies of pipelined commands are flushed together
+		if c.r.Buffered() == 0 {
+			if err := c.w.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// run runs a command and writes its reply.
+func (c *conn) run(args []string) error {
+	cmd, ok := commands[args[0]]
+	if !ok {
+		c.w.WriteString("ERROR\r\n")
+		return nil
+	}
+
+	noreply := cmd.noreply && len(args) > 2 && args[len(args)-1] == "noreply"
+	if noreply {
+		args = args[:len(args)-1]
+	}
+
+	reply, err := cmd.run(c, args)
+	if err != nil {
+		return err
+	}
+	if !noreply {
+		c.w.WriteString(reply + "\r\n")
+	}
+	return nil
+}
+
+// skipLine discards the input up to the end of the current line.
+func (c *conn) skipLine() error {
+	for {
+		_, err := c.r.ReadSlice('\n')
+		if err != bufio.ErrBufferFull {
+			return err
+		}
+	}
+}
+
+// Serve serves the memcached text protocol on the connections accepted by lis on top of the given
+// store, until lis is closed. Writes are answered once they are persisted to the transaction log,
+// unless configured otherwise.
+func Serve(lis net.Listener, st *store.Store, opts ...Option) error {
+	s := &server{store: st}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	for {
+		nc, err := lis.Accept()
+		if err != nil {
+			return err
+		}
+		go s.serve(nc)
+	}
+}
+
+// Start the memcached server on the given address.
+func Start(addr string, st *store.Store, opts ...Option) {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Fatalf("failed to listen on %s: %v", addr, err)
+	}
+
+	log.Fatal(Serve(lis, st, opts...))
+}
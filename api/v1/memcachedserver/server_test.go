@@ -0,0 +1,154 @@
+package memcachedserver
+
+import (
+	"bufio"
+	"github.com/shubham1172/gokv/config"
+	"github.com/shubham1172/gokv/internal/logger"
+	"github.com/shubham1172/gokv/pkg/store"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestConn serves the memcached protocol on a local port, on top of a store whose changes are
+// persisted to a bolt logger, and returns a connection to it.
+func newTestConn(t *testing.T) (net.Conn, *bufio.Reader, *store.Store, func()) {
+	l, err := logger.NewBoltTransactionLogger(config.LoggingConfiguration{BoltFileName: filepath.Join(t.TempDir(), "transactions.db")})
+	if err != nil {
+		t.Fatalf("could not create logger: %v", err)
+	}
+	go l.Run()
+
+	st := store.New(store.WithMaxValueSize(32), store.WithCommitFunc(logger.CommitFunc(l)))
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	go Serve(lis, st)
+
+	nc, err := net.Dial("tcp", lis.Addr().String())
+	if err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+	nc.SetDeadline(time.Now().Add(10 * time.Second))
+
+	return nc, bufio.NewReader(nc), st, func() {
+		nc.Close()
+		lis.Close()
+		st.Close()
+		l.Stop()
+	}
+}
+
+func TestCommands(t *testing.T) {
+	nc, br, st, stop := newTestConn(t)
+	defer stop()
+
+	testCases := []struct {
+		input string
+		want  string
+	}{
+		{"get k1\r\n", "END\r\n"},
+		{"set k1 0 0 2\r\nv1\r\n", "STORED\r\n"},
+		{"get k1\r\n", "VALUE k1 0 2\r\nv1\r\nEND\r\n"},
+		{"set k2 42 0 2\r\nv2\r\n", "STORED\r\n"},
+		{"gets k1 missing k2\r\n", "VALUE k1 0 2 1\r\nv1\r\nVALUE k2 42 2 2\r\nv2\r\nEND\r\n"},
+		{"add k1 0 0 2\r\nv3\r\n", "NOT_STORED\r\n"},
+		{"add k3 0 0 2\r\nv3\r\n", "STORED\r\n"},
+		{"replace k4 0 0 2\r\nv4\r\n", "NOT_STORED\r\n"},
+		{"replace k3 0 0 3\r\nv33\r\n", "STORED\r\n"},
+		{"get k3\r\n", "VALUE k3 0 3\r\nv33\r\nEND\r\n"},
+		{"cas k1 0 0 2 2\r\nv5\r\n", "EXISTS\r\n"},
+		{"cas k1 7 0 2 1\r\nv5\r\n", "STORED\r\n"},
+		{"gets k1\r\n", "VALUE k1 7 2 5\r\nv5\r\nEND\r\n"},
+		{"cas k4 0 0 2 0\r\nv4\r\n", "NOT_FOUND\r\n"},
+		{"set k1 0 0 " + "33\r\n" + strings.Repeat("v", 33) + "\r\n", "SERVER_ERROR object too large for cache\r\n"},
+		{"set k1 0 0 2\r\nv1x\r\n", "CLIENT_ERROR bad data chunk\r\n"},
+		{"\r\n", "ERROR\r\n"},
+		{"set k1 0 0\r\n", "ERROR\r\n"},
+		{"set k1 x 0 2\r\n", "CLIENT_ERROR bad command line format\r\n"},
+		{"delete k3\r\n", "DELETED\r\n"},
+		{"delete k3\r\n", "NOT_FOUND\r\n"},
+		{"incr counter 1\r\n", "NOT_FOUND\r\n"},
+		{"set counter 0 100 2\r\n10\r\n", "STORED\r\n"},
+		{"incr counter 5\r\n", "15\r\n"},
+		{"decr counter 20\r\n", "0\r\n"},
+		{"incr counter x\r\n", "CLIENT_ERROR invalid numeric delta argument\r\n"},
+		{"incr k2 1\r\n", "CLIENT_ERROR cannot increment or decrement non-numeric value\r\n"},
+		{"set counter 0 0 20\r\n18446744073709551615\r\n", "STORED\r\n"},
+		{"incr counter 2\r\n", "1\r\n"},
+		{"touch missing 10\r\n", "NOT_FOUND\r\n"},
+		{"touch k2 100\r\n", "TOUCHED\r\n"},
+		{"get k2\r\n", "VALUE k2 42 2\r\nv2\r\nEND\r\n"},
+		{"touch k2 -1\r\n", "TOUCHED\r\n"},
+		{"get k2\r\n", "END\r\n"},
+		{"set k5 0 -1 2\r\nv5\r\n", "STORED\r\n"},
+		{"get k5\r\n", "END\r\n"},
+		{"set k5 0 1 2 noreply\r\nv5\r\nget k5\r\n", "VALUE k5 0 2\r\nv5\r\nEND\r\n"},
+		{"delete k5 noreply\r\nget k5\r\n", "END\r\n"},
+		{"flush_all\r\n", "ERROR\r\n"},
+		{"version\r\n", "VERSION gokv\r\n"},
+	}
+
+	for _, tc := range testCases {
+		if _, err := io.WriteString(nc, tc.input); err != nil {
+			t.Fatalf("could not send command: %v", err)
+		}
+
+		got := make([]byte, len(tc.want))
+		if _, err := io.ReadFull(br, got); err != nil {
+			t.Fatalf("could not read reply: %v", err)
+		}
+		if string(got) != tc.want {
+			t.Errorf("%q: expected reply %q, got %q instead", tc.input, tc.want, got)
+		}
+	}
+
+	// the expiry of a key is kept by incr and set by touch
+	if ttl, err := st.TTL("counter"); err != nil || ttl != store.NoExpiry {
+		t.Errorf("expected counter to never expire, got %v (%v) instead", ttl, err)
+	}
+
+	// the flags are kept apart from the content type, which the http api returns
+	if e, err := st.GetEntry("k1"); err != nil || e.Flags != 7 || e.ContentType != "" {
+		t.Errorf("expected k1 to have flags 7 and no content type, got %d and %q (%v) instead", e.Flags, e.ContentType, err)
+	}
+
+	if _, err := io.WriteString(nc, "quit\r\n"); err != nil {
+		t.Fatalf("could not send command: %v", err)
+	}
+	if _, err := br.ReadByte(); err != io.EOF {
+		t.Errorf("Expected err to be %v, got %v instead", io.EOF, err)
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+
+	testCases := []struct {
+		name        string
+		exptime     int64
+		wantAt      time.Time
+		wantExpired bool
+	}{
+		{"never", 0, time.Time{}, false},
+		{"relative", 60, now.Add(time.Minute), false},
+		{"max relative", maxRelativeExpiry, now.Add(maxRelativeExpiry * time.Second), false},
+		{"unix time", now.Unix() + 60, now.Add(time.Minute), false},
+		{"unix time in the past", now.Unix() - 60, now.Add(-time.Minute), true},
+		{"negative", -1, time.Time{}, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			at, expired := expiry(tc.exptime, now)
+			if !at.Equal(tc.wantAt) || expired != tc.wantExpired {
+				t.Errorf("expected %v (expired %v), got %v (expired %v) instead", tc.wantAt, tc.wantExpired, at, expired)
+			}
+		})
+	}
+}
@@ -0,0 +1,481 @@
+package redisserver
+
+import (
+	"fmt"
+	"github.com/shubham1172/gokv/internal/logger"
+	"github.com/shubham1172/gokv/pkg/store"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultScanCount is the number of keys scanned by SCAN if no count is given.
+const defaultScanCount = 10
+
+const messageSyntaxError string = "ERR syntax error"
+const messageNotInteger string = "ERR value is not an integer or out of range"
+const messageOverflow string = "ERR increment or decrement would overflow"
+const messageInvalidExpire string = "ERR invalid expire time in '%s' command"
+const messageInvalidCursor string = "ERR invalid cursor"
+const messageInvalidDB string = "ERR DB index is out of range"
+const messageNoProto string = "NOPROTO unsupported protocol version"
+
+// ping replies PONG, or its argument. Subscribed RESP2 clients receive it as a message.
+func (c *conn) ping(args [][]byte) {
+	if len(args) > 2 {
+		c.w.Error("ERR wrong number of arguments for 'ping' command")
+		return
+	}
+
+	if c.w.proto == 2 && c.subscriptions() > 0 {
+		c.w.Array(2)
+		c.w.BulkString("pong")
+		if len(args) == 2 {
+			c.w.Bulk(args[1])
+		} else {
+			c.w.BulkString("")
+		}
+		return
+	}
+
+	if len(args) == 2 {
+		c.w.Bulk(args[1])
+	} else {
+		c.w.SimpleString("PONG")
+	}
+}
+
+func (c *conn) echo(args [][]byte) {
+	c.w.Bulk(args[1])
+}
+
+// hello switches to the version of the protocol given, and replies with the properties of the server.
+// Authentication is not supported, the other options are ignored.
+func (c *conn) hello(args [][]byte) {
+	if len(args) > 1 {
+		proto, err := strconv.Atoi(string(args[1]))
+		if err != nil || (proto != 2 && proto != 3) {
+			c.w.Error(messageNoProto)
+			return
+		}
+		c.w.proto = proto
+	}
+
+	c.w.Map(5)
+	c.w.BulkString("server")
+	c.w.BulkString("gokv")
+	c.w.BulkString("proto")
+	c.w.Integer(int64(c.w.proto))
+	c.w.BulkString("mode")
+	c.w.BulkString("standalone")
+	c.w.BulkString("role")
+	c.w.BulkString("master")
+	c.w.BulkString("modules")
+	c.w.Array(0)
+}
+
+// selectDB only accepts the database 0, which holds every key.
+func (c *conn) selectDB(args [][]byte) {
+	if string(args[1]) != "0" {
+		c.w.Error(messageInvalidDB)
+		return
+	}
+	c.w.SimpleString("OK")
+}
+
+func (c *conn) quit(args [][]byte) {
+	c.closing = true
+	c.w.SimpleString("OK")
+}
+
+func (c *conn) get(args [][]byte) {
+	v, err := c.store.Get(string(args[1]))
+	if err == store.ErrorKeyNotFound {
+		c.w.Null()
+		return
+	}
+	if err != nil {
+		c.w.Error(errorMessage(err))
+		return
+	}
+	c.w.Bulk(v)
+}
+
+// set puts a value against a key. EX and PX set its expiry in seconds or milliseconds, NX only
+// puts it if the key does not exist and XX if it does. A key put without an expiry never expires.
+func (c *conn) set(args [][]byte) {
+	op := store.Op{Type: store.OpPut, Key: string(args[1]), Value: args[2]}
+
+	for i := 3; i < len(args); i++ {
+		switch opt := strings.ToUpper(string(args[i])); opt {
+		case "NX", "XX":
+			if op.Cond != nil {
+				c.w.Error(messageSyntaxError)
+				return
+			}
+			op.Cond = store.IfAbsent()
+			if opt == "XX" {
+				op.Cond = store.IfPresent()
+			}
+		case "EX", "PX":
+			if !op.ExpiresAt.IsZero() || i+1 == len(args) {
+				c.w.Error(messageSyntaxError)
+				return
+			}
+			i++
+
+			unit := time.Second
+			if opt == "PX" {
+				unit = time.Millisecond
+			}
+			n, err := strconv.ParseInt(string(args[i]), 10, 64)
+			if err != nil {
+				c.w.Error(messageNotInteger)
+				return
+			}
+			if n <= 0 || n > int64(math.MaxInt64/unit) {
+				c.w.Error(fmt.Sprintf(messageInvalidExpire, "set"))
+				return
+			}
+			op.ExpiresAt = time.Now().Add(time.Duration(n) * unit)
+		default:
+			c.w.Error(messageSyntaxError)
+			return
+		}
+	}
+
+	_, err := logger.Apply(c.store, []store.Op{op}, c.asyncWrites)
+	if err == store.ErrorVersionMismatch {
+		// the condition was not met
+		c.w.Null()
+		return
+	}
+	if err != nil {
+		c.w.Error(errorMessage(err))
+		return
+	}
+	c.w.SimpleString("OK")
+}
+
+// del deletes the keys atomically, and replies with the number of them which existed.
+func (c *conn) del(args [][]byte) {
+	for {
+		ops := make([]store.Op, 0, len(args)-1)
+		deleted := make(map[string]bool)
+		for _, k := range args[1:] {
+			key := string(k)
+			if deleted[key] {
+				continue
+			}
+
+			e, err := c.store.GetEntry(key)
+			if err == store.ErrorKeyNotFound {
+				continue
+			}
+			if err != nil {
+				c.w.Error(errorMessage(err))
+				return
+			}
+			deleted[key] = true
+			ops = append(ops, store.Op{Type: store.OpDelete, Key: key, Cond: store.IfVersion(e.Version)})
+		}
+
+		if len(ops) == 0 {
+			c.w.Integer(0)
+			return
+		}
+
+		// the deletes are retried if one of the keys was written since it was read
+		_, err := logger.Apply(c.store, ops, c.asyncWrites)
+		if err == store.ErrorVersionMismatch {
+			continue
+		}
+		if err != nil {
+			c.w.Error(errorMessage(err))
+			return
+		}
+		c.w.Integer(int64(len(ops)))
+		return
+	}
+}
+
+// exists replies with the number of the keys which exist, a key given twice is counted twice.
+func (c *conn) exists(args [][]byte) {
+	var n int64
+	for _, k := range args[1:] {
+		if _, err := c.store.TTL(string(k)); err == nil {
+			n++
+		}
+	}
+	c.w.Integer(n)
+}
+
+// keys replies with the keys matching a glob-style pattern in lexicographical order.
+func (c *conn) keys(args [][]byte) {
+	pattern := string(args[1])
+
+	prefix := literalPrefix(pattern)
+	kvs, err := c.store.Scan(prefix, store.PrefixEnd(prefix), 0)
+	if err != nil {
+		c.w.Error(errorMessage(err))
+		return
+	}
+
+	var keys []string
+	for _, kv := range kvs {
+		if match(pattern, kv.Key) {
+			keys = append(keys, kv.Key)
+		}
+	}
+
+	c.w.Array(len(keys))
+	for _, k := range keys {
+		c.w.BulkString(k)
+	}
+}
+
+// scan replies with a page of the keys in lexicographical order, along with the cursor of the next page,
+// 0 on the last page. COUNT sets the number of keys scanned, and MATCH a glob-style pattern which the
+// keys returned must match, so that a page may hold fewer keys than scanned.
+func (c *conn) scan(args [][]byte) {
+	id, err := strconv.ParseUint(string(args[1]), 10, 64)
+	if err != nil {
+		c.w.Error(messageInvalidCursor)
+		return
+	}
+
+	start := ""
+	if id != 0 {
+		var ok bool
+		if start, ok = c.cursor(id); !ok {
+			c.w.Error(messageInvalidCursor)
+			return
+		}
+	}
+
+	pattern, count := "*", defaultScanCount
+	for i := 2; i < len(args); i += 2 {
+		if i+1 == len(args) {
+			c.w.Error(messageSyntaxError)
+			return
+		}
+
+		switch strings.ToUpper(string(args[i])) {
+		case "MATCH":
+			pattern = string(args[i+1])
+		case "COUNT":
+			count, err = strconv.Atoi(string(args[i+1]))
+			if err != nil || count < 1 {
+				c.w.Error(messageNotInteger)
+				return
+			}
+		default:
+			c.w.Error(messageSyntaxError)
+			return
+		}
+	}
+
+	prefix := literalPrefix(pattern)
+	if start < prefix {
+		start = prefix
+	}
+
+	// fetch an extra pair to find out if there is a next page
+	kvs, err := c.store.Scan(start, store.PrefixEnd(prefix), count+1)
+	if err != nil {
+		c.w.Error(errorMessage(err))
+		return
+	}
+
+	var next uint64
+	if len(kvs) > count {
+		next = c.saveCursor(kvs[count].Key)
+		kvs = kvs[:count]
+	}
+
+	var keys []string
+	for _, kv := range kvs {
+		if match(pattern, kv.Key) {
+			keys = append(keys, kv.Key)
+		}
+	}
+
+	c.w.Array(2)
+	c.w.BulkString(strconv.FormatUint(next, 10))
+	c.w.Array(len(keys))
+	for _, k := range keys {
+		c.w.BulkString(k)
+	}
+}
+
+// mget replies with the values of the keys, null for the missing ones.
+func (c *conn) mget(args [][]byte) {
+	c.w.Array(len(args) - 1)
+	for _, k := range args[1:] {
+		v, err := c.store.Get(string(k))
+		if err != nil {
+			c.w.Null()
+			continue
+		}
+		c.w.Bulk(v)
+	}
+}
+
+// mset puts values against keys atomically.
+func (c *conn) mset(args [][]byte) {
+	if len(args)%2 == 0 {
+		c.w.Error("ERR wrong number of arguments for 'mset' command")
+		return
+	}
+
+	ops := make([]store.Op, 0, len(args)/2)
+	for i := 1; i < len(args); i += 2 {
+		ops = append(ops, store.Op{Type: store.OpPut, Key: string(args[i]), Value: args[i+1]})
+	}
+
+	if _, err := logger.Apply(c.store, ops, c.asyncWrites); err != nil {
+		c.w.Error(errorMessage(err))
+		return
+	}
+	c.w.SimpleString("OK")
+}
+
+func (c *conn) incr(args [][]byte) {
+	c.increment(string(args[1]), 1)
+}
+
+func (c *conn) decr(args [][]byte) {
+	c.increment(string(args[1]), -1)
+}
+
+func (c *conn) incrBy(args [][]byte) {
+	n, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		c.w.Error(messageNotInteger)
+		return
+	}
+	c.increment(string(args[1]), n)
+}
+
+func (c *conn) decrBy(args [][]byte) {
+	n, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil || n == math.MinInt64 {
+		c.w.Error(messageNotInteger)
+		return
+	}
+	c.increment(string(args[1]), -n)
+}
+
+// increment adds n to the integer held by a key, a missing key holding 0, and replies with the result.
+// The key keeps its expiry.
+func (c *conn) increment(key string, n int64) {
+	for {
+		e, err := c.store.GetEntry(key)
+		if err != nil && err != store.ErrorKeyNotFound {
+			c.w.Error(errorMessage(err))
+			return
+		}
+
+		var v int64
+		if err == nil {
+			v, err = strconv.ParseInt(string(e.Value), 10, 64)
+			if err != nil {
+				c.w.Error(messageNotInteger)
+				return
+			}
+		}
+
+		if (n > 0 && v > math.MaxInt64-n) || (n < 0 && v < math.MinInt64-n) {
+			c.w.Error(messageOverflow)
+			return
+		}
+		v += n
+
+		// the increment is retried if the key was written since it was read
+		_, err = logger.Apply(c.store, []store.Op{{
+			Type:        store.OpPut,
+			Key:         key,
+			Value:       []byte(strconv.FormatInt(v, 10)),
+			ContentType: e.ContentType,
+			ExpiresAt:   e.ExpiresAt,
+			Cond:        store.IfVersion(e.Version),
+		}}, c.asyncWrites)
+		if err == store.ErrorVersionMismatch {
+			continue
+		}
+		if err != nil {
+			c.w.Error(errorMessage(err))
+			return
+		}
+
+		c.w.Integer(v)
+		return
+	}
+}
+
+// expire sets the time to live of a key in seconds, a time <= 0 deletes the key. It replies
+// with 1, or 0 if the key does not exist. The value is put again with a new version.
+func (c *conn) expire(args [][]byte) {
+	key := string(args[1])
+
+	seconds, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		c.w.Error(messageNotInteger)
+		return
+	}
+	if seconds > int64(math.MaxInt64/time.Second) {
+		c.w.Error(fmt.Sprintf(messageInvalidExpire, "expire"))
+		return
+	}
+
+	for {
+		e, err := c.store.GetEntry(key)
+		if err == store.ErrorKeyNotFound {
+			c.w.Integer(0)
+			return
+		}
+		if err != nil {
+			c.w.Error(errorMessage(err))
+			return
+		}
+
+		op := store.Op{Type: store.OpDelete, Key: key, Cond: store.IfVersion(e.Version)}
+		if seconds > 0 {
+			op.Type, op.Value, op.ContentType = store.OpPut, e.Value, e.ContentType
+			op.ExpiresAt = time.Now().Add(time.Duration(seconds) * time.Second)
+		}
+
+		// the expiry is retried if the key was written since it was read
+		_, err = logger.Apply(c.store, []store.Op{op}, c.asyncWrites)
+		if err == store.ErrorVersionMismatch {
+			continue
+		}
+		if err != nil {
+			c.w.Error(errorMessage(err))
+			return
+		}
+
+		c.w.Integer(1)
+		return
+	}
+}
+
+// ttl replies with the remaining time to live of a key in seconds, -1 if it never expires and -2 if it does not exist.
+func (c *conn) ttl(args [][]byte) {
+	ttl, err := c.store.TTL(string(args[1]))
+	if err == store.ErrorKeyNotFound {
+		c.w.Integer(-2)
+		return
+	}
+	if err != nil {
+		c.w.Error(errorMessage(err))
+		return
+	}
+
+	if ttl == store.NoExpiry {
+		c.w.Integer(-1)
+		return
+	}
+	c.w.Integer(int64((ttl + time.Second/2) / time.Second))
+}
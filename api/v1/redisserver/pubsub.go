@@ -0,0 +1,148 @@
+package redisserver
+
+import (
+	"github.com/shubham1172/gokv/pkg/store"
+	"sort"
+)
+
+const (
+	// keyspacePrefix is the prefix of the channels receiving the events of a key, such as __keyspace@0__:a/1.
+	keyspacePrefix = "__keyspace@0__:"
+	// keyeventPrefix is the prefix of the channels receiving the keys of an event, such as __keyevent@0__:set.
+	keyeventPrefix = "__keyevent@0__:"
+)
+
+const messageNotificationsDisabled string = "ERR Keyspace notifications are not enabled"
+
+// eventNames are the names of the keyspace events, by type of change. Every write putting a value,
+// including INCR and EXPIRE, is a set.
+var eventNames = map[store.ChangeType]string{
+	store.ChangePut:    "set",
+	store.ChangeDelete: "del",
+	store.ChangeExpire: "expired",
+	store.ChangeEvict:  "evicted",
+}
+
+// subscriptions returns the number of channels and patterns subscribed to. The caller must hold the lock.
+func (c *conn) subscriptions() int {
+	return len(c.channels) + len(c.patterns)
+}
+
+// subscribe subscribes to keyspace notification channels.
+func (c *conn) subscribe(args [][]byte) {
+	c.subscribeTo("subscribe", c.channels, args[1:])
+}
+
+// psubscribe subscribes to the keyspace notification channels matching glob-style patterns.
+func (c *conn) psubscribe(args [][]byte) {
+	c.subscribeTo("psubscribe", c.patterns, args[1:])
+}
+
+// unsubscribe unsubscribes from channels, or from every channel if none is given.
+func (c *conn) unsubscribe(args [][]byte) {
+	c.unsubscribeFrom("unsubscribe", c.channels, args[1:])
+}
+
+// punsubscribe unsubscribes from patterns, or from every pattern if none is given.
+func (c *conn) punsubscribe(args [][]byte) {
+	c.unsubscribeFrom("punsubscribe", c.patterns, args[1:])
+}
+
+// subscribeTo adds names to a set of subscriptions, and confirms each of them. The first subscription
+// starts watching the changes. The caller must hold the lock.
+func (c *conn) subscribeTo(kind string, set map[string]struct{}, names [][]byte) {
+	if c.hub == nil {
+		c.w.Error(messageNotificationsDisabled)
+		return
+	}
+
+	for _, name := range names {
+		set[string(name)] = struct{}{}
+		c.confirm(kind, string(name))
+	}
+
+	if c.watcher == nil {
+		c.watcher = c.hub.Watch("")
+		go c.forward(c.watcher)
+	}
+}
+
+// unsubscribeFrom removes names from a set of subscriptions, or all of them if names is empty,
+// and confirms each of them. The last subscription stops watching the changes. The caller must hold the lock.
+func (c *conn) unsubscribeFrom(kind string, set map[string]struct{}, names [][]byte) {
+	if len(names) == 0 {
+		for name := range set {
+			names = append(names, []byte(name))
+		}
+		sort.Slice(names, func(i, j int) bool { return string(names[i]) < string(names[j]) })
+	}
+
+	if len(names) == 0 {
+		c.w.Push(3)
+		c.w.BulkString(kind)
+		c.w.Null()
+		c.w.Integer(int64(c.subscriptions()))
+	}
+	for _, name := range names {
+		delete(set, string(name))
+		c.confirm(kind, string(name))
+	}
+
+	if c.subscriptions() == 0 && c.watcher != nil {
+		c.watcher.Close()
+		c.watcher = nil
+	}
+}
+
+// confirm writes the confirmation of a change of subscription. The caller must hold the lock.
+func (c *conn) confirm(kind, name string) {
+	c.w.Push(3)
+	c.w.BulkString(kind)
+	c.w.BulkString(name)
+	c.w.Integer(int64(c.subscriptions()))
+}
+
+// forward writes the changes received by w to the connection as keyspace notifications, until w is closed.
+// A client which does not keep up with the changes is disconnected, like redis does with slow subscribers.
+func (c *conn) forward(w *store.Watcher) {
+	for n := range w.Notifications() {
+		c.mu.Lock()
+		// the changes left in a watcher which was replaced are dropped
+		if c.watcher == w {
+			c.notify(n)
+			if err := c.w.Flush(); err != nil {
+				c.nc.Close()
+			}
+		}
+		c.mu.Unlock()
+	}
+
+	if w.Err() == store.ErrorWatcherLagged {
+		c.nc.Close()
+	}
+}
+
+// notify writes a change to the channels and patterns subscribed to its key and to its event. The caller must hold the lock.
+func (c *conn) notify(n store.Notification) {
+	event := eventNames[n.Type]
+
+	for _, m := range [][2]string{{keyspacePrefix + n.Key, event}, {keyeventPrefix + event, n.Key}} {
+		channel, message := m[0], m[1]
+
+		if _, ok := c.channels[channel]; ok {
+			c.w.Push(3)
+			c.w.BulkString("message")
+			c.w.BulkString(channel)
+			c.w.BulkString(message)
+		}
+		for pattern := range c.patterns {
+			if match(pattern, channel) {
+				c.w.Push(4)
+				c.w.BulkString("pmessage")
+				c.w.BulkString(pattern)
+				c.w.BulkString(channel)
+				c.w.BulkString(message)
+			}
+		}
+	}
+}
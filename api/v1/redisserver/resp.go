@@ -0,0 +1,186 @@
+package redisserver
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	// maxArgs is the max number of arguments of a command.
+	maxArgs = 1 << 20
+	// maxLineSize is the max size in bytes of an inline command, and of the other lines of the protocol.
+	maxLineSize = 64 << 10
+)
+
+// errArgTooLarge is returned by readCommand for a command with an argument larger than permitted.
+// The command is read entirely, so that the next one can be read.
+var errArgTooLarge = errors.New("Argument too large")
+
+// protocolError is a request which does not follow the protocol. It is answered, then the connection is closed.
+type protocolError string
+
+func (e protocolError) Error() string {
+	return "Protocol error: " + string(e)
+}
+
+// respReader reads commands sent as arrays of bulk strings, or as inline commands such as the ones typed in telnet.
+type respReader struct {
+	r          *bufio.Reader
+	maxArgSize int // Max size in bytes of an argument
+}
+
+// readLine reads a line without its terminator.
+func (r *respReader) readLine() ([]byte, error) {
+	line, err := r.r.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		return nil, protocolError("too big inline request")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	line = line[:len(line)-1]
+	if len(line) > 0 && line[len(line)-1] == '\r' {
+		line = line[:len(line)-1]
+	}
+	return line, nil
+}
+
+// readCommand reads the arguments of a command, the first of which is its name. It returns no argument for an empty line.
+func (r *respReader) readCommand() ([][]byte, error) {
+	line, err := r.readLine()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(line) == 0 || line[0] != '*' {
+		fields := strings.Fields(string(line))
+		args := make([][]byte, len(fields))
+		for i, f := range fields {
+			args[i] = []byte(f)
+		}
+		return args, nil
+	}
+
+	n, err := strconv.Atoi(string(line[1:]))
+	if err != nil || n > maxArgs {
+		return nil, protocolError("invalid multibulk length")
+	}
+
+	// the arguments are only allocated once they are read
+	capacity := n
+	if capacity > 64 {
+		capacity = 64
+	} else if capacity < 0 {
+		capacity = 0
+	}
+
+	tooLarge := false
+	args := make([][]byte, 0, capacity)
+	for i := 0; i < n; i++ {
+		line, err := r.readLine()
+		if err != nil {
+			return nil, err
+		}
+		if len(line) == 0 || line[0] != '$' {
+			return nil, protocolError(fmt.Sprintf("expected '$', got %q", line))
+		}
+
+		size, err := strconv.Atoi(string(line[1:]))
+		if err != nil || size < 0 {
+			return nil, protocolError("invalid bulk length")
+		}
+
+		if size > r.maxArgSize {
+			if _, err := r.r.Discard(size + 2); err != nil {
+				return nil, err
+			}
+			tooLarge = true
+			continue
+		}
+
+		arg := make([]byte, size+2)
+		if _, err := io.ReadFull(r.r, arg); err != nil {
+			return nil, err
+		}
+		if arg[size] != '\r' || arg[size+1] != '\n' {
+			return nil, protocolError("invalid bulk terminator")
+		}
+		args = append(args, arg[:size])
+	}
+
+	if tooLarge {
+		return nil, errArgTooLarge
+	}
+	return args, nil
+}
+
+// respWriter writes replies in the version of the protocol negotiated with HELLO. The types added by
+// RESP3, such as maps, nulls and pushes, are written as their RESP2 equivalent to RESP2 clients.
+// Write errors are returned by Flush.
+type respWriter struct {
+	w     *bufio.Writer
+	proto int // Version of the protocol, 2 or 3
+}
+
+func (w *respWriter) SimpleString(s string) {
+	w.w.WriteString("+" + s + "\r\n")
+}
+
+func (w *respWriter) Error(s string) {
+	w.w.WriteString("-" + s + "\r\n")
+}
+
+func (w *respWriter) Integer(n int64) {
+	w.w.WriteString(":" + strconv.FormatInt(n, 10) + "\r\n")
+}
+
+func (w *respWriter) Bulk(b []byte) {
+	w.w.WriteString("$" + strconv.Itoa(len(b)) + "\r\n")
+	w.w.Write(b)
+	w.w.WriteString("\r\n")
+}
+
+func (w *respWriter) BulkString(s string) {
+	w.Bulk([]byte(s))
+}
+
+// Null writes a missing value, as a null bulk string to RESP2 clients.
+func (w *respWriter) Null() {
+	if w.proto == 3 {
+		w.w.WriteString("_\r\n")
+	} else {
+		w.w.WriteString("$-1\r\n")
+	}
+}
+
+// Array starts an array of n elements, which are written next.
+func (w *respWriter) Array(n int) {
+	w.w.WriteString("*" + strconv.Itoa(n) + "\r\n")
+}
+
+// Map starts a map of n pairs, whose keys and values are written next, as an array of 2n elements to RESP2 clients.
+func (w *respWriter) Map(n int) {
+	if w.proto == 3 {
+		w.w.WriteString("%" + strconv.Itoa(n) + "\r\n")
+	} else {
+		w.Array(2 * n)
+	}
+}
+
+// Push starts an out of band message of n elements, written as an array to RESP2 clients.
+func (w *respWriter) Push(n int) {
+	if w.proto == 3 {
+		w.w.WriteString(">" + strconv.Itoa(n) + "\r\n")
+	} else {
+		w.Array(n)
+	}
+}
+
+func (w *respWriter) Flush() error {
+	return w.w.Flush()
+}
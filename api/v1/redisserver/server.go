@@ -0,0 +1,238 @@
+// Package redisserver serves a subset of the redis protocol, RESP2 and RESP3, on top of the store,
+// so that redis clients and redis-cli can read and write its keys. Writes are applied to the store,
+// whose CommitFunc persists them to the transaction log like the writes of the http api.
+package redisserver
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/shubham1172/gokv/pkg/store"
+	"log"
+	"net"
+	"strings"
+	"sync"
+)
+
+// maxCursors is the number of SCAN cursors remembered, the oldest ones are forgotten first.
+const maxCursors = 4096
+
+// server holds the dependencies shared by the connections.
+type server struct {
+	store       *store.Store
+	asyncWrites bool       // Answer writes without waiting for the transaction log
+	hub         *store.Hub // Hub publishing the changes persisted to the transaction log, nil if notifications are disabled
+
+	mu         sync.Mutex        // Protects cursors and lastCursor
+	cursors    map[uint64]string // First key of the next page of each SCAN cursor
+	lastCursor uint64
+}
+
+// Option configures the redis server.
+type Option func(*server)
+
+// WithAsyncWrites answers writes without waiting for them to be persisted, see logger.Apply.
+func WithAsyncWrites() Option {
+	return func(s *server) {
+		s.asyncWrites = true
+	}
+}
+
+// WithHub sends the changes published to h by the transaction log as keyspace notifications
+// to the clients subscribed to them.
+func WithHub(h *store.Hub) Option {
+	return func(s *server) {
+		s.hub = h
+	}
+}
+
+// command is a redis command.
+type command struct {
+	run func(c *conn, args [][]byte)
+	// arity is the number of arguments including the name of the command, or minus the minimum number of them.
+	arity int
+}
+
+// commands are the supported commands by lowercase name.
+var commands = map[string]command{
+	"ping":         {(*conn).ping, -1},
+	"echo":         {(*conn).echo, 2},
+	"hello":        {(*conn).hello, -1},
+	"select":       {(*conn).selectDB, 2},
+	"quit":         {(*conn).quit, 1},
+	"get":          {(*conn).get, 2},
+	"set":          {(*conn).set, -3},
+	"del":          {(*conn).del, -2},
+	"exists":       {(*conn).exists, -2},
+	"keys":         {(*conn).keys, 2},
+	"scan":         {(*conn).scan, -2},
+	"mget":         {(*conn).mget, -2},
+	"mset":         {(*conn).mset, -3},
+	"incr":         {(*conn).incr, 2},
+	"decr":         {(*conn).decr, 2},
+	"incrby":       {(*conn).incrBy, 3},
+	"decrby":       {(*conn).decrBy, 3},
+	"expire":       {(*conn).expire, 3},
+	"ttl":          {(*conn).ttl, 2},
+	"subscribe":    {(*conn).subscribe, -2},
+	"unsubscribe":  {(*conn).unsubscribe, -1},
+	"psubscribe":   {(*conn).psubscribe, -2},
+	"punsubscribe": {(*conn).punsubscribe, -1},
+}
+
+// subscribedCommands are the only commands permitted to RESP2 clients which are subscribed to a channel.
+var subscribedCommands = map[string]bool{
+	"ping": true, "quit": true, "subscribe": true, "unsubscribe": true, "psubscribe": true, "punsubscribe": true,
+}
+
+// errorMessage returns the error reply standing for an error returned by the store.
+func errorMessage(err error) string {
+	if err == store.ErrorStoreFull {
+		return "OOM " + err.Error()
+	}
+	return "ERR " + err.Error()
+}
+
+// conn serves the commands sent on a connection in order.
+type conn struct {
+	*server
+	nc      net.Conn
+	r       respReader
+	closing bool // Set once the client asked to close the connection
+
+	mu       sync.Mutex // Protects the fields below, which are also used to write notifications
+	w        respWriter
+	channels map[string]struct{} // Channels subscribed to
+	patterns map[string]struct{} // Patterns of the channels subscribed to
+	watcher  *store.Watcher      // Receives the changes while subscribed, nil otherwise
+}
+
+// serve runs the commands sent on nc until it is closed.
+func (s *server) serve(nc net.Conn) {
+	c := &conn{
+		server:   s,
+		nc:       nc,
+		r:        respReader{r: bufio.NewReaderSize(nc, maxLineSize), maxArgSize: s.maxArgSize()},
+		w:        respWriter{w: bufio.NewWriter(nc), proto: 2},
+		channels: make(map[string]struct{}),
+		patterns: make(map[string]struct{}),
+	}
+	defer c.close()
+
+	for !c.closing {
+		args, err := c.r.readCommand()
+		if err == errArgTooLarge {
+			err = c.reply(func() { c.w.Error(errorMessage(store.ErrorValueSizeTooLarge)) })
+		} else if pe, ok := err.(protocolError); ok {
+			c.reply(func() { c.w.Error("ERR " + pe.Error()) })
+			return
+		} else if err == nil && len(args) > 0 {
+			err = c.reply(func() { c.run(args) })
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+// reply writes the reply of a command. The replies of pipelined commands are flushed together.
+func (c *conn) reply(write func()) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	write()
+	if c.r.r.Buffered() > 0 && !c.closing {
+		return nil
+	}
+	return c.w.Flush()
+}
+
+// run runs a command and writes its reply. The caller must hold the lock.
+func (c *conn) run(args [][]byte) {
+	name := strings.ToLower(string(args[0]))
+
+	cmd, ok := commands[name]
+	if !ok {
+		c.w.Error(fmt.Sprintf("ERR unknown command '%s'", args[0]))
+		return
+	}
+	if (cmd.arity > 0 && len(args) != cmd.arity) || len(args) < -cmd.arity {
+		c.w.Error(fmt.Sprintf("ERR wrong number of arguments for '%s' command", name))
+		return
+	}
+	if c.w.proto == 2 && c.subscriptions() > 0 && !subscribedCommands[name] {
+		c.w.Error(fmt.Sprintf("ERR Can't execute '%s': only (P)SUBSCRIBE / (P)UNSUBSCRIBE / PING / QUIT are allowed in this context", name))
+		return
+	}
+
+	cmd.run(c, args)
+}
+
+// close stops the notifications and closes the connection.
+func (c *conn) close() {
+	c.mu.Lock()
+	if c.watcher != nil {
+		c.watcher.Close()
+		c.watcher = nil
+	}
+	c.mu.Unlock()
+
+	c.nc.Close()
+}
+
+// maxArgSize returns the max size in bytes of an argument, larger arguments are refused before they are buffered.
+func (s *server) maxArgSize() int {
+	if s.store.MaxKeySize() > s.store.MaxValueSize() {
+		return s.store.MaxKeySize()
+	}
+	return s.store.MaxValueSize()
+}
+
+// saveCursor returns a new SCAN cursor standing for the next page starting at key.
+func (s *server) saveCursor(key string) uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastCursor++
+	s.cursors[s.lastCursor] = key
+	delete(s.cursors, s.lastCursor-maxCursors)
+
+	return s.lastCursor
+}
+
+// cursor returns the first key of the page of a SCAN cursor.
+func (s *server) cursor(id uint64) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok := s.cursors[id]
+	return key, ok
+}
+
+// Serve serves the redis protocol on the connections accepted by lis on top of the given store,
+// until lis is closed. Writes are answered once they are persisted to the transaction log, unless
+// configured otherwise.
+func Serve(lis net.Listener, st *store.Store, opts ...Option) error {
+	s := &server{store: st, cursors: make(map[uint64]string)}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	for {
+		nc, err := lis.Accept()
+		if err != nil {
+			return err
+		}
+		go s.serve(nc)
+	}
+}
+
+// Start the redis server on the given address.
+func Start(addr string, st *store.Store, opts ...Option) {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Fatalf("failed to listen on %s: %v", addr, err)
+	}
+
+	log.Fatal(Serve(lis, st, opts...))
+}
@@ -0,0 +1,403 @@
+package redisserver
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/shubham1172/gokv/config"
+	"github.com/shubham1172/gokv/internal/logger"
+	"github.com/shubham1172/gokv/pkg/store"
+	"io"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testClient sends commands to the redis server and reads its replies.
+type testClient struct {
+	t  *testing.T
+	nc net.Conn
+	br *bufio.Reader
+}
+
+// newTestServer serves the redis protocol on a local port, on top of a store whose changes are
+// persisted to a bolt logger publishing them to a hub. dial opens a connection to it.
+func newTestServer(t *testing.T) (dial func() *testClient, stop func()) {
+	hub := store.NewHub()
+	l, err := logger.NewBoltTransactionLogger(config.LoggingConfiguration{BoltFileName: filepath.Join(t.TempDir(), "transactions.db")}, logger.WithHub(hub))
+	if err != nil {
+		t.Fatalf("could not create logger: %v", err)
+	}
+	go l.Run()
+
+	st := store.New(store.WithMaxValueSize(32), store.WithCommitFunc(logger.CommitFunc(l)))
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	go Serve(lis, st, WithHub(hub))
+
+	var clients []*testClient
+	dial = func() *testClient {
+		nc, err := net.Dial("tcp", lis.Addr().String())
+		if err != nil {
+			t.Fatalf("could not dial: %v", err)
+		}
+		nc.SetDeadline(time.Now().Add(10 * time.Second))
+
+		c := &testClient{t: t, nc: nc, br: bufio.NewReader(nc)}
+		clients = append(clients, c)
+		return c
+	}
+
+	return dial, func() {
+		for _, c := range clients {
+			c.nc.Close()
+		}
+		lis.Close()
+		st.Close()
+		l.Stop()
+	}
+}
+
+// do sends a command as an array of bulk strings and returns its raw reply.
+func (c *testClient) do(args ...string) string {
+	cmd := "*" + strconv.Itoa(len(args)) + "\r\n"
+	for _, arg := range args {
+		cmd += "$" + strconv.Itoa(len(arg)) + "\r\n" + arg + "\r\n"
+	}
+	return c.doRaw(cmd)
+}
+
+// doRaw sends raw bytes and returns the raw reply which follows.
+func (c *testClient) doRaw(cmd string) string {
+	if _, err := io.WriteString(c.nc, cmd); err != nil {
+		c.t.Fatalf("could not send command: %v", err)
+	}
+	return c.read()
+}
+
+// read returns the next raw reply.
+func (c *testClient) read() string {
+	reply, err := readReply(c.br)
+	if err != nil {
+		c.t.Fatalf("could not read reply: %v", err)
+	}
+	return reply
+}
+
+// readReply reads a reply along with the elements of aggregates.
+func readReply(br *bufio.Reader) (string, error) {
+	line, err := br.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+
+	switch line[0] {
+	case '$':
+		n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+		if n < 0 {
+			return line, nil
+		}
+		b := make([]byte, n+2)
+		_, err := io.ReadFull(br, b)
+		return line + string(b), err
+	case '*', '%', '>':
+		n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+		if line[0] == '%' {
+			n *= 2
+		}
+		for i := 0; i < n; i++ {
+			elem, err := readReply(br)
+			if err != nil {
+				return "", err
+			}
+			line += elem
+		}
+	}
+	return line, nil
+}
+
+// bulks returns the raw reply of an array of bulk strings.
+func bulks(elems ...string) string {
+	s := "*" + strconv.Itoa(len(elems)) + "\r\n"
+	for _, e := range elems {
+		s += "$" + strconv.Itoa(len(e)) + "\r\n" + e + "\r\n"
+	}
+	return s
+}
+
+func TestCommands(t *testing.T) {
+	dial, stop := newTestServer(t)
+	defer stop()
+	c := dial()
+
+	testCases := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"PING"}, "+PONG\r\n"},
+		{[]string{"ping", "hello"}, "$5\r\nhello\r\n"},
+		{[]string{"ECHO", "hello"}, "$5\r\nhello\r\n"},
+		{[]string{"SELECT", "0"}, "+OK\r\n"},
+		{[]string{"SELECT", "1"}, "-" + messageInvalidDB + "\r\n"},
+		{[]string{"GET", "k1"}, "$-1\r\n"},
+		{[]string{"SET", "k1", "v1"}, "+OK\r\n"},
+		{[]string{"GET", "k1"}, "$2\r\nv1\r\n"},
+		{[]string{"SET", "k1", "v2", "NX"}, "$-1\r\n"},
+		{[]string{"SET", "k2", "v2", "XX"}, "$-1\r\n"},
+		{[]string{"SET", "k1", "v2", "xx"}, "+OK\r\n"},
+		{[]string{"SET", "k1", "v3", "NX", "XX"}, "-" + messageSyntaxError + "\r\n"},
+		{[]string{"SET", "k1", "v3", "EX"}, "-" + messageSyntaxError + "\r\n"},
+		{[]string{"SET", "k1", "v3", "EX", "0"}, "-ERR invalid expire time in 'set' command\r\n"},
+		{[]string{"SET", "k1", "v3", "EX", "ten"}, "-" + messageNotInteger + "\r\n"},
+		{[]string{"SET", "k1", strings.Repeat("v", 33)}, "-ERR Value size too large\r\n"},
+		{[]string{"SET", "k2", "v2", "EX", "100"}, "+OK\r\n"},
+		{[]string{"TTL", "k2"}, ":100\r\n"},
+		{[]string{"TTL", "k1"}, ":-1\r\n"},
+		{[]string{"TTL", "missing"}, ":-2\r\n"},
+		{[]string{"SET", "k2", "v2", "PX", "100000"}, "+OK\r\n"},
+		{[]string{"TTL", "k2"}, ":100\r\n"},
+		{[]string{"SET", "k2", "v2"}, "+OK\r\n"},
+		{[]string{"TTL", "k2"}, ":-1\r\n"},
+		{[]string{"EXPIRE", "k2", "50"}, ":1\r\n"},
+		{[]string{"TTL", "k2"}, ":50\r\n"},
+		{[]string{"GET", "k2"}, "$2\r\nv2\r\n"},
+		{[]string{"EXPIRE", "missing", "50"}, ":0\r\n"},
+		{[]string{"EXISTS", "k1", "k2", "missing", "k1"}, ":3\r\n"},
+		{[]string{"MGET", "k1", "missing", "k2"}, "*3\r\n$2\r\nv2\r\n$-1\r\n$2\r\nv2\r\n"},
+		{[]string{"MSET", "k3", "v3", "k4"}, "-ERR wrong number of arguments for 'mset' command\r\n"},
+		{[]string{"MSET", "k3", "v3", "k4", "v4"}, "+OK\r\n"},
+		{[]string{"KEYS", "*"}, bulks("k1", "k2", "k3", "k4")},
+		{[]string{"KEYS", "k[2-3]"}, bulks("k2", "k3")},
+		{[]string{"KEYS", "x*"}, "*0\r\n"},
+		{[]string{"DEL", "k3", "k4", "missing", "k3"}, ":2\r\n"},
+		{[]string{"DEL", "k3"}, ":0\r\n"},
+		{[]string{"EXPIRE", "k2", "0"}, ":1\r\n"},
+		{[]string{"EXISTS", "k2", "k3"}, ":0\r\n"},
+		{[]string{"INCR", "counter"}, ":1\r\n"},
+		{[]string{"INCRBY", "counter", "41"}, ":42\r\n"},
+		{[]string{"DECR", "counter"}, ":41\r\n"},
+		{[]string{"DECRBY", "counter", "50"}, ":-9\r\n"},
+		{[]string{"GET", "counter"}, "$2\r\n-9\r\n"},
+		{[]string{"INCR", "k1"}, "-" + messageNotInteger + "\r\n"},
+		{[]string{"SET", "counter", "9223372036854775807", "EX", "100"}, "+OK\r\n"},
+		{[]string{"INCR", "counter"}, "-" + messageOverflow + "\r\n"},
+		{[]string{"DECR", "counter"}, ":9223372036854775806\r\n"},
+		{[]string{"TTL", "counter"}, ":100\r\n"},
+		{[]string{"GET"}, "-ERR wrong number of arguments for 'get' command\r\n"},
+		{[]string{"FLUSHALL"}, "-ERR unknown command 'FLUSHALL'\r\n"},
+		{[]string{"SUBSCRIBE", "__keyspace@0__:k1"}, "*3\r\n$9\r\nsubscribe\r\n$17\r\n__keyspace@0__:k1\r\n:1\r\n"},
+	}
+
+	for _, tc := range testCases {
+		if got := c.do(tc.args...); got != tc.want {
+			t.Errorf("%v: expected reply %q, got %q instead", tc.args, tc.want, got)
+		}
+	}
+
+	// subscribed RESP2 clients can only manage their subscriptions
+	if got, want := c.do("GET", "k1"), "-ERR Can't execute 'get': only (P)SUBSCRIBE / (P)UNSUBSCRIBE / PING / QUIT are allowed in this context\r\n"; got != want {
+		t.Errorf("expected reply %q, got %q instead", want, got)
+	}
+	if got, want := c.do("PING"), bulks("pong", ""); got != want {
+		t.Errorf("expected reply %q, got %q instead", want, got)
+	}
+	if got, want := c.do("QUIT"), "+OK\r\n"; got != want {
+		t.Errorf("expected reply %q, got %q instead", want, got)
+	}
+	if _, err := c.br.ReadByte(); err != io.EOF {
+		t.Errorf("Expected err to be %v, got %v instead", io.EOF, err)
+	}
+}
+
+func TestProtocol(t *testing.T) {
+	dial, stop := newTestServer(t)
+	defer stop()
+
+	testCases := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{"inline", "SET k1 v1\r\nGET k1\n", []string{"+OK\r\n", "$2\r\nv1\r\n"}},
+		{"pipelined", "*1\r\n$4\r\nPING\r\n*2\r\n$3\r\nGET\r\n$2\r\nk1\r\n", []string{"+PONG\r\n", "$2\r\nv1\r\n"}},
+		{"empty line", "\r\nPING\r\n", []string{"+PONG\r\n"}},
+		{"argument too large", "*3\r\n$3\r\nSET\r\n$2\r\nk1\r\n$1025\r\n" + strings.Repeat("v", 1025) + "\r\nPING\r\n", []string{"-ERR Value size too large\r\n", "+PONG\r\n"}},
+		{"invalid bulk", "*1\r\n+PING\r\n", []string{"-ERR Protocol error: expected '$', got \"+PING\"\r\n"}},
+		{"invalid multibulk length", "*x\r\n", []string{"-ERR Protocol error: invalid multibulk length\r\n"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := dial()
+			if _, err := io.WriteString(c.nc, tc.input); err != nil {
+				t.Fatalf("could not send command: %v", err)
+			}
+			for _, want := range tc.want {
+				if got := c.read(); got != want {
+					t.Errorf("expected reply %q, got %q instead", want, got)
+				}
+			}
+		})
+	}
+
+	// the connection is closed after a protocol error
+	c := dial()
+	c.doRaw("*1\r\n+PING\r\n")
+	if _, err := c.br.ReadByte(); err != io.EOF {
+		t.Errorf("Expected err to be %v, got %v instead", io.EOF, err)
+	}
+}
+
+func TestHello(t *testing.T) {
+	dial, stop := newTestServer(t)
+	defer stop()
+	c := dial()
+
+	testCases := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"HELLO", "4"}, "-" + messageNoProto + "\r\n"},
+		{[]string{"GET", "k1"}, "$-1\r\n"},
+		{[]string{"HELLO", "3"}, "%5\r\n$6\r\nserver\r\n$4\r\ngokv\r\n$5\r\nproto\r\n:3\r\n$4\r\nmode\r\n$10\r\nstandalone\r\n$4\r\nrole\r\n$6\r\nmaster\r\n$7\r\nmodules\r\n*0\r\n"},
+		{[]string{"GET", "k1"}, "_\r\n"},
+		{[]string{"SUBSCRIBE", "__keyevent@0__:set"}, ">3\r\n$9\r\nsubscribe\r\n$18\r\n__keyevent@0__:set\r\n:1\r\n"},
+		// RESP3 clients keep running commands while subscribed
+		{[]string{"SET", "k1", "v1"}, "+OK\r\n>3\r\n$7\r\nmessage\r\n$18\r\n__keyevent@0__:set\r\n$2\r\nk1\r\n"},
+		{[]string{"HELLO", "2"}, "*10\r\n$6\r\nserver\r\n$4\r\ngokv\r\n$5\r\nproto\r\n:2\r\n$4\r\nmode\r\n$10\r\nstandalone\r\n$4\r\nrole\r\n$6\r\nmaster\r\n$7\r\nmodules\r\n*0\r\n"},
+	}
+
+	for _, tc := range testCases {
+		got := c.do(tc.args...)
+		// the notification of the set follows its reply
+		if strings.HasPrefix(got, "+OK") {
+			got += c.read()
+		}
+		if got != tc.want {
+			t.Errorf("%v: expected reply %q, got %q instead", tc.args, tc.want, got)
+		}
+	}
+}
+
+func TestScan(t *testing.T) {
+	dial, stop := newTestServer(t)
+	defer stop()
+	c := dial()
+
+	for i := 0; i < 25; i++ {
+		c.do("SET", fmt.Sprintf("k%02d", i), "v")
+	}
+	c.do("SET", "other", "v")
+
+	testCases := []struct {
+		name     string
+		args     []string
+		wantKeys int
+	}{
+		{"every key", []string{"COUNT", "10"}, 26},
+		{"match", []string{"MATCH", "k*", "COUNT", "7"}, 25},
+		{"match few", []string{"MATCH", "*1"}, 3},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cursor, keys := "0", 0
+			for i := 0; ; i++ {
+				reply := c.do(append([]string{"SCAN", cursor}, tc.args...)...)
+				lines := strings.Split(reply, "\r\n")
+				if lines[0] != "*2" {
+					t.Fatalf("expected a cursor and keys, got %q instead", reply)
+				}
+				cursor = lines[2]
+				n, _ := strconv.Atoi(strings.TrimPrefix(lines[3], "*"))
+				keys += n
+
+				if cursor == "0" || i > 30 {
+					break
+				}
+			}
+			if keys != tc.wantKeys {
+				t.Errorf("expected %d keys, got %d instead", tc.wantKeys, keys)
+			}
+		})
+	}
+
+	if got, want := c.do("SCAN", "12345"), "-"+messageInvalidCursor+"\r\n"; got != want {
+		t.Errorf("expected reply %q, got %q instead", want, got)
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	dial, stop := newTestServer(t)
+	defer stop()
+
+	sub, c := dial(), dial()
+
+	sub.do("SUBSCRIBE", "__keyspace@0__:a/1")
+	if got, want := sub.do("PSUBSCRIBE", "__keyevent@0__:*"), "*3\r\n$10\r\npsubscribe\r\n$16\r\n__keyevent@0__:*\r\n:2\r\n"; got != want {
+		t.Errorf("expected reply %q, got %q instead", want, got)
+	}
+
+	c.do("SET", "a/1", "v1")
+	c.do("DEL", "a/1")
+
+	want := []string{
+		bulks("message", "__keyspace@0__:a/1", "set"),
+		bulks("pmessage", "__keyevent@0__:*", "__keyevent@0__:set", "a/1"),
+		bulks("message", "__keyspace@0__:a/1", "del"),
+		bulks("pmessage", "__keyevent@0__:*", "__keyevent@0__:del", "a/1"),
+	}
+	for _, w := range want {
+		if got := sub.read(); got != w {
+			t.Errorf("expected notification %q, got %q instead", w, got)
+		}
+	}
+
+	if got, want := sub.do("UNSUBSCRIBE"), "*3\r\n$11\r\nunsubscribe\r\n$18\r\n__keyspace@0__:a/1\r\n:1\r\n"; got != want {
+		t.Errorf("expected reply %q, got %q instead", want, got)
+	}
+	if got, want := sub.do("PUNSUBSCRIBE"), "*3\r\n$12\r\npunsubscribe\r\n$16\r\n__keyevent@0__:*\r\n:0\r\n"; got != want {
+		t.Errorf("expected reply %q, got %q instead", want, got)
+	}
+
+	// no more notification is received once unsubscribed
+	c.do("SET", "a/1", "v2")
+	if got, want := sub.do("GET", "a/1"), "$2\r\nv2\r\n"; got != want {
+		t.Errorf("expected reply %q, got %q instead", want, got)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	testCases := []struct {
+		pattern string
+		s       string
+		want    bool
+	}{
+		{"*", "", true},
+		{"*", "a/b", true},
+		{"a*", "a/b", true},
+		{"a*c", "abbbc", true},
+		{"a*c", "abbbd", false},
+		{"a?c", "abc", true},
+		{"a?c", "ac", false},
+		{"a[bc]d", "acd", true},
+		{"a[^bc]d", "acd", false},
+		{"a[a-c]d", "abd", true},
+		{"a[c-a]d", "abd", true},
+		{`a\*`, "a*", true},
+		{`a\*`, "ab", false},
+		{"a**b", "ab", true},
+		{"abc", "abcd", false},
+	}
+
+	for _, tc := range testCases {
+		if got := match(tc.pattern, tc.s); got != tc.want {
+			t.Errorf("expected match(%q, %q) to be %v, got %v instead", tc.pattern, tc.s, tc.want, got)
+		}
+	}
+}
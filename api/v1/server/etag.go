@@ -0,0 +1,99 @@
+package server
+
+import (
+	"fmt"
+	"github.com/shubham1172/gokv/pkg/store"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// formatETag returns the entity tag of a version.
+func formatETag(version uint64) string {
+	return `"` + strconv.FormatUint(version, 10) + `"`
+}
+
+// parseETags parses a comma separated list of entity tags into versions.
+// A wildcard list is reported separately as it matches any existing key.
+// With weak, the weak entity tags such as W/"7" are read as the version they hold, since
+// If-None-Match compares them weakly. Otherwise they are refused, as If-Match requires strong ones.
+func parseETags(header string, weak bool) (versions []uint64, wildcard bool, err error) {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			wildcard = true
+			continue
+		}
+
+		if strings.HasPrefix(tag, "W/") {
+			if !weak {
+				return nil, false, fmt.Errorf("weak entity tag not allowed: %s", tag)
+			}
+			tag = tag[len("W/"):]
+		}
+
+		if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+			return nil, false, fmt.Errorf("invalid entity tag: %s", tag)
+		}
+
+		v, err := strconv.ParseUint(tag[1:len(tag)-1], 10, 64)
+		if err != nil {
+			return nil, false, fmt.Errorf("invalid entity tag: %s", tag)
+		}
+		versions = append(versions, v)
+	}
+
+	return versions, wildcard, nil
+}
+
+// matchETags returns a condition which is satisfied if the version of the key matches
+// any of the versions, or if the key exists for a wildcard.
+func matchETags(versions []uint64, wildcard bool) store.Condition {
+	return func(version uint64) bool {
+		if wildcard && version != 0 {
+			return true
+		}
+		for _, v := range versions {
+			if v == version && v != 0 {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// conditionFromRequest builds a store condition from the If-Match and If-None-Match headers of a request.
+// It returns a nil condition if neither of the headers is present.
+func conditionFromRequest(r *http.Request) (store.Condition, error) {
+	var conds []store.Condition
+
+	if h := r.Header.Get("If-Match"); h != "" {
+		versions, wildcard, err := parseETags(h, false)
+		if err != nil {
+			return nil, err
+		}
+		conds = append(conds, matchETags(versions, wildcard))
+	}
+
+	if h := r.Header.Get("If-None-Match"); h != "" {
+		versions, wildcard, err := parseETags(h, true)
+		if err != nil {
+			return nil, err
+		}
+		match := matchETags(versions, wildcard)
+		conds = append(conds, func(version uint64) bool { return !match(version) })
+	}
+
+	if len(conds) == 0 {
+		return nil, nil
+	}
+
+	return func(version uint64) bool {
+		for _, cond := range conds {
+			if !cond(version) {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
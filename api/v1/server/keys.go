@@ -0,0 +1,117 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"github.com/shubham1172/gokv/pkg/store"
+	"net/http"
+	"strconv"
+)
+
+const (
+	// defaultKeysLimit is the page size of GET /api/v1/keys if no limit is given.
+	defaultKeysLimit = 100
+	// maxKeysLimit is the max page size of GET /api/v1/keys.
+	maxKeysLimit = 1000
+)
+
+const messageInvalidLimit string = "Invalid limit, expected a number between 1 and 1000"
+const messageInvalidToken string = "Invalid continuation token"
+const messageTokenMismatch string = "Continuation token of a different prefix"
+
+// errInvalidToken is returned by decodeToken for a token which was not returned by encodeToken.
+var errInvalidToken = errors.New(messageInvalidToken)
+
+// keysResponse is the body returned by GET /api/v1/keys.
+type keysResponse struct {
+	// Keys in lexicographical order.
+	Keys []string `json:"keys"`
+	// Next is a continuation token to fetch the next page, empty on the last page.
+	Next string `json:"next,omitempty"`
+}
+
+// serves GET /api/v1/keys?prefix=&start=&limit=&continue=
+func (s *server) keysGetHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	prefix, start := q.Get("prefix"), q.Get("start")
+
+	limit := defaultKeysLimit
+	if l := q.Get("limit"); l != "" {
+		var err error
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit < 1 || limit > maxKeysLimit {
+			http.Error(w, messageInvalidLimit, http.StatusBadRequest)
+			return
+		}
+	}
+
+	// the token holds the first key of the next page, and is only valid for the prefix it was returned for
+	if token := q.Get("continue"); token != "" {
+		tokenPrefix, next, err := decodeToken(token)
+		if err != nil {
+			http.Error(w, messageInvalidToken, http.StatusBadRequest)
+			return
+		}
+		if tokenPrefix != prefix {
+			http.Error(w, messageTokenMismatch, http.StatusBadRequest)
+			return
+		}
+		start = next
+	}
+
+	if start < prefix {
+		start = prefix
+	}
+
+	end := ""
+	if prefix != "" {
+		end = store.PrefixEnd(prefix)
+	}
+
+	// fetch an extra pair to find out if there is a next page
+	kvs, err := s.store.Scan(start, end, limit+1)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	res := keysResponse{Keys: make([]string, 0, len(kvs))}
+	if len(kvs) > limit {
+		res.Next = encodeToken(prefix, kvs[limit].Key)
+		kvs = kvs[:limit]
+	}
+	for _, kv := range kvs {
+		res.Keys = append(res.Keys, kv.Key)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+// encodeToken returns a continuation token for the page of the keys with the given prefix starting at next.
+// The token holds the length of the prefix as a uvarint, followed by the prefix and next.
+func encodeToken(prefix, next string) string {
+	b := make([]byte, binary.MaxVarintLen64, binary.MaxVarintLen64+len(prefix)+len(next))
+	b = b[:binary.PutUvarint(b, uint64(len(prefix)))]
+	b = append(b, prefix...)
+	b = append(b, next...)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// decodeToken returns the prefix and the first key of the page of a continuation token returned by encodeToken.
+func decodeToken(token string) (string, string, error) {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return "", "", errInvalidToken
+	}
+
+	n, size := binary.Uvarint(b)
+	if size <= 0 || n > uint64(len(b)-size) {
+		return "", "", errInvalidToken
+	}
+	b = b[size:]
+
+	return string(b[:n]), string(b[n:]), nil
+}
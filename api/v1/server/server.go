@@ -4,23 +4,67 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/shubham1172/gokv/internal/logger"
 	"github.com/shubham1172/gokv/pkg/store"
+	"io"
 	"io/ioutil"
 	"log"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 const messageKeyNotFound string = "Key missing. Usage: /api/v1/key/:key"
 const messageValueNotFound string = "Value missing in the request body"
+const messageInvalidTTL string = "Invalid ttl, expected a positive duration such as 30s or 1h"
+
+// defaultMaxTxnSize is the max size in bytes of the body of a transaction if it is not configured.
+const defaultMaxTxnSize = 4 << 20
+
+// server holds the dependencies shared by the http handlers.
+type server struct {
+	store       *store.Store
+	logger      logger.TransactionLogger
+	asyncWrites bool       // Answer writes without waiting for the transaction log
+	maxTxnSize  int64      // Max size in bytes of the body of a transaction
+	hub         *store.Hub // Hub publishing the changes persisted to the transaction log, nil if watching is disabled
+}
+
+// Option configures the http server.
+type Option func(*server)
+
+// WithAsyncWrites answers writes without waiting for them to be persisted, see logger.Apply.
+func WithAsyncWrites() Option {
+	return func(s *server) {
+		s.asyncWrites = true
+	}
+}
+
+// WithMaxTxnSize sets the max size in bytes of the body of a transaction. A size <= 0 stands for the default.
+func WithMaxTxnSize(n int64) Option {
+	return func(s *server) {
+		if n > 0 {
+			s.maxTxnSize = n
+		}
+	}
+}
 
 // serves PUT /api/v1/key/{key}
-func keyPutHandler(w http.ResponseWriter, r *http.Request, l logger.TransactionLogger) {
+func (s *server) keyPutHandler(w http.ResponseWriter, r *http.Request) {
 	key := mux.Vars(r)["key"]
 	if key == "" {
 		http.Error(w, messageKeyNotFound, http.StatusBadRequest)
 		return
 	}
 
-	value, err := ioutil.ReadAll(r.Body)
+	// a body larger than a value is refused before it is buffered, at most one byte too many
+	// is read so that the store reports the value as too large
+	maxValueSize := int64(s.store.MaxValueSize())
+	if r.ContentLength > maxValueSize {
+		http.Error(w, store.ErrorValueSizeTooLarge.Error(), http.StatusBadRequest)
+		return
+	}
+
+	value, err := ioutil.ReadAll(io.LimitReader(r.Body, maxValueSize+1))
 	defer r.Body.Close()
 
 	if err != nil {
@@ -33,29 +77,53 @@ func keyPutHandler(w http.ResponseWriter, r *http.Request, l logger.TransactionL
 		return
 	}
 
-	err = store.Put(key, string(value))
+	cond, err := conditionFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var expiresAt time.Time
+	if ttl := r.URL.Query().Get("ttl"); ttl != "" {
+		d, err := time.ParseDuration(ttl)
+		if err != nil || d <= 0 {
+			http.Error(w, messageInvalidTTL, http.StatusBadRequest)
+			return
+		}
+		expiresAt = time.Now().Add(d)
+	}
+
+	versions, err := logger.Apply(s.store, []store.Op{
+		{Type: store.OpPut, Key: key, Value: value, ContentType: r.Header.Get("Content-Type"), ExpiresAt: expiresAt, Cond: cond},
+	}, s.asyncWrites)
 	if err != nil {
-		if err == store.ErrorKeySizeTooLarge || err == store.ErrorValueSizeTooLarge {
+		if err == logger.ErrorLogFailed {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		} else if err == store.ErrorKeySizeTooLarge || err == store.ErrorValueSizeTooLarge {
 			http.Error(w, err.Error(), http.StatusBadRequest)
+		} else if err == store.ErrorVersionMismatch {
+			http.Error(w, err.Error(), http.StatusPreconditionFailed)
+		} else if err == store.ErrorStoreFull {
+			http.Error(w, err.Error(), http.StatusInsufficientStorage)
 		} else {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 		}
 		return
 	}
 
-	l.WritePut(key, string(value))
+	w.Header().Set("ETag", formatETag(versions[0]))
 	w.WriteHeader(http.StatusCreated)
 }
 
 // serves GET /api/v1/key/{key}
-func keyGetHandler(w http.ResponseWriter, r *http.Request) {
+func (s *server) keyGetHandler(w http.ResponseWriter, r *http.Request) {
 	key := mux.Vars(r)["key"]
 	if key == "" {
 		http.Error(w, messageKeyNotFound, http.StatusBadRequest)
 		return
 	}
 
-	value, err := store.Get(key)
+	e, err := s.store.GetEntry(key)
 	if err != nil {
 		if err == store.ErrorKeyNotFound {
 			http.Error(w, err.Error(), http.StatusNotFound)
@@ -67,20 +135,40 @@ func keyGetHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.Write([]byte(value))
+	w.Header().Set("ETag", formatETag(e.Version))
+
+	if h := r.Header.Get("If-None-Match"); h != "" {
+		versions, wildcard, err := parseETags(h, true)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if matchETags(versions, wildcard)(e.Version) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	// the value is returned with the content type it was put with
+	if e.ContentType != "" {
+		w.Header().Set("Content-Type", e.ContentType)
+	}
+	w.Write(e.Value)
 }
 
-/// serves DELETE /api/v1/key/{key}
-func keyDeleteHandler(w http.ResponseWriter, r *http.Request, l logger.TransactionLogger) {
+// serves GET /api/v1/ttl/{key}
+func (s *server) ttlGetHandler(w http.ResponseWriter, r *http.Request) {
 	key := mux.Vars(r)["key"]
 	if key == "" {
 		http.Error(w, messageKeyNotFound, http.StatusBadRequest)
 		return
 	}
 
-	err := store.Delete(key)
+	ttl, err := s.store.TTL(key)
 	if err != nil {
-		if err == store.ErrorKeySizeTooLarge {
+		if err == store.ErrorKeyNotFound {
+			http.Error(w, err.Error(), http.StatusNotFound)
+		} else if err == store.ErrorKeySizeTooLarge {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 		} else {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -88,24 +176,70 @@ func keyDeleteHandler(w http.ResponseWriter, r *http.Request, l logger.Transacti
 		return
 	}
 
-	l.WriteDelete(key)
-	w.WriteHeader(http.StatusOK)
+	// remaining seconds rounded up, or -1 if the key never expires
+	seconds := int64(-1)
+	if ttl != store.NoExpiry {
+		seconds = int64(math.Ceil(ttl.Seconds()))
+	}
+
+	w.Write([]byte(strconv.FormatInt(seconds, 10)))
 }
 
-func wrapLogger(l logger.TransactionLogger, handler func(w http.ResponseWriter, r *http.Request, l logger.TransactionLogger)) func(w http.ResponseWriter, r *http.Request) {
-	return func(w http.ResponseWriter, r *http.Request) {
-		handler(w, r, l)
+// serves DELETE /api/v1/key/{key}
+func (s *server) keyDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	key := mux.Vars(r)["key"]
+	if key == "" {
+		http.Error(w, messageKeyNotFound, http.StatusBadRequest)
+		return
+	}
+
+	cond, err := conditionFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
+
+	_, err = logger.Apply(s.store, []store.Op{{Type: store.OpDelete, Key: key, Cond: cond}}, s.asyncWrites)
+	if err != nil {
+		if err == logger.ErrorLogFailed {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		} else if err == store.ErrorKeySizeTooLarge {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		} else if err == store.ErrorVersionMismatch {
+			http.Error(w, err.Error(), http.StatusPreconditionFailed)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
 }
 
-// Start the http server on the given address.
-func Start(addr string, l logger.TransactionLogger) {
+// NewRouter returns a router serving the gokv http api on top of the given store and logger.
+// Writes are answered once they are persisted to the logger, unless configured otherwise.
+func NewRouter(st *store.Store, l logger.TransactionLogger, opts ...Option) *mux.Router {
+	s := &server{store: st, logger: l, maxTxnSize: defaultMaxTxnSize}
+	for _, opt := range opts {
+		opt(s)
+	}
 	r := mux.NewRouter()
 
 	// register routes
-	r.HandleFunc("/api/v1/key/{key}", wrapLogger(l, keyPutHandler)).Methods("PUT")
-	r.HandleFunc("/api/v1/key/{key}", keyGetHandler).Methods("GET")
-	r.HandleFunc("/api/v1/key/{key}", wrapLogger(l, keyDeleteHandler)).Methods("DELETE")
+	r.HandleFunc("/api/v1/key/{key}", s.keyPutHandler).Methods("PUT")
+	r.HandleFunc("/api/v1/key/{key}", s.keyGetHandler).Methods("GET")
+	r.HandleFunc("/api/v1/key/{key}", s.keyDeleteHandler).Methods("DELETE")
+	r.HandleFunc("/api/v1/ttl/{key}", s.ttlGetHandler).Methods("GET")
+	r.HandleFunc("/api/v1/txn", s.txnHandler).Methods("POST")
+	r.HandleFunc("/api/v1/keys", s.keysGetHandler).Methods("GET")
+	r.HandleFunc("/api/v1/stats", s.statsGetHandler).Methods("GET")
+	r.HandleFunc("/api/v1/watch", s.watchHandler).Methods("GET")
+	r.HandleFunc("/api/v1/ws", s.wsHandler).Methods("GET")
+
+	return r
+}
 
-	log.Fatal(http.ListenAndServe(addr, r))
+// Start the http server on the given address.
+func Start(addr string, st *store.Store, l logger.TransactionLogger, opts ...Option) {
+	log.Fatal(http.ListenAndServe(addr, NewRouter(st, l, opts...)))
 }
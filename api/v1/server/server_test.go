@@ -1,25 +1,53 @@
 package server
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"github.com/shubham1172/gokv/config"
 	"github.com/shubham1172/gokv/internal/logger"
 	"github.com/shubham1172/gokv/pkg/store"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
-type dummyLogger struct{}
+// dummyLogger completes every write with err.
+type dummyLogger struct {
+	err error
+}
+
+func (d *dummyLogger) done() <-chan error {
+	done := make(chan error, 1)
+	done <- d.err
+	return done
+}
 
-func (d *dummyLogger) WriteDelete(key string)                          {}
-func (d *dummyLogger) WritePut(key, value string)                      {}
+func (d *dummyLogger) WriteDelete(key string) <-chan error            { return d.done() }
+func (d *dummyLogger) WritePut(key string, value []byte) <-chan error { return d.done() }
+func (d *dummyLogger) WritePutWithExpiry(key string, value []byte, expiresAt time.Time) <-chan error {
+	return d.done()
+}
+func (d *dummyLogger) WriteExpire(key string) <-chan error             { return d.done() }
+func (d *dummyLogger) WriteBatch(events []logger.Event) <-chan error   { return d.done() }
 func (d *dummyLogger) Err() <-chan error                               { return nil }
 func (d *dummyLogger) ReadEvents() (<-chan logger.Event, <-chan error) { return nil, nil }
 func (d *dummyLogger) Run()                                            {}
 func (d *dummyLogger) Stop()                                           {}
 
+func newTestServer() *server {
+	return &server{store: store.New(), logger: &dummyLogger{}, maxTxnSize: defaultMaxTxnSize}
+}
+
 func getALongString() string {
 	return strings.Repeat("a", 1025)
 }
@@ -38,6 +66,8 @@ func TestKeyPutHandler(t *testing.T) {
 		{"really long value", "testKeyPutHandlerKey2", getALongString(), http.StatusBadRequest},
 	}
 
+	s := newTestServer()
+
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			req, err := http.NewRequest("PUT", "localhost:8080/api/v1/key/"+tc.key, strings.NewReader(tc.value))
@@ -50,13 +80,56 @@ func TestKeyPutHandler(t *testing.T) {
 			})
 
 			rec := httptest.NewRecorder()
-			keyPutHandler(rec, req, &dummyLogger{})
+			s.keyPutHandler(rec, req)
+
+			res := rec.Result()
+			defer res.Body.Close()
+			if res.StatusCode != tc.statusCode {
+				t.Errorf("expected status %d, got %d instead", tc.statusCode, res.StatusCode)
+			}
+		})
+	}
+}
+
+func TestKeyPutHandlerTTL(t *testing.T) {
+	testCases := []struct {
+		name       string
+		ttl        string
+		statusCode int
+		expires    bool
+	}{
+		{"valid ttl", "10s", http.StatusCreated, true},
+		{"invalid ttl", "soon", http.StatusBadRequest, false},
+		{"negative ttl", "-1s", http.StatusBadRequest, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newTestServer()
+			key := "testKeyPutHandlerTTLKey1"
+
+			req, err := http.NewRequest("PUT", "localhost:8080/api/v1/key/"+key+"?ttl="+tc.ttl, strings.NewReader("value"))
+			if err != nil {
+				t.Fatalf("could not create request: %v", err)
+			}
+
+			req = mux.SetURLVars(req, map[string]string{
+				"key": key,
+			})
+
+			rec := httptest.NewRecorder()
+			s.keyPutHandler(rec, req)
 
 			res := rec.Result()
 			defer res.Body.Close()
 			if res.StatusCode != tc.statusCode {
 				t.Errorf("expected status %d, got %d instead", tc.statusCode, res.StatusCode)
 			}
+
+			ttl, err := s.store.TTL(key)
+			if tc.expires && (err != nil || ttl == store.NoExpiry) {
+				t.Errorf("expected key to expire, got ttl %v, err %v instead", ttl, err)
+			}
 		})
 	}
 }
@@ -74,7 +147,8 @@ func TestKeyGetHandler(t *testing.T) {
 		{"really long key", getALongString(), http.StatusBadRequest, ""},
 	}
 
-	store.Put("testKeyGetHandlerKey2", "testKeyGetHandlerValue2")
+	s := newTestServer()
+	s.store.Put("testKeyGetHandlerKey2", []byte("testKeyGetHandlerValue2"))
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
@@ -88,7 +162,7 @@ func TestKeyGetHandler(t *testing.T) {
 			})
 
 			rec := httptest.NewRecorder()
-			keyGetHandler(rec, req)
+			s.keyGetHandler(rec, req)
 
 			res := rec.Result()
 			defer res.Body.Close()
@@ -108,6 +182,52 @@ func TestKeyGetHandler(t *testing.T) {
 	}
 }
 
+func TestBinaryValues(t *testing.T) {
+	testCases := []struct {
+		name        string
+		value       []byte
+		contentType string
+	}{
+		{"binary value", []byte{0x00, 0xff, '\n', 0x80}, "application/octet-stream"},
+		{"json value", []byte(`{"a": 1}`), "application/json"},
+	}
+
+	s := newTestServer()
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest("PUT", "localhost:8080/api/v1/key/testBinaryValuesKey", bytes.NewReader(tc.value))
+			if err != nil {
+				t.Fatalf("could not create request: %v", err)
+			}
+			req.Header.Set("Content-Type", tc.contentType)
+			req = mux.SetURLVars(req, map[string]string{"key": "testBinaryValuesKey"})
+
+			rec := httptest.NewRecorder()
+			s.keyPutHandler(rec, req)
+			if rec.Code != http.StatusCreated {
+				t.Fatalf("expected status %d, got %d instead", http.StatusCreated, rec.Code)
+			}
+
+			req, err = http.NewRequest("GET", "localhost:8080/api/v1/key/testBinaryValuesKey", nil)
+			if err != nil {
+				t.Fatalf("could not create request: %v", err)
+			}
+			req = mux.SetURLVars(req, map[string]string{"key": "testBinaryValuesKey"})
+
+			rec = httptest.NewRecorder()
+			s.keyGetHandler(rec, req)
+
+			if !bytes.Equal(rec.Body.Bytes(), tc.value) {
+				t.Errorf("expected response %v, got %v instead", tc.value, rec.Body.Bytes())
+			}
+			if got := rec.Header().Get("Content-Type"); got != tc.contentType {
+				t.Errorf("expected content type %s, got %s instead", tc.contentType, got)
+			}
+		})
+	}
+}
+
 func TestKeyDeleteHandler(t *testing.T) {
 	testCases := []struct {
 		name       string
@@ -120,7 +240,8 @@ func TestKeyDeleteHandler(t *testing.T) {
 		{"really long key", getALongString(), http.StatusBadRequest},
 	}
 
-	store.Put("testKeyDeleteHandlerKey2", "testKeyDeleteHandlerValue2")
+	s := newTestServer()
+	s.store.Put("testKeyDeleteHandlerKey2", []byte("testKeyDeleteHandlerValue2"))
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
@@ -134,7 +255,116 @@ func TestKeyDeleteHandler(t *testing.T) {
 			})
 
 			rec := httptest.NewRecorder()
-			keyDeleteHandler(rec, req, &dummyLogger{})
+			s.keyDeleteHandler(rec, req)
+
+			res := rec.Result()
+			defer res.Body.Close()
+
+			if res.StatusCode != tc.statusCode {
+				t.Errorf("expected status %d, got %d instead", tc.statusCode, res.StatusCode)
+			}
+		})
+	}
+}
+
+func TestTTLGetHandler(t *testing.T) {
+	testCases := []struct {
+		name       string
+		key        string
+		statusCode int
+		resp       string
+	}{
+		{"missing key (URL)", "", http.StatusBadRequest, ""},
+		{"missing key (store)", "testTTLGetHandlerKey1", http.StatusNotFound, ""},
+		{"key without expiry", "testTTLGetHandlerKey2", http.StatusOK, "-1"},
+		{"key with expiry", "testTTLGetHandlerKey3", http.StatusOK, "60"},
+		{"really long key", getALongString(), http.StatusBadRequest, ""},
+	}
+
+	s := newTestServer()
+	s.store.Put("testTTLGetHandlerKey2", []byte("testTTLGetHandlerValue2"))
+	s.store.PutWithTTL("testTTLGetHandlerKey3", []byte("testTTLGetHandlerValue3"), time.Minute)
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", "localhost:8080/api/v1/ttl/"+tc.key, nil)
+			if err != nil {
+				t.Fatalf("could not create request: %v", err)
+			}
+
+			req = mux.SetURLVars(req, map[string]string{
+				"key": tc.key,
+			})
+
+			rec := httptest.NewRecorder()
+			s.ttlGetHandler(rec, req)
+
+			res := rec.Result()
+			defer res.Body.Close()
+
+			b, err := ioutil.ReadAll(res.Body)
+			if err != nil {
+				t.Fatalf("could not read response: %v", err)
+			}
+
+			if res.StatusCode != tc.statusCode {
+				t.Errorf("expected status %d, got %d instead", tc.statusCode, res.StatusCode)
+			}
+			if tc.resp != "" && string(b) != tc.resp {
+				t.Errorf("expected response %s, got %s instead", tc.resp, string(b))
+			}
+		})
+	}
+}
+
+func TestConditionalRequests(t *testing.T) {
+	s := newTestServer()
+	version, _ := s.store.PutIfAbsent("testConditionalKey1", []byte("testConditionalValue1"))
+	etag := formatETag(version)
+
+	testCases := []struct {
+		name       string
+		method     string
+		key        string
+		header     string
+		etag       string
+		statusCode int
+	}{
+		{"get returns not modified", "GET", "testConditionalKey1", "If-None-Match", etag, http.StatusNotModified},
+		{"get with stale etag", "GET", "testConditionalKey1", "If-None-Match", `"0"`, http.StatusOK},
+		{"get with weak etag", "GET", "testConditionalKey1", "If-None-Match", `"0", W/` + etag, http.StatusNotModified},
+		{"put with weak etag", "PUT", "testConditionalKey1", "If-Match", "W/" + etag, http.StatusBadRequest},
+		{"put with invalid etag", "PUT", "testConditionalKey1", "If-Match", "abc", http.StatusBadRequest},
+		{"put with stale etag", "PUT", "testConditionalKey1", "If-Match", formatETag(version + 1), http.StatusPreconditionFailed},
+		{"put if absent on existing key", "PUT", "testConditionalKey1", "If-None-Match", "*", http.StatusPreconditionFailed},
+		{"put if absent on missing key", "PUT", "testConditionalKey2", "If-None-Match", "*", http.StatusCreated},
+		{"put if present on missing key", "PUT", "testConditionalKey3", "If-Match", "*", http.StatusPreconditionFailed},
+		{"put with current etag", "PUT", "testConditionalKey1", "If-Match", etag, http.StatusCreated},
+		{"put with replaced etag", "PUT", "testConditionalKey1", "If-Match", etag, http.StatusPreconditionFailed},
+		{"delete with stale etag", "DELETE", "testConditionalKey1", "If-Match", etag, http.StatusPreconditionFailed},
+		{"delete if present", "DELETE", "testConditionalKey1", "If-Match", "*", http.StatusOK},
+	}
+
+	handlers := map[string]http.HandlerFunc{
+		"GET":    s.keyGetHandler,
+		"PUT":    s.keyPutHandler,
+		"DELETE": s.keyDeleteHandler,
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(tc.method, "localhost:8080/api/v1/key/"+tc.key, strings.NewReader("value"))
+			if err != nil {
+				t.Fatalf("could not create request: %v", err)
+			}
+
+			req.Header.Set(tc.header, tc.etag)
+			req = mux.SetURLVars(req, map[string]string{
+				"key": tc.key,
+			})
+
+			rec := httptest.NewRecorder()
+			handlers[tc.method](rec, req)
 
 			res := rec.Result()
 			defer res.Body.Close()
@@ -142,6 +372,583 @@ func TestKeyDeleteHandler(t *testing.T) {
 			if res.StatusCode != tc.statusCode {
 				t.Errorf("expected status %d, got %d instead", tc.statusCode, res.StatusCode)
 			}
+			if res.StatusCode == http.StatusCreated && res.Header.Get("ETag") == "" {
+				t.Errorf("expected an ETag in the response")
+			}
 		})
 	}
 }
+
+func TestTxnHandler(t *testing.T) {
+	testCases := []struct {
+		name       string
+		body       string
+		statusCode int
+		resp       string
+	}{
+		{"invalid body", `{"ops": [`, http.StatusBadRequest, ""},
+		{"missing operations", `{"ops": []}`, http.StatusBadRequest, ""},
+		{"missing key", `{"ops": [{"op": "put", "value": "dmFsdWUx"}]}`, http.StatusBadRequest, ""},
+		{"invalid op", `{"ops": [{"op": "get", "key": "testTxnHandlerKey1"}]}`, http.StatusBadRequest, ""},
+		{"missing value", `{"ops": [{"op": "put", "key": "testTxnHandlerKey1"}]}`, http.StatusBadRequest, "value missing in operation 0\n"},
+		{"empty value", `{"ops": [{"op": "delete", "key": "testTxnHandlerKey3"}, {"op": "put", "key": "testTxnHandlerKey1", "value": ""}]}`, http.StatusBadRequest, "value missing in operation 1\n"},
+		{"invalid ttl", `{"ops": [{"op": "put", "key": "testTxnHandlerKey1", "value": "dmFsdWUx", "ttl": "soon"}]}`, http.StatusBadRequest, ""},
+		{"value not in base64", `{"ops": [{"op": "put", "key": "testTxnHandlerKey1", "value": "value1"}]}`, http.StatusBadRequest, ""},
+		{"really long value", `{"ops": [{"op": "put", "key": "testTxnHandlerKey1", "value": "` + base64.StdEncoding.EncodeToString([]byte(getALongString())) + `"}]}`, http.StatusBadRequest, ""},
+		{"version mismatch", `{"ops": [{"op": "delete", "key": "testTxnHandlerKey2", "version": 0}]}`, http.StatusPreconditionFailed, ""},
+		{"valid request", `{"ops": [{"op": "put", "key": "testTxnHandlerKey1", "value": "dmFsdWUx", "version": 0}, {"op": "delete", "key": "testTxnHandlerKey2"}]}`, http.StatusOK, `{"versions":[2,0]}` + "\n"},
+	}
+
+	s := newTestServer()
+	s.store.Put("testTxnHandlerKey2", []byte("testTxnHandlerValue2"))
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest("POST", "localhost:8080/api/v1/txn", strings.NewReader(tc.body))
+			if err != nil {
+				t.Fatalf("could not create request: %v", err)
+			}
+
+			rec := httptest.NewRecorder()
+			s.txnHandler(rec, req)
+
+			res := rec.Result()
+			defer res.Body.Close()
+
+			b, err := ioutil.ReadAll(res.Body)
+			if err != nil {
+				t.Fatalf("could not read response: %v", err)
+			}
+
+			if res.StatusCode != tc.statusCode {
+				t.Errorf("expected status %d, got %d instead", tc.statusCode, res.StatusCode)
+			}
+			if tc.resp != "" && string(b) != tc.resp {
+				t.Errorf("expected response %s, got %s instead", tc.resp, string(b))
+			}
+		})
+	}
+
+	if _, err := s.store.Get("testTxnHandlerKey2"); err != store.ErrorKeyNotFound {
+		t.Errorf("expected testTxnHandlerKey2 to be deleted, got %v instead", err)
+	}
+}
+
+func TestTxnHandlerBinaryValue(t *testing.T) {
+	r := NewRouter(store.New(), &dummyLogger{})
+	value := []byte{0xff, 0xfe, 'a', 0x00, 0xc3}
+
+	body := `{"ops": [{"op": "put", "key": "testTxnBinaryKey", "value": "` + base64.StdEncoding.EncodeToString(value) + `"}]}`
+	req := httptest.NewRequest("POST", "/api/v1/txn", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d instead", http.StatusOK, rec.Code)
+	}
+
+	// the bytes which are not valid UTF-8 are read back as they were put
+	req = httptest.NewRequest("GET", "/api/v1/key/testTxnBinaryKey", nil)
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || !bytes.Equal(rec.Body.Bytes(), value) {
+		t.Errorf("expected value %q, got %q with status %d instead", value, rec.Body.Bytes(), rec.Code)
+	}
+}
+
+func TestKeysGetHandler(t *testing.T) {
+	s := newTestServer()
+	for _, k := range []string{"a", "b/1", "b/2", "b/3", "b/4", "c"} {
+		s.store.Put(k, []byte("value"))
+	}
+
+	// get fetches a page and decodes the response.
+	get := func(t *testing.T, query string) (int, keysResponse) {
+		req, err := http.NewRequest("GET", "localhost:8080/api/v1/keys?"+query, nil)
+		if err != nil {
+			t.Fatalf("could not create request: %v", err)
+		}
+
+		rec := httptest.NewRecorder()
+		s.keysGetHandler(rec, req)
+
+		res := rec.Result()
+		defer res.Body.Close()
+
+		var body keysResponse
+		if res.StatusCode == http.StatusOK {
+			if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+				t.Fatalf("could not decode response: %v", err)
+			}
+		}
+		return res.StatusCode, body
+	}
+
+	testCases := []struct {
+		name       string
+		query      string
+		statusCode int
+		keys       []string
+	}{
+		{"all keys", "", http.StatusOK, []string{"a", "b/1", "b/2", "b/3", "b/4", "c"}},
+		{"prefix", "prefix=b/", http.StatusOK, []string{"b/1", "b/2", "b/3", "b/4"}},
+		{"prefix and start", "prefix=b/&start=b/3", http.StatusOK, []string{"b/3", "b/4"}},
+		{"start before prefix", "prefix=b/&start=a", http.StatusOK, []string{"b/1", "b/2", "b/3", "b/4"}},
+		{"no match", "prefix=d", http.StatusOK, []string{}},
+		{"invalid limit", "limit=0", http.StatusBadRequest, nil},
+		{"invalid token", "continue=%25", http.StatusBadRequest, nil},
+		{"truncated token", "continue=" + encodeToken("b/", "b/3")[:2], http.StatusBadRequest, nil},
+		{"token", "prefix=b/&continue=" + encodeToken("b/", "b/3"), http.StatusOK, []string{"b/3", "b/4"}},
+		{"token of another prefix", "prefix=a&continue=" + encodeToken("b/", "b/3"), http.StatusBadRequest, nil},
+		{"token without its prefix", "continue=" + encodeToken("b/", "b/3"), http.StatusBadRequest, nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			statusCode, body := get(t, tc.query)
+			if statusCode != tc.statusCode {
+				t.Errorf("expected status %d, got %d instead", tc.statusCode, statusCode)
+			}
+			if statusCode == http.StatusOK && !reflect.DeepEqual(body.Keys, tc.keys) {
+				t.Errorf("expected keys %v, got %v instead", tc.keys, body.Keys)
+			}
+		})
+	}
+
+	t.Run("pagination", func(t *testing.T) {
+		var keys []string
+		query := "prefix=b/&limit=3"
+
+		for pages := 0; ; pages++ {
+			if pages == 3 {
+				t.Fatalf("expected 2 pages, got more")
+			}
+
+			_, body := get(t, query)
+			keys = append(keys, body.Keys...)
+			if body.Next == "" {
+				break
+			}
+			query = "prefix=b/&limit=3&continue=" + body.Next
+		}
+
+		want := []string{"b/1", "b/2", "b/3", "b/4"}
+		if !reflect.DeepEqual(keys, want) {
+			t.Errorf("expected keys %v, got %v instead", want, keys)
+		}
+	})
+}
+
+func TestWriteAhead(t *testing.T) {
+	errLog := errors.New("disk full")
+
+	testCases := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		err        error
+		opts       []Option
+		statusCode int
+		value      string // value of the key once the request is answered, not checked if empty
+	}{
+		{"put persisted", "PUT", "/api/v1/key/testWriteAheadKey", "value", nil, nil, http.StatusCreated, "value"},
+		{"put not persisted", "PUT", "/api/v1/key/testWriteAheadKey", "value", errLog, nil, http.StatusServiceUnavailable, "old"},
+		{"put not persisted with async writes", "PUT", "/api/v1/key/testWriteAheadKey", "value", errLog, []Option{WithAsyncWrites()}, http.StatusCreated, ""},
+		{"delete not persisted", "DELETE", "/api/v1/key/testWriteAheadKey", "", errLog, nil, http.StatusServiceUnavailable, "old"},
+		{"txn not persisted", "POST", "/api/v1/txn", `{"ops": [{"op": "delete", "key": "testWriteAheadKey"}]}`, errLog, nil, http.StatusServiceUnavailable, "old"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			l := &dummyLogger{err: tc.err}
+			s := store.New()
+			s.Put("testWriteAheadKey", []byte("old"))
+			s.SetCommitFunc(logger.CommitFunc(l))
+			r := NewRouter(s, l, tc.opts...)
+
+			req, err := http.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+			if err != nil {
+				t.Fatalf("could not create request: %v", err)
+			}
+
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+
+			if rec.Code != tc.statusCode {
+				t.Errorf("expected status %d, got %d instead", tc.statusCode, rec.Code)
+			}
+
+			// a change which is not persisted is undone before it is answered
+			if v, _ := s.Get("testWriteAheadKey"); tc.value != "" && string(v) != tc.value {
+				t.Errorf("expected value %q, got %q instead", tc.value, v)
+			}
+		})
+	}
+}
+
+func TestStatsGetHandler(t *testing.T) {
+	s := &server{store: store.New(store.WithMaxKeys(1), store.WithEvictionPolicy(store.EvictLRU)), logger: &dummyLogger{}}
+	s.store.Put("a", []byte("value"))
+	s.store.Put("b", []byte("value"))
+
+	req, err := http.NewRequest("GET", "localhost:8080/api/v1/stats", nil)
+	if err != nil {
+		t.Fatalf("could not create request: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	s.statsGetHandler(rec, req)
+
+	res := rec.Result()
+	defer res.Body.Close()
+
+	var body statsResponse
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		t.Fatalf("could not decode response: %v", err)
+	}
+	if want := (statsResponse{Keys: 1, Evictions: 1}); body != want {
+		t.Errorf("expected stats %+v, got %+v instead", want, body)
+	}
+}
+
+func TestStoreFull(t *testing.T) {
+	s := &server{store: store.New(store.WithMaxKeys(1), store.WithEvictionPolicy(store.EvictNone)), logger: &dummyLogger{}}
+	s.store.Put("a", []byte("value"))
+
+	req, err := http.NewRequest("PUT", "localhost:8080/api/v1/key/b", strings.NewReader("value"))
+	if err != nil {
+		t.Fatalf("could not create request: %v", err)
+	}
+	req = mux.SetURLVars(req, map[string]string{"key": "b"})
+
+	rec := httptest.NewRecorder()
+	s.keyPutHandler(rec, req)
+
+	res := rec.Result()
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusInsufficientStorage {
+		t.Errorf("expected status %d, got %d instead", http.StatusInsufficientStorage, res.StatusCode)
+	}
+}
+
+func TestRequestSizeLimits(t *testing.T) {
+	s := &server{
+		store:      store.New(store.WithMaxKeySize(4096), store.WithMaxValueSize(2<<20)),
+		logger:     &dummyLogger{},
+		maxTxnSize: 1024,
+	}
+
+	testCases := []struct {
+		name       string
+		method     string
+		body       string
+		statusCode int
+	}{
+		{"large value", "PUT", strings.Repeat("a", 2<<20), http.StatusCreated},
+		{"value too large", "PUT", strings.Repeat("a", 2<<20+1), http.StatusBadRequest},
+		{"transaction", "POST", `{"ops": [{"op": "put", "key": "` + strings.Repeat("a", 900) + `", "value": "dmFsdWUx"}]}`, http.StatusOK},
+		{"transaction too large", "POST", `{"ops": [{"op": "put", "key": "testKey1", "value": "` + strings.Repeat("a", 1024) + `"}]}`, http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+
+			if tc.method == "PUT" {
+				req, err := http.NewRequest("PUT", "localhost:8080/api/v1/key/testKey1", strings.NewReader(tc.body))
+				if err != nil {
+					t.Fatalf("could not create request: %v", err)
+				}
+				s.keyPutHandler(rec, mux.SetURLVars(req, map[string]string{"key": "testKey1"}))
+			} else {
+				req, err := http.NewRequest("POST", "localhost:8080/api/v1/txn", strings.NewReader(tc.body))
+				if err != nil {
+					t.Fatalf("could not create request: %v", err)
+				}
+				// the length of the body is unknown, so that it is only found out to be too large while reading
+				req.ContentLength = -1
+				s.txnHandler(rec, req)
+			}
+
+			res := rec.Result()
+			defer res.Body.Close()
+			if res.StatusCode != tc.statusCode {
+				t.Errorf("expected status %d, got %d instead", tc.statusCode, res.StatusCode)
+			}
+		})
+	}
+}
+
+// sseEvent is an event read from a stream of server-sent events.
+type sseEvent struct {
+	id, event string
+	data      watchEvent
+}
+
+// readEvent reads the next event from a stream of server-sent events, skipping comments.
+func readEvent(t *testing.T, br *bufio.Reader) sseEvent {
+	var e sseEvent
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			t.Fatalf("could not read event: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+
+		switch {
+		case line == "" && e.event != "":
+			return e
+		case strings.HasPrefix(line, "id: "):
+			e.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			e.event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &e.data); err != nil {
+				t.Fatalf("could not decode event: %v", err)
+			}
+		}
+	}
+}
+
+// newWatchedServer runs a server on top of a store logged to a bolt logger which publishes the changes to a hub.
+// The returned function stops the server, the store and the logger.
+func newWatchedServer(t *testing.T) (*store.Store, logger.TransactionLogger, *httptest.Server, func()) {
+	hub := store.NewHub()
+	l, err := logger.NewBoltTransactionLogger(config.LoggingConfiguration{BoltFileName: filepath.Join(t.TempDir(), "transactions.db")}, logger.WithHub(hub))
+	if err != nil {
+		t.Fatalf("could not create logger: %v", err)
+	}
+	go l.Run()
+
+	st := store.New(store.WithCommitFunc(logger.CommitFunc(l)))
+	srv := httptest.NewServer(NewRouter(st, l, WithHub(hub)))
+
+	return st, l, srv, func() {
+		srv.Close()
+		st.Close()
+		l.Stop()
+	}
+}
+
+func TestWatchHandler(t *testing.T) {
+	st, l, srv, stop := newWatchedServer(t)
+	defer stop()
+
+	put := func(key, value string) {
+		_, done, err := st.Apply([]store.Op{{Type: store.OpPut, Key: key, Value: []byte(value), ContentType: "text/plain"}})
+		if err != nil {
+			t.Fatalf("Expected err to be %v, got %v instead", nil, err)
+		}
+		if err := <-done; err != nil {
+			t.Fatalf("Expected err to be %v, got %v instead", nil, err)
+		}
+	}
+
+	watch := func(query string, header http.Header) *http.Response {
+		req, err := http.NewRequest("GET", srv.URL+"/api/v1/watch?"+query, nil)
+		if err != nil {
+			t.Fatalf("could not create request: %v", err)
+		}
+		for k, v := range header {
+			req.Header[k] = v
+		}
+
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("could not send request: %v", err)
+		}
+		return res
+	}
+
+	put("a/1", "value1")
+
+	res := watch("prefix=a/&since=0", nil)
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected status %d, got %d instead", http.StatusOK, res.StatusCode)
+	}
+	if ct := res.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("expected content type %s, got %s instead", "text/event-stream", ct)
+	}
+	br := bufio.NewReader(res.Body)
+
+	// the put before the request is read back from the log, the changes outside of the prefix are skipped
+	first := readEvent(t, br)
+	if first.event != "put" || first.data.Key != "a/1" || string(first.data.Value) != "value1" || first.data.ContentType != "text/plain" {
+		t.Errorf("expected a put of a/1, got %+v instead", first)
+	}
+
+	put("b/1", "value2")
+	put("a/2", "value3")
+	if err := st.Delete("a/1"); err != nil {
+		t.Fatalf("Expected err to be %v, got %v instead", nil, err)
+	}
+
+	for _, want := range []struct{ event, key string }{{"put", "a/2"}, {"delete", "a/1"}} {
+		got := readEvent(t, br)
+		if got.event != want.event || got.data.Key != want.key {
+			t.Errorf("expected a %s of %s, got %+v instead", want.event, want.key, got)
+		}
+	}
+
+	t.Run("resume", func(t *testing.T) {
+		res := watch("prefix=a/", http.Header{"Last-Event-Id": {first.id}})
+		defer res.Body.Close()
+
+		got := readEvent(t, bufio.NewReader(res.Body))
+		if got.event != "put" || got.data.Key != "a/2" {
+			t.Errorf("expected a put of a/2, got %+v instead", got)
+		}
+	})
+
+	t.Run("compacted", func(t *testing.T) {
+		truncate(t, l)
+
+		res := watch("prefix=a/", http.Header{"Last-Event-Id": {first.id}})
+		defer res.Body.Close()
+
+		if res.StatusCode != http.StatusGone {
+			t.Errorf("expected status %d, got %d instead", http.StatusGone, res.StatusCode)
+		}
+	})
+
+	t.Run("invalid sequence", func(t *testing.T) {
+		res := watch("since=abc", nil)
+		defer res.Body.Close()
+
+		if res.StatusCode != http.StatusBadRequest {
+			t.Errorf("expected status %d, got %d instead", http.StatusBadRequest, res.StatusCode)
+		}
+	})
+
+	t.Run("watching disabled", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		newTestServer().watchHandler(rec, httptest.NewRequest("GET", "/api/v1/watch", nil))
+
+		if rec.Code != http.StatusNotImplemented {
+			t.Errorf("expected status %d, got %d instead", http.StatusNotImplemented, rec.Code)
+		}
+	})
+}
+
+func TestWsHandler(t *testing.T) {
+	_, l, srv, stop := newWatchedServer(t)
+	defer stop()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/api/v1/ws", nil)
+	if err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+	defer conn.Close()
+
+	read := func() wsMessage {
+		var m wsMessage
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if err := conn.ReadJSON(&m); err != nil {
+			t.Fatalf("could not read message: %v", err)
+		}
+		return m
+	}
+
+	testCases := []struct {
+		name    string
+		command string
+		want    wsMessage
+	}{
+		{"put", `{"id": "1", "op": "put", "key": "a/1", "value": "dmFsdWUx", "content_type": "text/plain"}`,
+			wsMessage{ID: "1", Status: http.StatusCreated, Key: "a/1", Version: 1}},
+		{"get", `{"id": "2", "op": "get", "key": "a/1"}`,
+			wsMessage{ID: "2", Status: http.StatusOK, Key: "a/1", Value: []byte("value1"), ContentType: "text/plain", Version: 1}},
+		{"get missing key", `{"id": "3", "op": "get", "key": "a/2"}`,
+			wsMessage{ID: "3", Status: http.StatusNotFound, Error: store.ErrorKeyNotFound.Error()}},
+		{"delete version mismatch", `{"id": "4", "op": "delete", "key": "a/1", "version": 42}`,
+			wsMessage{ID: "4", Status: http.StatusPreconditionFailed, Error: store.ErrorVersionMismatch.Error()}},
+		{"put without key", `{"id": "5", "op": "put", "value": "dmFsdWUx"}`,
+			wsMessage{ID: "5", Status: http.StatusBadRequest, Error: messageWsKeyMissing}},
+		{"invalid op", `{"id": "6", "op": "incr", "key": "a/1"}`,
+			wsMessage{ID: "6", Status: http.StatusBadRequest, Error: messageWsInvalidOp}},
+		{"invalid command", `not json`,
+			wsMessage{Status: http.StatusBadRequest, Error: messageWsInvalidCommand}},
+		{"unwatch unknown watch", `{"id": "7", "op": "unwatch"}`,
+			wsMessage{ID: "7", Status: http.StatusNotFound, Error: messageWsWatchNotFound}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := conn.WriteMessage(websocket.TextMessage, []byte(tc.command)); err != nil {
+				t.Fatalf("could not write command: %v", err)
+			}
+			if got := read(); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("expected message %+v, got %+v instead", tc.want, got)
+			}
+		})
+	}
+
+	t.Run("watch", func(t *testing.T) {
+		commands := []wsCommand{
+			{ID: "w", Op: "watch", Prefix: "a/", Since: new(uint64)},
+			{ID: "8", Op: "put", Key: "b/1", Value: []byte("value2")},
+			{ID: "9", Op: "delete", Key: "a/1"},
+		}
+		for _, cmd := range commands {
+			if err := conn.WriteJSON(cmd); err != nil {
+				t.Fatalf("could not write command: %v", err)
+			}
+		}
+
+		// the put from the log, then the delete, are pushed to the watch along with the responses
+		var events []string
+		statuses := map[string]int{}
+		for len(events) < 2 || len(statuses) < 3 {
+			m := read()
+			if m.Event != "" {
+				if m.ID != "w" {
+					t.Errorf("expected the change to be pushed to watch w, got %s instead", m.ID)
+				}
+				events = append(events, m.Event+" "+m.Key)
+			} else {
+				statuses[m.ID] = m.Status
+			}
+		}
+
+		if want := []string{"put a/1", "delete a/1"}; !reflect.DeepEqual(events, want) {
+			t.Errorf("expected changes %v, got %v instead", want, events)
+		}
+		if want := map[string]int{"w": http.StatusOK, "8": http.StatusCreated, "9": http.StatusOK}; !reflect.DeepEqual(statuses, want) {
+			t.Errorf("expected statuses %v, got %v instead", want, statuses)
+		}
+
+		if err := conn.WriteJSON(wsCommand{ID: "w", Op: "unwatch"}); err != nil {
+			t.Fatalf("could not write command: %v", err)
+		}
+		if m := read(); m.ID != "w" || m.Status != http.StatusOK {
+			t.Errorf("expected the watch to be stopped, got %+v instead", m)
+		}
+	})
+
+	t.Run("watch compacted", func(t *testing.T) {
+		truncate(t, l)
+
+		if err := conn.WriteJSON(wsCommand{ID: "w", Op: "watch", Since: new(uint64)}); err != nil {
+			t.Fatalf("could not write command: %v", err)
+		}
+		if m := read(); m.ID != "w" || m.Status != http.StatusOK {
+			t.Errorf("expected the watch to be acknowledged, got %+v instead", m)
+		}
+		want := wsMessage{ID: "w", Status: http.StatusGone, Error: messageCompacted}
+		if got := read(); !reflect.DeepEqual(got, want) {
+			t.Errorf("expected message %+v, got %+v instead", want, got)
+		}
+	})
+}
+
+// truncate removes every event from the transaction log, as a snapshot does.
+func truncate(t *testing.T, l logger.TransactionLogger) {
+	seq, err := l.(logger.Truncater).LastSequence()
+	if err != nil {
+		t.Fatalf("Expected err to be %v, got %v instead", nil, err)
+	}
+	if err := l.(logger.Truncater).Truncate(seq); err != nil {
+		t.Fatalf("Expected err to be %v, got %v instead", nil, err)
+	}
+}
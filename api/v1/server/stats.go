@@ -0,0 +1,20 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// statsResponse is the body returned by GET /api/v1/stats.
+type statsResponse struct {
+	// Keys is the number of keys in the store, including expired keys yet to be removed.
+	Keys int `json:"keys"`
+	// Evictions is the number of keys evicted since the store was created.
+	Evictions uint64 `json:"evictions"`
+}
+
+// serves GET /api/v1/stats
+func (s *server) statsGetHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(statsResponse{Keys: s.store.Len(), Evictions: s.store.Evictions()})
+}
@@ -0,0 +1,139 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/shubham1172/gokv/internal/logger"
+	"github.com/shubham1172/gokv/pkg/store"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+const messageTxnEmpty string = "Operations missing in the request body"
+const messageTxnTooLarge string = "Request body too large"
+
+// txnRequest is the body of POST /api/v1/txn.
+type txnRequest struct {
+	Ops []txnOp `json:"ops"`
+}
+
+// txnOp is a single operation of a txnRequest.
+type txnOp struct {
+	// Op is either "put" or "delete".
+	Op  string `json:"op"`
+	Key string `json:"key"`
+	// Value is encoded in base64, so that it may hold arbitrary bytes.
+	Value []byte `json:"value,omitempty"`
+	// ContentType is an optional content type returned along with the value put.
+	ContentType string `json:"content_type,omitempty"`
+	// TTL is an optional duration such as 30s after which a put key expires.
+	TTL string `json:"ttl,omitempty"`
+	// Version, if present, must match the version of the key for the transaction to be applied.
+	// Version 0 requires the key to not exist.
+	Version *uint64 `json:"version,omitempty"`
+}
+
+// txnResponse is the body returned by POST /api/v1/txn.
+type txnResponse struct {
+	// Versions holds the new version of each key put, and 0 for each key deleted.
+	Versions []uint64 `json:"versions"`
+}
+
+// toStoreOps validates the operations of a request and converts them to store operations.
+func (req *txnRequest) toStoreOps(now time.Time) ([]store.Op, error) {
+	if len(req.Ops) == 0 {
+		return nil, fmt.Errorf(messageTxnEmpty)
+	}
+
+	ops := make([]store.Op, len(req.Ops))
+	for i, op := range req.Ops {
+		if op.Key == "" {
+			return nil, fmt.Errorf("key missing in operation %d", i)
+		}
+
+		switch op.Op {
+		case "put":
+			// like PUT /api/v1/key/:key, a value is required
+			if len(op.Value) == 0 {
+				return nil, fmt.Errorf("value missing in operation %d", i)
+			}
+			ops[i].Type = store.OpPut
+		case "delete":
+			ops[i].Type = store.OpDelete
+		default:
+			return nil, fmt.Errorf("invalid op %q in operation %d, expected put or delete", op.Op, i)
+		}
+
+		if op.TTL != "" {
+			d, err := time.ParseDuration(op.TTL)
+			if err != nil || d <= 0 {
+				return nil, fmt.Errorf("%s in operation %d", messageInvalidTTL, i)
+			}
+			ops[i].ExpiresAt = now.Add(d)
+		}
+
+		if op.Version != nil {
+			ops[i].Cond = store.IfVersion(*op.Version)
+		}
+
+		ops[i].Key, ops[i].Value, ops[i].ContentType = op.Key, op.Value, op.ContentType
+	}
+
+	return ops, nil
+}
+
+// serves POST /api/v1/txn
+func (s *server) txnHandler(w http.ResponseWriter, r *http.Request) {
+	var req txnRequest
+
+	// a body larger than permitted is refused before it is buffered
+	if r.ContentLength > s.maxTxnSize {
+		http.Error(w, messageTxnTooLarge, http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, s.maxTxnSize+1))
+	defer r.Body.Close()
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if int64(len(body)) > s.maxTxnSize {
+		http.Error(w, messageTxnTooLarge, http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	err = json.Unmarshal(body, &req)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	ops, err := req.toStoreOps(time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	versions, err := logger.Apply(s.store, ops, s.asyncWrites)
+	if err != nil {
+		if err == logger.ErrorLogFailed {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		} else if err == store.ErrorKeySizeTooLarge || err == store.ErrorValueSizeTooLarge {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		} else if err == store.ErrorVersionMismatch {
+			http.Error(w, err.Error(), http.StatusPreconditionFailed)
+		} else if err == store.ErrorStoreFull {
+			http.Error(w, err.Error(), http.StatusInsufficientStorage)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(txnResponse{Versions: versions})
+}
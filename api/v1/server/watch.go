@@ -0,0 +1,136 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/shubham1172/gokv/internal/logger"
+	"github.com/shubham1172/gokv/pkg/store"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const messageWatchUnavailable string = "Watching changes is not enabled"
+const messageInvalidSince string = "Invalid sequence number to resume from"
+const messageResumeUnsupported string = "The transaction log does not support resuming"
+const messageCompacted string = "The changes to resume from were removed from the transaction log"
+
+// changeNames are the names of the events of the stream, by type of change.
+var changeNames = map[store.ChangeType]string{
+	store.ChangePut:    "put",
+	store.ChangeDelete: "delete",
+	store.ChangeExpire: "expire",
+	store.ChangeEvict:  "evict",
+}
+
+// watchEvent is the data of an event of GET /api/v1/watch.
+type watchEvent struct {
+	Key string `json:"key"`
+	// Value is only present for puts, encoded in base64 as values may hold any bytes.
+	Value       []byte     `json:"value,omitempty"`
+	ContentType string     `json:"content_type,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+}
+
+// WithHub streams the changes published to h by the transaction log on GET /api/v1/watch.
+func WithHub(h *store.Hub) Option {
+	return func(s *server) {
+		s.hub = h
+	}
+}
+
+// writeNotification writes a notification as a server-sent event, whose id is its sequence number.
+func writeNotification(w http.ResponseWriter, n store.Notification) error {
+	data := watchEvent{Key: n.Key, Value: n.Value, ContentType: n.ContentType}
+	if !n.ExpiresAt.IsZero() {
+		data.ExpiresAt = &n.ExpiresAt
+	}
+
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", n.Sequence, changeNames[n.Type], b)
+	return err
+}
+
+// serves GET /api/v1/watch?prefix=&since=
+//
+// The changes of the keys starting with prefix are streamed as server-sent events once they are
+// persisted to the transaction log. With since, or the Last-Event-ID header sent by clients when
+// they reconnect, the changes after that sequence number are first read back from the log.
+func (s *server) watchHandler(w http.ResponseWriter, r *http.Request) {
+	if s.hub == nil {
+		http.Error(w, messageWatchUnavailable, http.StatusNotImplemented)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, messageWatchUnavailable, http.StatusInternalServerError)
+		return
+	}
+
+	prefix := r.URL.Query().Get("prefix")
+
+	since := r.Header.Get("Last-Event-ID")
+	if since == "" {
+		since = r.URL.Query().Get("since")
+	}
+
+	var last uint64
+	var follower logger.Follower
+	if since != "" {
+		var err error
+		last, err = strconv.ParseUint(since, 10, 64)
+		if err != nil {
+			http.Error(w, messageInvalidSince, http.StatusBadRequest)
+			return
+		}
+
+		follower, ok = s.logger.(logger.Follower)
+		if !ok {
+			http.Error(w, messageResumeUnsupported, http.StatusNotImplemented)
+			return
+		}
+
+		compacted, err := follower.Compacted()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if last < compacted {
+			http.Error(w, messageCompacted, http.StatusGone)
+			return
+		}
+	}
+
+	// the watcher is registered before the log is read, so that no change falls in between
+	watcher := s.hub.Watch(prefix)
+	defer watcher.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	err := logger.Follow(r.Context(), watcher, follower, last, func(n store.Notification) error {
+		if err := writeNotification(w, n); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	}, func() error {
+		// keeps an idle stream open through proxies
+		_, err := fmt.Fprint(w, ": keep-alive\n\n")
+		flusher.Flush()
+		return err
+	})
+	// a compaction may still run before the log is read, the stream then ends like for a lagging watcher
+	if err != nil && err != store.ErrorWatcherLagged && !errors.Is(err, logger.ErrorCompacted) && r.Context().Err() == nil {
+		log.Printf("failed to watch the changes: %v", err)
+	}
+}
@@ -0,0 +1,336 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/websocket"
+	"github.com/shubham1172/gokv/internal/logger"
+	"github.com/shubham1172/gokv/pkg/store"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// wsBuffer is the number of messages which can wait to be written to a websocket.
+	wsBuffer = 64
+	// wsWriteTimeout is the time after which a websocket which cannot be written to is closed.
+	wsWriteTimeout = 10 * time.Second
+)
+
+const messageWsKeyMissing string = "Key missing in the command"
+const messageWsInvalidCommand string = "Invalid command, expected a JSON object"
+const messageWsInvalidOp string = "Invalid op, expected get, put, delete, watch or unwatch"
+const messageWsWatchIDInUse string = "A watch with this id is already running"
+const messageWsWatchNotFound string = "No watch is running with this id"
+
+// wsUpgrader upgrades the requests to GET /api/v1/ws, browsers are only permitted from the same origin.
+var wsUpgrader = websocket.Upgrader{}
+
+// wsCommand is a command sent as a text message on /api/v1/ws.
+type wsCommand struct {
+	// ID is returned in the responses to the command, and in the changes pushed to a watch.
+	ID string `json:"id"`
+	// Op is one of get, put, delete, watch or unwatch. Unwatch stops the watch started with the same id.
+	Op  string `json:"op"`
+	Key string `json:"key,omitempty"`
+	// Value is encoded in base64, as values may hold any bytes.
+	Value       []byte `json:"value,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	// TTL is an optional duration such as 30s after which a put key expires.
+	TTL string `json:"ttl,omitempty"`
+	// Version, if present, must match the version of the key for a put or a delete to be applied.
+	// Version 0 requires the key to not exist.
+	Version *uint64 `json:"version,omitempty"`
+	// Prefix of the keys to watch, every key if empty.
+	Prefix string `json:"prefix,omitempty"`
+	// Since, if present, resumes a watch from the changes after this sequence number in the transaction log.
+	Since *uint64 `json:"since,omitempty"`
+}
+
+// wsMessage is a response to a command, or a change pushed to a watch, sent as a text message on /api/v1/ws.
+type wsMessage struct {
+	ID string `json:"id"`
+	// Status is the http status code of a response, it is absent from the changes pushed to a watch.
+	Status int    `json:"status,omitempty"`
+	Error  string `json:"error,omitempty"`
+	// Event is the type of a change pushed to a watch, and Sequence its sequence number in the transaction log.
+	Event       string     `json:"event,omitempty"`
+	Sequence    uint64     `json:"sequence,omitempty"`
+	Key         string     `json:"key,omitempty"`
+	Value       []byte     `json:"value,omitempty"`
+	ContentType string     `json:"content_type,omitempty"`
+	Version     uint64     `json:"version,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+}
+
+// errorStatus returns the http status code standing for an error returned by logger.Apply or the store.
+func errorStatus(err error) int {
+	switch err {
+	case store.ErrorKeyNotFound:
+		return http.StatusNotFound
+	case store.ErrorKeySizeTooLarge, store.ErrorValueSizeTooLarge, store.ErrorInvalidOp:
+		return http.StatusBadRequest
+	case store.ErrorVersionMismatch:
+		return http.StatusPreconditionFailed
+	case store.ErrorStoreFull:
+		return http.StatusInsufficientStorage
+	case logger.ErrorLogFailed:
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+// wsConn serves the commands sent on a websocket. The commands are run in the order they are sent,
+// while the watches run in the background until they are stopped or the websocket is closed.
+type wsConn struct {
+	*server
+	conn    *websocket.Conn
+	out     chan wsMessage // Messages waiting to be written, in order
+	wg      sync.WaitGroup // Watches running
+	mu      sync.Mutex     // Protects watches
+	watches map[string]*wsWatch
+}
+
+// wsWatch is a watch running on a websocket.
+type wsWatch struct {
+	cancel       context.CancelFunc
+	acknowledged chan struct{} // Closed once the response to the watch command is queued
+	stopped      chan struct{} // Closed once the watch has stopped pushing changes
+}
+
+// serves GET /api/v1/ws
+func (s *server) wsHandler(w http.ResponseWriter, r *http.Request) {
+	conn, err := wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// the upgrader has already answered the request
+		return
+	}
+
+	c := &wsConn{server: s, conn: conn, out: make(chan wsMessage, wsBuffer), watches: make(map[string]*wsWatch)}
+	c.serve()
+}
+
+// serve runs the commands until the websocket is closed, then stops the watches.
+func (c *wsConn) serve() {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	written := make(chan struct{})
+	go func() {
+		defer close(written)
+		c.write()
+	}()
+
+	c.conn.SetReadLimit(c.maxTxnSize)
+	for {
+		_, b, err := c.conn.ReadMessage()
+		if err != nil {
+			break
+		}
+
+		var cmd wsCommand
+		if err := json.Unmarshal(b, &cmd); err != nil {
+			c.send(ctx, wsMessage{Status: http.StatusBadRequest, Error: messageWsInvalidCommand})
+			continue
+		}
+
+		c.run(ctx, cmd)
+	}
+
+	cancel()
+	c.wg.Wait()
+	close(c.out)
+	<-written
+	c.conn.Close()
+}
+
+// write writes the messages to the websocket in order. Once a write fails, the websocket is closed,
+// which stops serve, and the remaining messages are discarded.
+func (c *wsConn) write() {
+	failed := false
+	for m := range c.out {
+		if failed {
+			continue
+		}
+
+		c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+		if err := c.conn.WriteJSON(m); err != nil {
+			failed = true
+			c.conn.Close()
+		}
+	}
+}
+
+// send queues a message to be written, unless ctx is done first.
+func (c *wsConn) send(ctx context.Context, m wsMessage) error {
+	select {
+	case c.out <- m:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// run runs a command and queues its response.
+func (c *wsConn) run(ctx context.Context, cmd wsCommand) {
+	var res wsMessage
+
+	switch cmd.Op {
+	case "get":
+		res = c.get(cmd)
+	case "put", "delete":
+		res = c.apply(cmd)
+	case "watch":
+		var w *wsWatch
+		res, w = c.watch(ctx, cmd)
+		// the changes are only pushed once the watch is acknowledged
+		if w != nil {
+			defer close(w.acknowledged)
+		}
+	case "unwatch":
+		res = c.unwatch(cmd)
+	default:
+		res = wsMessage{Status: http.StatusBadRequest, Error: messageWsInvalidOp}
+	}
+
+	res.ID = cmd.ID
+	c.send(ctx, res)
+}
+
+// get answers a get command with the value of the key.
+func (c *wsConn) get(cmd wsCommand) wsMessage {
+	if cmd.Key == "" {
+		return wsMessage{Status: http.StatusBadRequest, Error: messageWsKeyMissing}
+	}
+
+	e, err := c.store.GetEntry(cmd.Key)
+	if err != nil {
+		return wsMessage{Status: errorStatus(err), Error: err.Error()}
+	}
+
+	res := wsMessage{Status: http.StatusOK, Key: cmd.Key, Value: e.Value, ContentType: e.ContentType, Version: e.Version}
+	if !e.ExpiresAt.IsZero() {
+		res.ExpiresAt = &e.ExpiresAt
+	}
+	return res
+}
+
+// apply answers a put or delete command once it is applied to the store and persisted to the transaction log.
+func (c *wsConn) apply(cmd wsCommand) wsMessage {
+	if cmd.Key == "" {
+		return wsMessage{Status: http.StatusBadRequest, Error: messageWsKeyMissing}
+	}
+
+	op := store.Op{Type: store.OpDelete, Key: cmd.Key}
+	status := http.StatusOK
+	if cmd.Op == "put" {
+		if len(cmd.Value) == 0 {
+			return wsMessage{Status: http.StatusBadRequest, Error: messageValueNotFound}
+		}
+
+		op.Type, op.Value, op.ContentType = store.OpPut, cmd.Value, cmd.ContentType
+		status = http.StatusCreated
+	}
+
+	if cmd.TTL != "" {
+		d, err := time.ParseDuration(cmd.TTL)
+		if err != nil || d <= 0 {
+			return wsMessage{Status: http.StatusBadRequest, Error: messageInvalidTTL}
+		}
+		op.ExpiresAt = time.Now().Add(d)
+	}
+
+	if cmd.Version != nil {
+		op.Cond = store.IfVersion(*cmd.Version)
+	}
+
+	versions, err := logger.Apply(c.store, []store.Op{op}, c.asyncWrites)
+	if err != nil {
+		return wsMessage{Status: errorStatus(err), Error: err.Error()}
+	}
+
+	return wsMessage{Status: status, Key: cmd.Key, Version: versions[0]}
+}
+
+// watch starts a watch pushing the changes of the keys starting with the prefix of the command,
+// tagged with the id of the command. If the watch falls behind, it is stopped with a 410 message
+// and can be resumed from the sequence number of the last change received. It is also stopped
+// with a 410 message if the changes to resume from were removed from the transaction log.
+func (c *wsConn) watch(ctx context.Context, cmd wsCommand) (wsMessage, *wsWatch) {
+	if c.hub == nil {
+		return wsMessage{Status: http.StatusNotImplemented, Error: messageWatchUnavailable}, nil
+	}
+
+	var follower logger.Follower
+	var since uint64
+	if cmd.Since != nil {
+		var ok bool
+		follower, ok = c.logger.(logger.Follower)
+		if !ok {
+			return wsMessage{Status: http.StatusNotImplemented, Error: messageResumeUnsupported}, nil
+		}
+		since = *cmd.Since
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.watches[cmd.ID]; ok {
+		return wsMessage{Status: http.StatusBadRequest, Error: messageWsWatchIDInUse}, nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	w := &wsWatch{cancel: cancel, acknowledged: make(chan struct{}), stopped: make(chan struct{})}
+	c.watches[cmd.ID] = w
+
+	// the watcher is registered before the command is acknowledged, so that no change falls in between
+	watcher := c.hub.Watch(cmd.Prefix)
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		defer watcher.Close()
+
+		<-w.acknowledged
+
+		err := logger.Follow(ctx, watcher, follower, since, func(n store.Notification) error {
+			m := wsMessage{ID: cmd.ID, Event: changeNames[n.Type], Sequence: n.Sequence, Key: n.Key, Value: n.Value, ContentType: n.ContentType}
+			if !n.ExpiresAt.IsZero() {
+				m.ExpiresAt = &n.ExpiresAt
+			}
+			return c.send(ctx, m)
+		}, nil)
+
+		c.mu.Lock()
+		delete(c.watches, cmd.ID)
+		c.mu.Unlock()
+		close(w.stopped)
+
+		if err == store.ErrorWatcherLagged {
+			c.send(ctx, wsMessage{ID: cmd.ID, Status: http.StatusGone, Error: err.Error()})
+		} else if errors.Is(err, logger.ErrorCompacted) {
+			c.send(ctx, wsMessage{ID: cmd.ID, Status: http.StatusGone, Error: messageCompacted})
+		} else if err != nil && ctx.Err() == nil {
+			c.send(ctx, wsMessage{ID: cmd.ID, Status: http.StatusInternalServerError, Error: err.Error()})
+		}
+	}()
+
+	return wsMessage{Status: http.StatusOK}, w
+}
+
+// unwatch stops the watch with the id of the command, no change of the watch is pushed after the response.
+func (c *wsConn) unwatch(cmd wsCommand) wsMessage {
+	c.mu.Lock()
+	w, ok := c.watches[cmd.ID]
+	c.mu.Unlock()
+
+	if !ok {
+		return wsMessage{Status: http.StatusNotFound, Error: messageWsWatchNotFound}
+	}
+
+	w.cancel()
+	<-w.stopped
+
+	return wsMessage{Status: http.StatusOK}
+}
@@ -3,30 +3,65 @@ package config
 import (
 	"github.com/spf13/viper"
 	"strings"
+	"time"
 )
 
 // Configuration for gokv
 type Configuration struct {
-	Server   ServerConfiguration
-	Logging  LoggingConfiguration
-	Database DatabaseConfiguration
+	Server    ServerConfiguration
+	Logging   LoggingConfiguration
+	Database  DatabaseConfiguration
+	Storage   StorageConfiguration
+	Memcached MemcachedConfiguration
 }
 
 type ServerConfiguration struct {
-	Address string
+	Address      string
+	MaxTxnSize   int64  // Max size in bytes of the body of a transaction
+	GRPCAddress  string // Address of the gRPC server, empty disables it
+	RedisAddress string // Address of the redis protocol server, empty disables it
 }
 
 type LoggingConfiguration struct {
-	LogType     string
-	LogFileName string
+	LogType           string
+	LogFileName       string
+	BoltFileName      string        // Name of the database file of the bolt logger
+	CompactOnStartup  bool          // Compact the log file before replaying it
+	CompactionMinSize int64         // Size in bytes the log file must reach before it is compacted online
+	CompactionRatio   float64       // Growth of the log file since the last compaction which triggers an online compaction, 0 disables it
+	SnapshotDir       string        // Directory where snapshots of the store are saved
+	SnapshotInterval  time.Duration // Interval between two snapshots, 0 disables them
+	StrictRecovery    bool          // Refuse to start instead of truncating a torn write at the end of the log file
+	Fsync             string        // Policy for flushing the log file to the disk: "always", "everysec" or "never"
+	AsyncWrites       bool          // Answer writes without waiting for them to be persisted to the log
 }
 
 type DatabaseConfiguration struct {
-	DBName    string
-	Host      string
-	User      string
-	Password  string
-	SslStatus string
+	DBName          string
+	Host            string
+	User            string
+	Password        string
+	SslStatus       string
+	Schema          string        // Schema of the transaction table
+	Table           string        // Name of the transaction table
+	BatchSize       int           // Number of events after which a batch of events is flushed
+	BatchMaxLatency time.Duration // Time after which a batch of events is flushed even if it is not full
+}
+
+type StorageConfiguration struct {
+	Engine         string // Engine holding the key-value pairs: "memory" or "bolt"
+	Path           string // Path of the database file of the bolt engine
+	CacheSize      int    // Number of recently used key-value pairs of the bolt engine kept in memory, 0 disables the cache
+	MaxKeys        int    // Max number of keys in the store, 0 means no limit
+	MaxMemory      int64  // Max estimated memory in bytes used by the keys and values, 0 means no limit
+	EvictionPolicy string // Keys evicted once a limit is reached: "noeviction", "lru", "lfu", "random" or "volatile-ttl"
+	MaxKeySize     int    // Max size in bytes of a key
+	MaxValueSize   int    // Max size in bytes of a value
+}
+
+type MemcachedConfiguration struct {
+	Enabled bool   // Serve the memcached text protocol
+	Address string // Address of the memcached protocol server
 }
 
 // GetConfiguration loads the app configuration from a given configFileName
@@ -45,13 +80,39 @@ func GetConfiguration() (*Configuration, error) {
 	}
 
 	viper.SetDefault("server.address", ":8000")
+	viper.SetDefault("server.maxtxnsize", 4<<20)
+	viper.SetDefault("server.grpcaddress", "")
+	viper.SetDefault("server.redisaddress", "")
 	viper.SetDefault("logging.logtype", "file")
 	viper.SetDefault("logging.logfilename", "transactions.log")
+	viper.SetDefault("logging.boltfilename", "transactions.db")
+	viper.SetDefault("logging.compactonstartup", true)
+	viper.SetDefault("logging.compactionminsize", 64<<20)
+	viper.SetDefault("logging.compactionratio", 2)
+	viper.SetDefault("logging.snapshotdir", "snapshots")
+	viper.SetDefault("logging.snapshotinterval", 0)
+	viper.SetDefault("logging.strictrecovery", false)
+	viper.SetDefault("logging.fsync", "everysec")
+	viper.SetDefault("logging.asyncwrites", false)
 	viper.SetDefault("database.dbname", "postgres")
 	viper.SetDefault("database.host", "postgres")
 	viper.SetDefault("database.user", "postgres")
 	viper.SetDefault("database.password", "password")
 	viper.SetDefault("database.sslstatus", "disable")
+	viper.SetDefault("database.schema", "public")
+	viper.SetDefault("database.table", "transactions")
+	viper.SetDefault("database.batchsize", 1000)
+	viper.SetDefault("database.batchmaxlatency", "5ms")
+	viper.SetDefault("storage.engine", "memory")
+	viper.SetDefault("storage.path", "data.db")
+	viper.SetDefault("storage.cachesize", 10000)
+	viper.SetDefault("storage.maxkeys", 0)
+	viper.SetDefault("storage.maxmemory", 0)
+	viper.SetDefault("storage.evictionpolicy", "lru")
+	viper.SetDefault("storage.maxkeysize", 1024)
+	viper.SetDefault("storage.maxvaluesize", 1024)
+	viper.SetDefault("memcached.enabled", false)
+	viper.SetDefault("memcached.address", ":11211")
 
 	config := &Configuration{}
 	err = viper.Unmarshal(config)
@@ -4,6 +4,10 @@ go 1.15
 
 require (
 	github.com/gorilla/mux v1.8.0
+	github.com/gorilla/websocket v1.4.2
 	github.com/lib/pq v1.9.0
 	github.com/spf13/viper v1.7.1
+	go.etcd.io/bbolt v1.3.5
+	google.golang.org/grpc v1.43.0
+	google.golang.org/protobuf v1.27.1
 )
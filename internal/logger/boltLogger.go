@@ -0,0 +1,335 @@
+package logger
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"github.com/shubham1172/gokv/config"
+	"github.com/shubham1172/gokv/pkg/store"
+	bolt "go.etcd.io/bbolt"
+	"log"
+	"time"
+)
+
+// eventsBucket holds the events, keyed by their sequence number in big endian so that they are sorted.
+var eventsBucket = []byte("events")
+
+// metaBucket holds the state of the log which is not an event.
+var metaBucket = []byte("meta")
+
+// truncatedKey is the key of metaBucket holding the sequence number up to which the events
+// deleted from the log are covered by a snapshot, in big endian. It is missing if there is none.
+var truncatedKey = []byte("truncated")
+
+// compactedKey is the key of metaBucket holding the sequence number up to which events may have
+// been deleted from the log by a compaction or a truncation, in big endian. It is missing if there is none.
+var compactedKey = []byte("compacted")
+
+// BoltTransactionLogger is a type that defines a logger which writes to an embedded bbolt database.
+// The requests picked up together are written within a single database transaction, so the events
+// of a request are atomic without begin and commit markers.
+type BoltTransactionLogger struct {
+	*transactionLogger
+	db *bolt.DB // Database handle
+}
+
+// NewBoltTransactionLogger returns a new logger which writes to the database file pointed by loggingConfig.BoltFileName.
+// Every database transaction is flushed to the disk, unless loggingConfig.Fsync is FsyncNever.
+func NewBoltTransactionLogger(loggingConfig config.LoggingConfiguration, opts ...Option) (TransactionLogger, error) {
+	fsync, err := fsyncPolicy(loggingConfig.Fsync)
+	if err != nil {
+		return nil, err
+	}
+
+	// the database is locked by the process which opened it, give up instead of waiting forever
+	db, err := bolt.Open(loggingConfig.BoltFileName, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("cannot open bolt database: %v", err)
+	}
+	db.NoSync = fsync == FsyncNever
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(eventsBucket)
+		if err != nil {
+			return err
+		}
+		_, err = tx.CreateBucketIfNotExists(metaBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("cannot create bucket: %v", err)
+	}
+
+	return &BoltTransactionLogger{transactionLogger: newTransactionLogger(opts...), db: db}, nil
+}
+
+// sequenceKey returns the key of the event with the sequence number seq.
+func sequenceKey(seq uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, seq)
+	return key
+}
+
+// insert the events of the requests in order within a single database transaction,
+// and send the result to their done channels.
+func (l *BoltTransactionLogger) insert(reqs []request) {
+	var sequenced []Event
+
+	err := l.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(eventsBucket)
+
+		for _, req := range reqs {
+			for _, e := range req.events {
+				// the sequence of the bucket is never reused, even once the events are deleted
+				seq, err := b.NextSequence()
+				if err != nil {
+					return err
+				}
+
+				// values must stay untouched until the transaction ends, so each gets its own buffer
+				err = b.Put(sequenceKey(seq), encodePayload(nil, seq, e))
+				if err != nil {
+					return err
+				}
+
+				if l.hub != nil {
+					e.Sequence = seq
+					sequenced = append(sequenced, e)
+				}
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		go func() { l.errorCh <- err }()
+	} else {
+		l.publish(sequenced)
+	}
+
+	for _, req := range reqs {
+		req.done <- err
+	}
+}
+
+// ReadEvents reads the database and replays the events on the Event channel.
+func (l *BoltTransactionLogger) ReadEvents() (<-chan Event, <-chan error) {
+	outEvent := make(chan Event)
+	outError := make(chan error, 1)
+
+	go func() {
+		defer close(outEvent)
+		defer close(outError)
+
+		err := l.db.View(func(tx *bolt.Tx) error {
+			c := tx.Bucket(eventsBucket).Cursor()
+			for k, v := c.First(); k != nil; k, v = c.Next() {
+				e, err := decodePayload(v)
+				if err != nil {
+					return fmt.Errorf("malformed event %d: %v", binary.BigEndian.Uint64(k), err)
+				}
+				outEvent <- e
+			}
+			return nil
+		})
+		if err != nil {
+			outError <- fmt.Errorf("error while reading the bolt database: %v", err)
+		}
+	}()
+
+	return outEvent, outError
+}
+
+// ReadChangesAfter reads the events within a read-only database transaction, which sees the events
+// committed before it started.
+func (l *BoltTransactionLogger) ReadChangesAfter(ctx context.Context, seq uint64) (<-chan store.Notification, <-chan error) {
+	return sendChanges(ctx, seq, func(send func(e Event) bool) error {
+		return l.db.View(func(tx *bolt.Tx) error {
+			if seq < readMark(tx.Bucket(metaBucket), compactedKey) {
+				return ErrorCompacted
+			}
+
+			c := tx.Bucket(eventsBucket).Cursor()
+			for k, v := c.Seek(sequenceKey(seq + 1)); k != nil; k, v = c.Next() {
+				e, err := decodePayload(v)
+				if err != nil {
+					return fmt.Errorf("malformed event %d: %v", binary.BigEndian.Uint64(k), err)
+				}
+				if !send(e) {
+					return nil
+				}
+			}
+			return nil
+		})
+	})
+}
+
+// Compact deletes every event but the latest put of every live key, dropping the keys which were
+// deleted or have expired. Once the log has been truncated behind a snapshot, the latest event of
+// every key is kept instead, since the snapshot may hold keys which the deletes and expired puts of
+// the log remove. It runs within a single database transaction, so writes wait for it.
+// The space freed is reused by later writes rather than returned to the file system.
+func (l *BoltTransactionLogger) Compact() error {
+	return l.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(eventsBucket)
+		truncated := tx.Bucket(metaBucket).Get(truncatedKey) != nil
+
+		// sequence number of the latest event of each key which is kept
+		kept := make(map[string]uint64)
+		now := time.Now()
+
+		err := b.ForEach(func(k, v []byte) error {
+			e, err := decodePayload(v)
+			if err != nil {
+				return fmt.Errorf("malformed event %d: %v", binary.BigEndian.Uint64(k), err)
+			}
+
+			if truncated || e.EventType == EventPut && (e.ExpiresAt.IsZero() || now.Before(e.ExpiresAt)) {
+				kept[e.Key] = e.Sequence
+			} else {
+				delete(kept, e.Key)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		var dropped uint64
+		err = deleteEvents(b, func(seq uint64, e Event) bool {
+			if kept[e.Key] == seq {
+				return false
+			}
+			dropped = seq
+			return true
+		})
+		if err != nil {
+			return err
+		}
+
+		return raiseMark(tx.Bucket(metaBucket), compactedKey, dropped)
+	})
+}
+
+// Compacted returns the sequence number up to which events may have been deleted from the database.
+func (l *BoltTransactionLogger) Compacted() (uint64, error) {
+	var seq uint64
+
+	err := l.db.View(func(tx *bolt.Tx) error {
+		seq = readMark(tx.Bucket(metaBucket), compactedKey)
+		return nil
+	})
+
+	return seq, err
+}
+
+// LastSequence returns the sequence number of the last event written to the database.
+func (l *BoltTransactionLogger) LastSequence() (uint64, error) {
+	var seq uint64
+
+	err := l.db.View(func(tx *bolt.Tx) error {
+		seq = tx.Bucket(eventsBucket).Sequence()
+		return nil
+	})
+
+	return seq, err
+}
+
+// Truncate deletes all the events up to and including the sequence number seq, and records that
+// they are covered by a snapshot.
+func (l *BoltTransactionLogger) Truncate(seq uint64) error {
+	return l.db.Update(func(tx *bolt.Tx) error {
+		err := deleteEvents(tx.Bucket(eventsBucket), func(s uint64, e Event) bool {
+			return s <= seq
+		})
+		if err != nil {
+			return err
+		}
+
+		meta := tx.Bucket(metaBucket)
+		err = raiseMark(meta, truncatedKey, seq)
+		if err != nil {
+			return err
+		}
+		return raiseMark(meta, compactedKey, seq)
+	})
+}
+
+// readMark returns the sequence number held by the key of meta, 0 if it is missing.
+func readMark(meta *bolt.Bucket, key []byte) uint64 {
+	v := meta.Get(key)
+	if v == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint64(v)
+}
+
+// raiseMark sets the sequence number held by the key of meta to seq, unless it already holds a greater one.
+func raiseMark(meta *bolt.Bucket, key []byte, seq uint64) error {
+	if v := meta.Get(key); v != nil && binary.BigEndian.Uint64(v) >= seq {
+		return nil
+	}
+	return meta.Put(key, sequenceKey(seq))
+}
+
+// deleteEvents deletes the events of b for which drop returns true.
+func deleteEvents(b *bolt.Bucket, drop func(seq uint64, e Event) bool) error {
+	var dropped [][]byte
+
+	err := b.ForEach(func(k, v []byte) error {
+		e, err := decodePayload(v)
+		if err != nil {
+			return err
+		}
+		if drop(binary.BigEndian.Uint64(k), e) {
+			dropped = append(dropped, k)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// keys cannot be deleted while iterating over the bucket
+	for _, k := range dropped {
+		err = b.Delete(k)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// close the database and notify shutdown complete.
+func (l *BoltTransactionLogger) shutdown() {
+	close(l.eventCh)
+
+	err := l.db.Close()
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	go func() { l.shutdownCompleteCh <- struct{}{} }()
+}
+
+// Run the logger by handling logging requests and shutdown gracefully if required.
+func (l *BoltTransactionLogger) Run() {
+	run := true
+	for run {
+		select {
+		// handle logging request, one batch after the other so that they are written in order
+		case req := <-l.eventCh:
+			l.insert(l.pending(req))
+		// handle shutdown request
+		case _ = <-l.shutdownCh:
+			// the requests sent before Stop may not have been picked up yet
+			for len(l.eventCh) > 0 {
+				l.insert(l.pending(<-l.eventCh))
+			}
+			l.shutdown()
+			run = false
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package logger
+
+import (
+	"errors"
+	"github.com/shubham1172/gokv/config"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// newBoltLogger opens a bolt logger on filename and runs it.
+func newBoltLogger(t *testing.T, filename string) TransactionLogger {
+	l, err := NewBoltTransactionLogger(config.LoggingConfiguration{BoltFileName: filename})
+	if err != nil {
+		t.Fatalf("could not create logger: %v", err)
+	}
+	go l.Run()
+
+	return l
+}
+
+func TestBoltTransactionLogger(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "transactions.db")
+
+	l := newBoltLogger(t, filename)
+	if err := <-l.WritePut("testKey1", []byte("value1")); err != nil {
+		t.Fatalf("Expected err to be %v, got %v instead", nil, err)
+	}
+	l.WriteBatch([]Event{
+		{EventType: EventPut, Key: "testKey2", Value: []byte("value\n2")},
+		{EventType: EventDelete, Key: "testKey1"},
+	})
+	l.WriteExpire("testKey2")
+	l.Stop()
+
+	l = newBoltLogger(t, filename)
+	defer l.Stop()
+
+	got := readAll(t, l)
+	for i, e := range got {
+		if e.Sequence != uint64(i+1) {
+			t.Fatalf("expected sequence %d, got %d instead", i+1, e.Sequence)
+		}
+	}
+
+	want := []Event{
+		{EventType: EventPut, Key: "testKey1", Value: []byte("value1")},
+		{EventType: EventPut, Key: "testKey2", Value: []byte("value\n2")},
+		{EventType: EventDelete, Key: "testKey1"},
+		{EventType: EventExpire, Key: "testKey2"},
+	}
+	if got = stripSequences(got); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected events %v, got %v instead", want, got)
+	}
+}
+
+func TestBoltTransactionLoggerCompact(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "transactions.db")
+
+	l := newBoltLogger(t, filename)
+	defer l.Stop()
+
+	for i := 0; i < 10; i++ {
+		l.WriteBatch([]Event{
+			{EventType: EventPut, Key: "testKey1", Value: []byte("value" + strconv.Itoa(i))},
+			{EventType: EventPut, Key: "testKey2", Value: []byte("value" + strconv.Itoa(i))},
+		})
+	}
+	l.WriteDelete("testKey2")
+	l.WritePut("testKey3", []byte("value3"))
+	<-l.WritePutWithExpiry("testKey4", []byte("value4"), time.Now().Add(-time.Second))
+
+	if err := l.(Compactor).Compact(); err != nil {
+		t.Fatalf("could not compact: %v", err)
+	}
+
+	got := readAll(t, l)
+	want := []uint64{19, 22}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d events, got %v instead", len(want), got)
+	}
+	for i, e := range got {
+		if e.Sequence != want[i] {
+			t.Fatalf("expected sequence %d, got %d instead", want[i], e.Sequence)
+		}
+	}
+	if string(got[0].Value) != "value9" || string(got[1].Value) != "value3" {
+		t.Fatalf("expected the latest puts to be kept, got %v instead", got)
+	}
+}
+
+func TestBoltTransactionLoggerTruncate(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "transactions.db")
+
+	l := newBoltLogger(t, filename)
+	for i := 0; i < 5; i++ {
+		l.WritePut("testKey"+strconv.Itoa(i), []byte("value"))
+	}
+	<-l.WriteDelete("testKey0")
+
+	tr := l.(Truncater)
+	if err := tr.Truncate(4); err != nil {
+		t.Fatalf("could not truncate: %v", err)
+	}
+	l.Stop()
+
+	// the sequence numbers keep ascending after the events are removed and the database is reopened
+	l = newBoltLogger(t, filename)
+	defer l.Stop()
+
+	<-l.WritePut("testKey5", []byte("value"))
+
+	seq, err := l.(Truncater).LastSequence()
+	if err != nil {
+		t.Fatalf("could not read the last sequence number: %v", err)
+	}
+	if seq != 7 {
+		t.Fatalf("expected last sequence %d, got %d instead", 7, seq)
+	}
+
+	var got []uint64
+	for _, e := range readAll(t, l) {
+		got = append(got, e.Sequence)
+	}
+	if want := []uint64{5, 6, 7}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected sequences %v, got %v instead", want, got)
+	}
+}
+
+func TestBoltTransactionLoggerCompactAfterTruncate(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "transactions.db")
+
+	l := newBoltLogger(t, filename)
+	l.WritePut("testKey1", []byte("value1"))
+	<-l.WritePut("testKey2", []byte("value2"))
+
+	// the snapshot holds both keys, and the log only the changes made after it
+	if err := l.(Truncater).Truncate(2); err != nil {
+		t.Fatalf("could not truncate: %v", err)
+	}
+	<-l.WriteDelete("testKey1")
+	l.Stop()
+
+	l = newBoltLogger(t, filename)
+	if err := l.(Compactor).Compact(); err != nil {
+		t.Fatalf("could not compact: %v", err)
+	}
+	l.Stop()
+
+	// the key deleted after the snapshot stays deleted once the log is replayed on top of it
+	l = newBoltLogger(t, filename)
+	defer l.Stop()
+
+	got := readAll(t, l)
+	if len(got) != 1 || got[0].EventType != EventDelete || got[0].Key != "testKey1" {
+		t.Fatalf("expected the delete to be kept, got %v instead", got)
+	}
+}
+
+func TestBoltTransactionLoggerFsync(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "transactions.db")
+
+	_, err := NewBoltTransactionLogger(config.LoggingConfiguration{BoltFileName: filename, Fsync: "sometimes"})
+	if !errors.Is(err, ErrorInvalidFsync) {
+		t.Fatalf("Expected err to be %v, got %v instead", ErrorInvalidFsync, err)
+	}
+
+	l, err := NewBoltTransactionLogger(config.LoggingConfiguration{BoltFileName: filename, Fsync: FsyncNever})
+	if err != nil {
+		t.Fatalf("could not create logger: %v", err)
+	}
+	defer l.(*BoltTransactionLogger).db.Close()
+
+	if !l.(*BoltTransactionLogger).db.NoSync {
+		t.Fatalf("expected the database not to be flushed with fsync %q", FsyncNever)
+	}
+}
@@ -0,0 +1,113 @@
+package logger
+
+import (
+	"context"
+	"errors"
+	"github.com/shubham1172/gokv/pkg/store"
+	"log"
+)
+
+// ErrorLogFailed is returned by Apply if the changes could not be persisted to the transaction log.
+var ErrorLogFailed = errors.New("Failed to persist the change to the transaction log")
+
+// CommitFunc returns a store.CommitFunc which writes the changes of every write to the store
+// to l as a single unit. Since the store calls it in the order the writes are applied, and
+// the logger writes the events in the order they are sent, replaying the log rebuilds the store.
+func CommitFunc(l TransactionLogger) store.CommitFunc {
+	return func(changes []store.Change) <-chan error {
+		events := make([]Event, len(changes))
+		for i, c := range changes {
+			events[i] = Event{Key: c.Key, Value: c.Value, ContentType: c.ContentType, Flags: c.Flags, ExpiresAt: c.ExpiresAt}
+
+			switch c.Type {
+			case store.ChangePut:
+				events[i].EventType = EventPut
+			case store.ChangeDelete:
+				events[i].EventType = EventDelete
+			case store.ChangeExpire:
+				events[i].EventType = EventExpire
+			case store.ChangeEvict:
+				events[i].EventType = EventEvict
+			}
+		}
+
+		return l.WriteBatch(events)
+	}
+}
+
+// Apply applies the operations to st and waits for their changes to be persisted to the transaction log
+// the store passes them to through its CommitFunc, if it has one. With async, writes are answered as soon
+// as they are applied to the store instead, and may then be lost on a crash. If the changes could not be
+// persisted, the store has undone them, the error is logged and ErrorLogFailed is returned.
+func Apply(st *store.Store, ops []store.Op, async bool) ([]uint64, error) {
+	versions, done, err := st.Apply(ops)
+	if err != nil {
+		return nil, err
+	}
+
+	if async || done == nil {
+		return versions, nil
+	}
+	if err := <-done; err != nil {
+		log.Printf("failed to persist a change to the transaction log: %v", err)
+		return nil, ErrorLogFailed
+	}
+	return versions, nil
+}
+
+// notification converts an event read from the log to the change it stands for.
+// It returns false for the events which do not change the store, such as markers.
+func notification(e Event) (store.Notification, bool) {
+	n := store.Notification{Sequence: e.Sequence, Change: store.Change{Key: e.Key}}
+
+	switch e.EventType {
+	case EventPut:
+		n.Type, n.Value, n.ContentType, n.Flags, n.ExpiresAt = store.ChangePut, e.Value, e.ContentType, e.Flags, e.ExpiresAt
+	case EventDelete:
+		n.Type = store.ChangeDelete
+	case EventExpire:
+		n.Type = store.ChangeExpire
+	case EventEvict:
+		n.Type = store.ChangeEvict
+	default:
+		return n, false
+	}
+
+	return n, true
+}
+
+// sendChanges converts the events sent by read to changes and sends those with a sequence number
+// greater than seq to the returned channel, until read is done or ctx is done. read must stop
+// once send returns false.
+func sendChanges(ctx context.Context, seq uint64, read func(send func(e Event) bool) error) (<-chan store.Notification, <-chan error) {
+	outChange := make(chan store.Notification)
+	outError := make(chan error, 1)
+
+	go func() {
+		defer close(outChange)
+		defer close(outError)
+
+		err := read(func(e Event) bool {
+			n, ok := notification(e)
+			if !ok || n.Sequence <= seq {
+				return true
+			}
+
+			select {
+			case outChange <- n:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		})
+		// an early stop is reported as such, rather than as the error it caused
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		if err != nil {
+			outError <- err
+		}
+	}()
+
+	return outChange, outError
+}
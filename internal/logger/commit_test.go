@@ -0,0 +1,272 @@
+package logger
+
+import (
+	"context"
+	"errors"
+	"github.com/shubham1172/gokv/config"
+	"github.com/shubham1172/gokv/pkg/store"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCommitFunc(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "transactions.log")
+
+	l, err := NewFileTransactionLogger(config.LoggingConfiguration{LogFileName: filename})
+	if err != nil {
+		t.Fatalf("could not create logger: %v", err)
+	}
+	go l.Run()
+
+	expiresAt := time.Unix(0, time.Now().Add(time.Hour).UnixNano())
+
+	s := store.New(store.WithCommitFunc(CommitFunc(l)))
+	defer s.Close()
+
+	s.PutWithExpiry("testKey1", []byte("value1"), expiresAt)
+	_, done, err := s.Apply([]store.Op{
+		{Type: store.OpPut, Key: "testKey2", Value: []byte("value2")},
+		{Type: store.OpDelete, Key: "testKey1"},
+	})
+	if err != nil {
+		t.Fatalf("Expected err to be %v, got %v instead", nil, err)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("Expected err to be %v, got %v instead", nil, err)
+	}
+	l.Stop()
+
+	l, err = NewFileTransactionLogger(config.LoggingConfiguration{LogFileName: filename})
+	if err != nil {
+		t.Fatalf("could not create logger: %v", err)
+	}
+	defer l.(*FileTransactionLogger).file.Close()
+
+	got := stripSequences(readAll(t, l))
+	if len(got) > 0 && got[0].ExpiresAt.Equal(expiresAt) {
+		got[0].ExpiresAt = expiresAt
+	}
+
+	want := []Event{
+		{EventType: EventPut, Key: "testKey1", Value: []byte("value1"), ExpiresAt: expiresAt},
+		{EventType: EventPut, Key: "testKey2", Value: []byte("value2")},
+		{EventType: EventDelete, Key: "testKey1"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected events %v, got %v instead", want, got)
+	}
+}
+
+func TestApply(t *testing.T) {
+	// commit fails to persist the puts of value2 with err
+	commit := func(err error) store.CommitFunc {
+		return func(changes []store.Change) <-chan error {
+			done := make(chan error, 1)
+			if string(changes[0].Value) == "value2" {
+				done <- err
+			} else {
+				done <- nil
+			}
+			return done
+		}
+	}
+
+	testCases := []struct {
+		name     string
+		commit   store.CommitFunc
+		async    bool
+		expected error
+		value    string
+	}{
+		{"without commit func", nil, false, nil, "value2"},
+		{"persisted", commit(nil), false, nil, "value2"},
+		{"async", commit(nil), true, nil, "value2"},
+		{"not persisted", commit(errors.New("disk full")), false, ErrorLogFailed, "value1"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var opts []store.Option
+			if tc.commit != nil {
+				opts = append(opts, store.WithCommitFunc(tc.commit))
+			}
+			s := store.New(opts...)
+			defer s.Close()
+
+			s.Put("testKey", []byte("value1"))
+			_, err := Apply(s, []store.Op{{Type: store.OpPut, Key: "testKey", Value: []byte("value2")}}, tc.async)
+			if err != tc.expected {
+				t.Errorf("Expected err to be %v, got %v instead", tc.expected, err)
+			}
+
+			value, _ := s.Get("testKey")
+			if string(value) != tc.value {
+				t.Errorf("Expected value to be %s, got %s instead", tc.value, value)
+			}
+		})
+	}
+}
+
+func TestReadChangesAfter(t *testing.T) {
+	dir := t.TempDir()
+
+	testCases := []struct {
+		name      string
+		newLogger func(opts ...Option) (TransactionLogger, error)
+	}{
+		{"file", func(opts ...Option) (TransactionLogger, error) {
+			return NewFileTransactionLogger(config.LoggingConfiguration{LogFileName: filepath.Join(dir, "transactions.log")}, opts...)
+		}},
+		{"bolt", func(opts ...Option) (TransactionLogger, error) {
+			return NewBoltTransactionLogger(config.LoggingConfiguration{BoltFileName: filepath.Join(dir, "transactions.db")}, opts...)
+		}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			hub := store.NewHub()
+			w := hub.Watch("")
+			defer w.Close()
+
+			l, err := tc.newLogger(WithHub(hub))
+			if err != nil {
+				t.Fatalf("could not create logger: %v", err)
+			}
+			go l.Run()
+			defer l.Stop()
+
+			l.WritePut("testKey1", []byte("value1"))
+			l.WriteBatch([]Event{
+				{EventType: EventPut, Key: "testKey2", Value: []byte("value2"), ContentType: "text/plain"},
+				{EventType: EventDelete, Key: "testKey1"},
+			})
+			if err := <-l.WriteExpire("testKey2"); err != nil {
+				t.Fatalf("Expected err to be %v, got %v instead", nil, err)
+			}
+
+			// the changes are published with the sequence numbers they are read back with
+			var published []store.Notification
+			for len(published) < 4 {
+				published = append(published, <-w.Notifications())
+			}
+
+			read := func(seq uint64) []store.Notification {
+				var got []store.Notification
+				changes, errors := l.(Follower).ReadChangesAfter(context.Background(), seq)
+				for n := range changes {
+					got = append(got, n)
+				}
+				if err := <-errors; err != nil {
+					t.Fatalf("Expected err to be %v, got %v instead", nil, err)
+				}
+				return got
+			}
+
+			if got := read(0); !reflect.DeepEqual(got, published) {
+				t.Errorf("expected changes %v, got %v instead", published, got)
+			}
+			if got := read(published[1].Sequence); !reflect.DeepEqual(got, published[2:]) {
+				t.Errorf("expected changes %v, got %v instead", published[2:], got)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			changes, errors := l.(Follower).ReadChangesAfter(ctx, 0)
+			for range changes {
+			}
+			if err := <-errors; err != context.Canceled {
+				t.Errorf("Expected err to be %v, got %v instead", context.Canceled, err)
+			}
+		})
+	}
+}
+
+func TestReadChangesAfterCompacted(t *testing.T) {
+	dir := t.TempDir()
+
+	testCases := []struct {
+		name      string
+		newLogger func() (TransactionLogger, error)
+	}{
+		{"file", func() (TransactionLogger, error) {
+			return NewFileTransactionLogger(config.LoggingConfiguration{LogFileName: filepath.Join(dir, "transactions.log")})
+		}},
+		{"bolt", func() (TransactionLogger, error) {
+			return NewBoltTransactionLogger(config.LoggingConfiguration{BoltFileName: filepath.Join(dir, "transactions.db")})
+		}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			l, err := tc.newLogger()
+			if err != nil {
+				t.Fatalf("could not create logger: %v", err)
+			}
+			go l.Run()
+			defer l.Stop()
+
+			l.WritePut("testKey1", []byte("value1"))
+			l.WritePut("testKey2", []byte("value2"))
+			l.WritePut("testKey3", []byte("value3"))
+			if err := <-l.WritePut("testKey3", []byte("value4")); err != nil {
+				t.Fatalf("Expected err to be %v, got %v instead", nil, err)
+			}
+
+			read := func(seq uint64) ([]string, error) {
+				var keys []string
+				changes, errors := l.(Follower).ReadChangesAfter(context.Background(), seq)
+				for n := range changes {
+					keys = append(keys, n.Key)
+				}
+				return keys, <-errors
+			}
+
+			compacted := func(want uint64) {
+				seq, err := l.(Follower).Compacted()
+				if err != nil {
+					t.Fatalf("Expected err to be %v, got %v instead", nil, err)
+				}
+				if seq != want {
+					t.Errorf("Expected the log to be compacted up to %d, got %d instead", want, seq)
+				}
+			}
+
+			compacted(0)
+
+			if err := l.(Truncater).Truncate(2); err != nil {
+				t.Fatalf("Expected err to be %v, got %v instead", nil, err)
+			}
+			compacted(2)
+
+			if _, err := read(1); err != ErrorCompacted {
+				t.Errorf("Expected err to be %v, got %v instead", ErrorCompacted, err)
+			}
+			keys, err := read(2)
+			if err != nil {
+				t.Fatalf("Expected err to be %v, got %v instead", nil, err)
+			}
+			if want := []string{"testKey3", "testKey3"}; !reflect.DeepEqual(keys, want) {
+				t.Errorf("expected changes of %v, got %v instead", want, keys)
+			}
+
+			// only the overwritten put of testKey3 is dropped
+			if err := l.(Compactor).Compact(); err != nil {
+				t.Fatalf("Expected err to be %v, got %v instead", nil, err)
+			}
+			compacted(3)
+
+			if _, err := read(2); err != ErrorCompacted {
+				t.Errorf("Expected err to be %v, got %v instead", ErrorCompacted, err)
+			}
+			keys, err = read(3)
+			if err != nil {
+				t.Fatalf("Expected err to be %v, got %v instead", nil, err)
+			}
+			if want := []string{"testKey3"}; !reflect.DeepEqual(keys, want) {
+				t.Errorf("expected changes of %v, got %v instead", want, keys)
+			}
+		})
+	}
+}
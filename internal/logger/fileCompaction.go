@@ -0,0 +1,283 @@
+package logger
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// compactSuffix is appended to the name of the log to get the name of the file a compaction or a migration is written to.
+const compactSuffix = ".compact"
+
+// Compactor is implemented by loggers which are able to compact their log.
+type Compactor interface {
+	// Compact rewrites the log so that it only holds the events required to rebuild the current state.
+	Compact() error
+}
+
+// shouldCompact reports whether the file has grown enough since the last compaction
+// to be compacted online. The caller must hold the lock.
+func (l *FileTransactionLogger) shouldCompact() bool {
+	return !l.compacting && l.compactRatio > 0 && l.size >= l.minCompactSize &&
+		float64(l.size) >= l.compactRatio*float64(l.compactedSize)
+}
+
+// compactOnline compacts the file in the background and sends errors to the error channel.
+func (l *FileTransactionLogger) compactOnline() {
+	err := l.Compact()
+
+	l.Lock()
+	l.compacting = false
+	l.Unlock()
+
+	if err != nil {
+		go func() { l.errorCh <- fmt.Errorf("failed to compact the transaction log: %v", err) }()
+	}
+}
+
+// Compact rewrites the file keeping only the latest put of every live key, dropping the keys
+// which were deleted or have expired. Once the file has been truncated behind a snapshot, the
+// latest event of every key is kept instead, since the snapshot may hold keys which the deletes
+// and expired puts of the file remove. The events keep their sequence numbers.
+//
+// It is safe to call while events are being written: writers are only blocked while the events
+// written during the compaction are copied over. The compacted file is written separately and
+// atomically renamed over the file, so a crash leaves either the old or the compacted file behind.
+func (l *FileTransactionLogger) Compact() error {
+	return l.rewrite(0, func(events []Event) []Event {
+		// latest event of each key
+		latest := make(map[string]Event)
+		for _, e := range events {
+			latest[e.Key] = e
+		}
+
+		now := time.Now()
+		kept := make([]Event, 0, len(latest))
+		for _, e := range latest {
+			if l.truncated > 0 || e.EventType == EventPut && (e.ExpiresAt.IsZero() || now.Before(e.ExpiresAt)) {
+				kept = append(kept, e)
+			}
+		}
+		sort.Slice(kept, func(i, j int) bool { return kept[i].Sequence < kept[j].Sequence })
+
+		return kept
+	})
+}
+
+// LastSequence returns the sequence number of the last event written to the file.
+func (l *FileTransactionLogger) LastSequence() (uint64, error) {
+	l.Lock()
+	defer l.Unlock()
+
+	return l.lastSequence, nil
+}
+
+// Truncate rewrites the file dropping all the events up to and including the sequence number seq.
+// Like Compact, it is safe to call while events are being written.
+func (l *FileTransactionLogger) Truncate(seq uint64) error {
+	return l.rewrite(seq, func(events []Event) []Event {
+		kept := []Event{}
+		for _, e := range events {
+			if e.Sequence > seq {
+				kept = append(kept, e)
+			}
+		}
+
+		return kept
+	})
+}
+
+// rewrite replaces the file with the events returned by keep, which is given the events of the
+// file in order. keep must return a subset of the events, in order. The file records that the
+// events up to and including the sequence number truncated are covered by a snapshot, unless
+// it already records a greater one.
+func (l *FileTransactionLogger) rewrite(truncated uint64, keep func(events []Event) []Event) error {
+	l.compactionMutex.Lock()
+	defer l.compactionMutex.Unlock()
+
+	l.Lock()
+	offset := l.size
+	l.Unlock()
+
+	src, err := os.Open(l.filename)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	var events []Event
+	lastSequence, err := scanLog(io.LimitReader(src, offset), func(e Event) {
+		if e.EventType != EventCheckpoint {
+			events = append(events, e)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	if truncated < l.truncated {
+		truncated = l.truncated
+	}
+
+	kept := keep(events)
+	compacted := lastDropped(events, kept)
+	if compacted < l.compacted {
+		compacted = l.compacted
+	}
+
+	// the sequence numbers of the dropped events must not be reused
+	events = kept
+	if lastSequence > 0 {
+		events = append(events, checkpoint(lastSequence, truncated, compacted))
+	}
+
+	tmpname := l.filename + compactSuffix
+	tmp, err := os.OpenFile(tmpname, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0755)
+	if err != nil {
+		return err
+	}
+	defer tmp.Close()
+
+	err = writeCompacted(tmp, events)
+	if err != nil {
+		os.Remove(tmpname)
+		return err
+	}
+
+	l.Lock()
+	defer l.Unlock()
+
+	// the events written in the meantime all have greater sequence numbers
+	err = copyTail(tmp, src, offset)
+	if err != nil {
+		os.Remove(tmpname)
+		return err
+	}
+
+	err = os.Rename(tmpname, l.filename)
+	if err != nil {
+		os.Remove(tmpname)
+		return err
+	}
+
+	err = syncDir(filepath.Dir(l.filename))
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(l.filename, os.O_RDWR|os.O_APPEND, 0755)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	l.file.Close()
+	l.file = file
+	l.size = info.Size()
+	l.compactedSize = info.Size()
+	l.compacted = compacted
+	l.truncated = truncated
+
+	return nil
+}
+
+// checkpoint returns the checkpoint written after the events kept by a rewrite of the file, which
+// records lastSequence. Its value records the sequence number up to which the events are covered by
+// a snapshot, then the one up to which events were dropped. It may share its sequence number with the
+// last event kept.
+func checkpoint(lastSequence, truncated, compacted uint64) Event {
+	return Event{Sequence: lastSequence, EventType: EventCheckpoint, Value: appendUint64(appendUint64(nil, truncated), compacted)}
+}
+
+// checkpointMarks returns the sequence numbers up to which the events are covered by a snapshot and
+// up to which events were dropped recorded by a checkpoint. The checkpoints which do not record them
+// may follow a truncation, so both are assumed to be their sequence number.
+func checkpointMarks(e Event) (truncated, compacted uint64) {
+	if len(e.Value) != 16 {
+		return e.Sequence, e.Sequence
+	}
+	return binary.BigEndian.Uint64(e.Value), binary.BigEndian.Uint64(e.Value[8:])
+}
+
+// lastDropped returns the greatest sequence number of the events which are not kept, 0 if all of
+// them are. kept must be a subset of the events, in order.
+func lastDropped(events, kept []Event) uint64 {
+	var seq uint64
+	for _, e := range events {
+		if len(kept) > 0 && kept[0].Sequence == e.Sequence {
+			kept = kept[1:]
+		} else {
+			seq = e.Sequence
+		}
+	}
+
+	return seq
+}
+
+// withCheckpoint appends a checkpoint at lastSequence to the events, unless the last event already has
+// this sequence number, so that the sequence numbers of the markers left out are not reused. Since no
+// change is left out, it records neither a snapshot nor dropped events.
+func withCheckpoint(events []Event, lastSequence uint64) []Event {
+	if n := len(events); lastSequence > 0 && (n == 0 || events[n-1].Sequence < lastSequence) {
+		events = append(events, checkpoint(lastSequence, 0, 0))
+	}
+
+	return events
+}
+
+// writeCompacted writes the file header followed by the events to w.
+func writeCompacted(w io.Writer, events []Event) error {
+	bw := bufio.NewWriter(w)
+
+	_, err := bw.Write(fileHeader())
+	if err != nil {
+		return err
+	}
+
+	var buf []byte
+	for _, e := range events {
+		buf = encodeRecord(buf[:0], e.Sequence, e)
+		_, err := bw.Write(buf)
+		if err != nil {
+			return err
+		}
+	}
+
+	return bw.Flush()
+}
+
+// copyTail appends everything in src after offset to dst and flushes dst to the disk.
+func copyTail(dst *os.File, src *os.File, offset int64) error {
+	_, err := src.Seek(offset, io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(dst, src)
+	if err != nil {
+		return err
+	}
+
+	return dst.Sync()
+}
+
+// syncDir flushes a directory to the disk, so that a rename within it is durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
@@ -0,0 +1,230 @@
+package logger
+
+import (
+	"github.com/shubham1172/gokv/config"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// replayState replays the events of a log file into a map, and returns the number of events replayed.
+func replayState(t *testing.T, filename string) (map[string]string, int) {
+	l, err := NewFileTransactionLogger(config.LoggingConfiguration{LogFileName: filename})
+	if err != nil {
+		t.Fatalf("could not create logger: %v", err)
+	}
+	defer l.(*FileTransactionLogger).file.Close()
+
+	state := map[string]string{}
+	events := readAll(t, l)
+	for _, e := range events {
+		if e.EventType == EventPut {
+			state[e.Key] = string(e.Value)
+		} else {
+			delete(state, e.Key)
+		}
+	}
+	return state, len(events)
+}
+
+func TestFileTransactionLoggerCompact(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "transactions.log")
+
+	var events []Event
+	for i := 0; i < 10; i++ {
+		events = append(events, Event{EventType: EventBatchBegin},
+			Event{EventType: EventPut, Key: "testKey1", Value: []byte("value" + strconv.Itoa(i))},
+			Event{EventType: EventPut, Key: "testKey2", Value: []byte("value" + strconv.Itoa(i))},
+			Event{EventType: EventBatchCommit})
+	}
+	events = append(events,
+		Event{EventType: EventDelete, Key: "testKey2"},
+		Event{EventType: EventPut, Key: "testKey3", Value: []byte("value3")},
+		Event{EventType: EventPut, Key: "testKey4", Value: []byte("value4"), ExpiresAt: time.Now().Add(-time.Second)})
+
+	writeLog(t, filename, events)
+
+	before, _ := os.Stat(filename)
+	want := map[string]string{"testKey1": "value9", "testKey3": "value3", "testKey4": "value4"}
+	if state, _ := replayState(t, filename); !reflect.DeepEqual(state, want) {
+		t.Fatalf("expected state %v before compaction, got %v", want, state)
+	}
+
+	l, err := NewFileTransactionLogger(config.LoggingConfiguration{LogFileName: filename})
+	if err != nil {
+		t.Fatalf("could not create logger: %v", err)
+	}
+	fl := l.(*FileTransactionLogger)
+	if err := fl.Compact(); err != nil {
+		t.Fatalf("could not compact: %v", err)
+	}
+	fl.file.Close()
+
+	after, _ := os.Stat(filename)
+	if after.Size() >= before.Size() {
+		t.Errorf("expected the log to shrink from %d bytes, got %d bytes", before.Size(), after.Size())
+	}
+
+	// the expired key is dropped
+	delete(want, "testKey4")
+	if state, _ := replayState(t, filename); !reflect.DeepEqual(state, want) {
+		t.Errorf("expected state %v after compaction, got %v", want, state)
+	}
+
+	if _, err := os.Stat(filename + compactSuffix); !os.IsNotExist(err) {
+		t.Errorf("expected the compaction file to be removed, got %v", err)
+	}
+}
+
+func TestFileTransactionLoggerOnlineCompaction(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "transactions.log")
+
+	l, err := NewFileTransactionLogger(config.LoggingConfiguration{
+		LogFileName:       filename,
+		CompactionMinSize: 256,
+		CompactionRatio:   2,
+	})
+	if err != nil {
+		t.Fatalf("could not create logger: %v", err)
+	}
+	go l.Run()
+
+	var keys []string
+	for i := 0; i < 1000; i++ {
+		k := "testKey" + strconv.Itoa(i%10)
+		l.WriteBatch([]Event{
+			{EventType: EventPut, Key: k, Value: []byte("value" + strconv.Itoa(i))},
+			{EventType: EventPut, Key: "testOtherKey", Value: []byte("value")},
+		})
+		if i >= 990 {
+			keys = append(keys, k)
+		}
+	}
+	l.Stop()
+
+	state, n := replayState(t, filename)
+	if n >= 2000 {
+		t.Errorf("expected the log to be compacted online, got all %d events", n)
+	}
+
+	got := []string{}
+	for k := range state {
+		got = append(got, k)
+	}
+	sort.Strings(got)
+	sort.Strings(keys)
+	keys = append(keys, "testOtherKey")
+
+	if !reflect.DeepEqual(got, keys) {
+		t.Errorf("expected keys %v after compaction, got %v", keys, got)
+	}
+}
+
+func TestFileTransactionLoggerTruncate(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "transactions.log")
+
+	var events []Event
+	for i := 1; i <= 5; i++ {
+		events = append(events, Event{EventType: EventPut, Key: "testKey" + strconv.Itoa(i), Value: []byte("value")})
+	}
+	writeLog(t, filename, events)
+
+	testCases := []struct {
+		name string
+		seq  uint64
+		keys []string
+	}{
+		{"truncate some events", 3, []string{"testKey4", "testKey5"}},
+		{"truncate all events", 5, []string{}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			l, err := NewFileTransactionLogger(config.LoggingConfiguration{LogFileName: filename})
+			if err != nil {
+				t.Fatalf("could not create logger: %v", err)
+			}
+			fl := l.(*FileTransactionLogger)
+
+			if err := fl.Truncate(tc.seq); err != nil {
+				t.Fatalf("could not truncate: %v", err)
+			}
+
+			keys := []string{}
+			for _, e := range readAll(t, l) {
+				keys = append(keys, e.Key)
+			}
+			if !reflect.DeepEqual(keys, tc.keys) {
+				t.Errorf("expected keys %v, got %v instead", tc.keys, keys)
+			}
+
+			// sequence numbers are not reused after a truncation
+			if seq, _ := fl.LastSequence(); seq != 5 {
+				t.Errorf("expected last sequence 5, got %d instead", seq)
+			}
+			fl.file.Close()
+		})
+	}
+}
+
+func TestFileTransactionLoggerCompactAfterTruncate(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "transactions.log")
+
+	open := func() *FileTransactionLogger {
+		l, err := NewFileTransactionLogger(config.LoggingConfiguration{LogFileName: filename})
+		if err != nil {
+			t.Fatalf("could not create logger: %v", err)
+		}
+		return l.(*FileTransactionLogger)
+	}
+
+	writeLog(t, filename, []Event{
+		{EventType: EventPut, Key: "testKey1", Value: []byte("value1")},
+		{EventType: EventPut, Key: "testKey2", Value: []byte("value2")},
+		{EventType: EventPut, Key: "testKey3", Value: []byte("value3")},
+	})
+
+	// the snapshot holds every key, and the log only the changes made after it
+	snapshot := map[string]string{"testKey1": "value1", "testKey2": "value2", "testKey3": "value3"}
+	l := open()
+	if err := l.Truncate(3); err != nil {
+		t.Fatalf("could not truncate: %v", err)
+	}
+	go l.Run()
+	<-l.WriteDelete("testKey1")
+	<-l.WritePutWithExpiry("testKey2", []byte("value2"), time.Now().Add(-time.Second))
+	l.Stop()
+
+	l = open()
+	if err := l.Compact(); err != nil {
+		t.Fatalf("could not compact: %v", err)
+	}
+	l.file.Close()
+
+	// the keys removed after the snapshot stay removed once the log is replayed on top of it
+	l = open()
+	defer l.file.Close()
+
+	// the events removed by the truncation are still known after a restart
+	if seq, _ := l.Compacted(); seq != 3 {
+		t.Errorf("Expected the log to be compacted up to %d, got %d instead", 3, seq)
+	}
+
+	now := time.Now()
+	for _, e := range readAll(t, l) {
+		if e.EventType == EventPut && (e.ExpiresAt.IsZero() || now.Before(e.ExpiresAt)) {
+			snapshot[e.Key] = string(e.Value)
+		} else {
+			delete(snapshot, e.Key)
+		}
+	}
+
+	want := map[string]string{"testKey3": "value3"}
+	if !reflect.DeepEqual(snapshot, want) {
+		t.Errorf("expected state %v, got %v instead", want, snapshot)
+	}
+}
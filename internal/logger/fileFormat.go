@@ -0,0 +1,281 @@
+package logger
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"time"
+)
+
+// The file starts with a header made of a magic number and the version of the format,
+// followed by one record per event:
+//
+//	length   uint32  length of the payload
+//	checksum uint32  CRC-32C of the payload
+//	payload:
+//	  sequence   uint64
+//	  event type uint8
+//	  expires at int64   unix nanoseconds, 0 if the key never expires
+//	  key          uvarint length followed by the bytes
+//	  value        uvarint length followed by the bytes
+//	  content type uvarint length followed by the bytes, absent in version 1
+//	  flags        uint32, absent in versions 1 and 2
+//
+// All the integers are big endian, so keys and values may hold arbitrary bytes.
+// Version 1 and 2 records are valid version 3 records, so an older log is upgraded by rewriting its header.
+const (
+	// fileMagic identifies a binary transaction log.
+	fileMagic = "GKVL"
+	// fileVersion is the version of the format written by this logger.
+	fileVersion uint32 = 3
+	// headerSize is the size of the file header in bytes.
+	headerSize = len(fileMagic) + 4
+	// recordHeaderSize is the size of the length and checksum preceding every payload.
+	recordHeaderSize = 8
+	// minPayloadSize is the size of a payload with an empty key and value.
+	minPayloadSize = 8 + 1 + 8 + 1 + 1
+	// payloadChunkSize is the size of the chunks the payloads larger than it are read in.
+	payloadChunkSize = 64 << 10
+)
+
+var (
+	// errChecksum is returned when the checksum of a record does not match its payload.
+	errChecksum = errors.New("checksum mismatch")
+	// errMalformed is returned when the payload of a record cannot be decoded.
+	errMalformed = errors.New("malformed record")
+	// errNotBinary is returned when a file does not start with the header of a binary log.
+	errNotBinary = errors.New("not a binary transaction log")
+
+	crcTable = crc32.MakeTable(crc32.Castagnoli)
+)
+
+// fileHeader returns the header written at the start of the file.
+func fileHeader() []byte {
+	header := make([]byte, headerSize)
+	copy(header, fileMagic)
+	binary.BigEndian.PutUint32(header[len(fileMagic):], fileVersion)
+	return header
+}
+
+// readHeader reads and validates the file header, and returns the version of the format.
+func readHeader(r io.Reader) (uint32, error) {
+	header := make([]byte, headerSize)
+
+	_, err := io.ReadFull(r, header)
+	if err == io.EOF || err == io.ErrUnexpectedEOF || (err == nil && string(header[:len(fileMagic)]) != fileMagic) {
+		return 0, errNotBinary
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	version := binary.BigEndian.Uint32(header[len(fileMagic):])
+	if version == 0 || version > fileVersion {
+		return 0, fmt.Errorf("unsupported transaction log version %d, expected at most %d", version, fileVersion)
+	}
+
+	return version, nil
+}
+
+// upgradeHeader rewrites the header of a log to the version of the format written by this logger.
+// The records are left untouched, as the records of the older versions remain valid.
+func upgradeHeader(filename string) error {
+	file, err := os.OpenFile(filename, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.WriteAt(fileHeader(), 0)
+	if err == nil {
+		err = file.Sync()
+	}
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// encodeRecord appends the record of an event with the sequence number seq to buf.
+func encodeRecord(buf []byte, seq uint64, e Event) []byte {
+	start := len(buf)
+	buf = append(buf, make([]byte, recordHeaderSize)...)
+	buf = encodePayload(buf, seq, e)
+
+	payload := buf[start+recordHeaderSize:]
+	binary.BigEndian.PutUint32(buf[start:], uint32(len(payload)))
+	binary.BigEndian.PutUint32(buf[start+4:], crc32.Checksum(payload, crcTable))
+
+	return buf
+}
+
+// encodePayload appends the payload of a record of an event with the sequence number seq to buf.
+func encodePayload(buf []byte, seq uint64, e Event) []byte {
+	var expiresAt int64
+	if !e.ExpiresAt.IsZero() {
+		expiresAt = e.ExpiresAt.UnixNano()
+	}
+
+	var n [binary.MaxVarintLen64]byte
+	buf = appendUint64(buf, seq)
+	buf = append(buf, byte(e.EventType))
+	buf = appendUint64(buf, uint64(expiresAt))
+	buf = append(buf, n[:binary.PutUvarint(n[:], uint64(len(e.Key)))]...)
+	buf = append(buf, e.Key...)
+	buf = append(buf, n[:binary.PutUvarint(n[:], uint64(len(e.Value)))]...)
+	buf = append(buf, e.Value...)
+	buf = append(buf, n[:binary.PutUvarint(n[:], uint64(len(e.ContentType)))]...)
+	buf = append(buf, e.ContentType...)
+	buf = append(buf, make([]byte, 4)...)
+	binary.BigEndian.PutUint32(buf[len(buf)-4:], e.Flags)
+
+	return buf
+}
+
+// appendUint64 appends a big endian uint64 to buf.
+func appendUint64(buf []byte, v uint64) []byte {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], v)
+	return append(buf, b[:]...)
+}
+
+// readRecord reads the next record from r and returns it along with its size in bytes.
+// It returns io.EOF if there are no more records, io.ErrUnexpectedEOF if the record is incomplete,
+// errChecksum if the record is corrupted and errMalformed if it cannot be decoded.
+func readRecord(r *bufio.Reader) (Event, int64, error) {
+	var e Event
+
+	header := make([]byte, recordHeaderSize)
+	n, err := io.ReadFull(r, header)
+	if err == io.EOF {
+		return e, 0, io.EOF
+	}
+	if err != nil {
+		if n > 0 {
+			return e, 0, io.ErrUnexpectedEOF
+		}
+		return e, 0, err
+	}
+
+	length := binary.BigEndian.Uint32(header)
+	checksum := binary.BigEndian.Uint32(header[4:])
+
+	payload, err := readPayload(r, int(length))
+	if err == io.EOF {
+		return e, 0, io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return e, 0, err
+	}
+
+	if crc32.Checksum(payload, crcTable) != checksum {
+		return e, 0, errChecksum
+	}
+
+	e, err = decodePayload(payload)
+	if err != nil {
+		return e, 0, fmt.Errorf("%w: %v", errMalformed, err)
+	}
+
+	return e, int64(recordHeaderSize) + int64(length), nil
+}
+
+// readPayload reads a payload of length bytes from r. The length is not trusted before the checksum
+// is verified, so large payloads are read in chunks: a corrupted length never allocates much more
+// memory than what is left to read, and is reported as an incomplete record.
+func readPayload(r io.Reader, length int) ([]byte, error) {
+	size := length
+	if size > payloadChunkSize {
+		size = payloadChunkSize
+	}
+
+	payload := make([]byte, 0, size)
+	for len(payload) < length {
+		n := length - len(payload)
+		if n > payloadChunkSize {
+			n = payloadChunkSize
+		}
+
+		start := len(payload)
+		payload = append(payload, make([]byte, n)...)
+		_, err := io.ReadFull(r, payload[start:])
+		if err == io.EOF && start > 0 {
+			return nil, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return payload, nil
+}
+
+// decodePayload deserializes the payload of a record into an Event.
+func decodePayload(payload []byte) (Event, error) {
+	var e Event
+
+	if len(payload) < minPayloadSize {
+		return e, fmt.Errorf("malformed record of %d bytes", len(payload))
+	}
+
+	e.Sequence = binary.BigEndian.Uint64(payload)
+	e.EventType = EventType(payload[8])
+	if expiresAt := int64(binary.BigEndian.Uint64(payload[9:])); expiresAt != 0 {
+		e.ExpiresAt = time.Unix(0, expiresAt)
+	}
+
+	rest := payload[17:]
+
+	key, rest, err := readBytes(rest)
+	if err != nil {
+		return e, fmt.Errorf("malformed key: %v", err)
+	}
+
+	value, rest, err := readBytes(rest)
+	if err != nil {
+		return e, fmt.Errorf("malformed value: %v", err)
+	}
+
+	// version 1 records end with the value
+	var contentType []byte
+	if len(rest) != 0 {
+		contentType, rest, err = readBytes(rest)
+		if err != nil {
+			return e, fmt.Errorf("malformed content type: %v", err)
+		}
+	}
+
+	// version 2 records end with the content type
+	if len(rest) == 4 {
+		e.Flags = binary.BigEndian.Uint32(rest)
+		rest = rest[4:]
+	}
+
+	if len(rest) != 0 {
+		return e, fmt.Errorf("%d trailing bytes in record", len(rest))
+	}
+
+	e.Key, e.Value, e.ContentType = string(key), append([]byte(nil), value...), string(contentType)
+
+	return e, nil
+}
+
+// readBytes reads a uvarint length prefixed byte slice from buf and returns it along with the rest of buf.
+func readBytes(buf []byte) ([]byte, []byte, error) {
+	length, n := binary.Uvarint(buf)
+	if n <= 0 {
+		return nil, nil, errors.New("invalid length")
+	}
+
+	buf = buf[n:]
+	if uint64(len(buf)) < length {
+		return nil, nil, errors.New("length out of bounds")
+	}
+
+	return buf[:length], buf[length:], nil
+}
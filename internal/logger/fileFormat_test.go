@@ -0,0 +1,182 @@
+package logger
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"github.com/shubham1172/gokv/config"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRecordRoundTrip(t *testing.T) {
+	expiresAt := time.Unix(0, time.Now().Add(time.Hour).UnixNano())
+
+	testCases := []struct {
+		name string
+		e    Event
+	}{
+		{"put", Event{Sequence: 1, EventType: EventPut, Key: "testKey", Value: []byte("value")}},
+		{"delete", Event{Sequence: 2, EventType: EventDelete, Key: "testKey"}},
+		{"whitespace", Event{Sequence: 3, EventType: EventPut, Key: "test key\t1", Value: []byte("line1\nline2\r\n\t")}},
+		{"binary", Event{Sequence: 4, EventType: EventPut, Key: "\x00\xff", Value: []byte("\x00\x01\x02")}},
+		{"expiry", Event{Sequence: 5, EventType: EventPut, Key: "testKey", Value: []byte("value"), ExpiresAt: expiresAt}},
+		{"marker", Event{Sequence: 6, EventType: EventBatchBegin}},
+		{"content type", Event{Sequence: 7, EventType: EventPut, Key: "testKey", Value: []byte("{}"), ContentType: "application/json"}},
+		{"flags", Event{Sequence: 8, EventType: EventPut, Key: "testKey", Value: []byte("value"), Flags: 42}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			buf := encodeRecord(nil, tc.e.Sequence, tc.e)
+
+			got, n, err := readRecord(bufio.NewReader(bytes.NewReader(buf)))
+			if err != nil {
+				t.Fatalf("Expected err to be %v, got %v instead", nil, err)
+			}
+			if n != int64(len(buf)) {
+				t.Errorf("expected a record of %d bytes, got %d instead", len(buf), n)
+			}
+			if !got.ExpiresAt.Equal(tc.e.ExpiresAt) {
+				t.Errorf("expected expiry %v, got %v instead", tc.e.ExpiresAt, got.ExpiresAt)
+			}
+			got.ExpiresAt = tc.e.ExpiresAt
+			if !reflect.DeepEqual(got, tc.e) {
+				t.Errorf("expected event %v, got %v instead", tc.e, got)
+			}
+		})
+	}
+}
+
+func TestReadRecordErrors(t *testing.T) {
+	record := encodeRecord(nil, 1, Event{EventType: EventPut, Key: "testKey", Value: []byte("value")})
+
+	corrupted := append([]byte{}, record...)
+	corrupted[len(corrupted)-1] ^= 0xff
+
+	// a length far larger than the record, which must not be allocated upfront
+	oversized := append([]byte{}, record...)
+	binary.BigEndian.PutUint32(oversized, math.MaxUint32)
+
+	// a valid checksum over a payload which does not decode
+	malformed := encodeRecord(nil, 1, Event{EventType: EventPut, Key: "testKey"})
+	binary.BigEndian.PutUint32(malformed, 4)
+
+	testCases := []struct {
+		name string
+		buf  []byte
+		err  error
+	}{
+		{"empty", nil, io.EOF},
+		{"truncated length", record[:3], io.ErrUnexpectedEOF},
+		{"truncated payload", record[:len(record)-1], io.ErrUnexpectedEOF},
+		{"corrupted payload", corrupted, errChecksum},
+		{"corrupted length", oversized, io.ErrUnexpectedEOF},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, err := readRecord(bufio.NewReader(bytes.NewReader(tc.buf)))
+			if err != tc.err {
+				t.Errorf("Expected err to be %v, got %v instead", tc.err, err)
+			}
+		})
+	}
+
+	t.Run("malformed payload", func(t *testing.T) {
+		_, err := decodePayload(malformed[recordHeaderSize : recordHeaderSize+4])
+		if err == nil {
+			t.Errorf("expected an error, got nil instead")
+		}
+	})
+}
+
+func TestReadHeader(t *testing.T) {
+	future := fileHeader()
+	binary.BigEndian.PutUint32(future[len(fileMagic):], fileVersion+1)
+
+	v1 := fileHeader()
+	binary.BigEndian.PutUint32(v1[len(fileMagic):], 1)
+
+	testCases := []struct {
+		name   string
+		header []byte
+		err    error
+		valid  bool
+	}{
+		{"current version", fileHeader(), nil, true},
+		{"version 1", v1, nil, true},
+		{"text log", []byte("1\t1\ttestKey\tvalue\t0\n"), errNotBinary, false},
+		{"short file", []byte("1\t"), errNotBinary, false},
+		{"unknown version", future, nil, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := readHeader(bytes.NewReader(tc.header))
+			if tc.valid && err != nil || !tc.valid && err == nil {
+				t.Errorf("Expected err to be %v, got %v instead", tc.err, err)
+			}
+			if tc.err != nil && err != tc.err {
+				t.Errorf("Expected err to be %v, got %v instead", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestFileTransactionLoggerUpgrade(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "transactions.log")
+
+	// a version 1 record has neither a content type nor flags after the value
+	header := fileHeader()
+	binary.BigEndian.PutUint32(header[len(fileMagic):], 1)
+	payload := encodePayload(nil, 1, Event{EventType: EventPut, Key: "testKey1", Value: []byte("value1")})
+	payload = payload[:len(payload)-5]
+	record := make([]byte, recordHeaderSize)
+	binary.BigEndian.PutUint32(record, uint32(len(payload)))
+	binary.BigEndian.PutUint32(record[4:], crc32.Checksum(payload, crcTable))
+
+	err := ioutil.WriteFile(filename, append(header, append(record, payload...)...), 0644)
+	if err != nil {
+		t.Fatalf("could not write log: %v", err)
+	}
+
+	l, err := NewFileTransactionLogger(config.LoggingConfiguration{LogFileName: filename})
+	if err != nil {
+		t.Fatalf("could not create logger: %v", err)
+	}
+	go l.Run()
+	<-l.WriteBatch([]Event{{EventType: EventPut, Key: "testKey2", Value: []byte("{}"), ContentType: "application/json"}})
+	l.Stop()
+
+	f, err := os.Open(filename)
+	if err != nil {
+		t.Fatalf("could not open log: %v", err)
+	}
+	defer f.Close()
+
+	if version, err := readHeader(f); err != nil || version != fileVersion {
+		t.Errorf("expected the header to be upgraded to version %d, got %d (%v) instead", fileVersion, version, err)
+	}
+
+	l, err = NewFileTransactionLogger(config.LoggingConfiguration{LogFileName: filename})
+	if err != nil {
+		t.Fatalf("could not create logger: %v", err)
+	}
+	defer l.(*FileTransactionLogger).file.Close()
+
+	want := []Event{
+		{EventType: EventPut, Key: "testKey1", Value: []byte("value1")},
+		{EventType: EventPut, Key: "testKey2", Value: []byte("{}"), ContentType: "application/json"},
+	}
+	if got := stripSequences(readAll(t, l)); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected events %v, got %v instead", want, got)
+	}
+}
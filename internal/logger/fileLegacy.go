@@ -0,0 +1,130 @@
+package logger
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Logs written before the binary format are text files with one event per line made of the
+// sequence, event type, key, value and the expiry in unix nanoseconds separated by tabs.
+// Lines written before expiries existed lack the last field. Values are written as is, so they may
+// hold tabs. They are only read to be migrated.
+
+// parseLegacyLog deserializes a line of a text log into an Event.
+func parseLegacyLog(line string) (Event, error) {
+	var e Event
+
+	fields := strings.Split(line, "\t")
+	if len(fields) < 4 {
+		return e, fmt.Errorf("malformed log entry: %q", line)
+	}
+
+	seq, err := strconv.ParseUint(fields[0], 10, 64)
+	if err != nil {
+		return e, fmt.Errorf("malformed sequence number: %v", err)
+	}
+
+	eventType, err := strconv.ParseUint(fields[1], 10, 8)
+	if err != nil {
+		return e, fmt.Errorf("malformed event type: %v", err)
+	}
+
+	e.Sequence, e.EventType, e.Key = seq, EventType(eventType), fields[2]
+
+	// entries without an expiry were written before expiries existed, their value may hold tabs
+	// too, so the last field is only an expiry if it parses as one
+	var expiresAt int64
+	if len(fields) > 4 {
+		expiresAt, err = strconv.ParseInt(fields[len(fields)-1], 10, 64)
+		if err == nil {
+			fields = fields[:len(fields)-1]
+		}
+	}
+
+	e.Value = []byte(strings.Join(fields[3:], "\t"))
+	if expiresAt != 0 {
+		e.ExpiresAt = time.Unix(0, expiresAt)
+	}
+
+	return e, nil
+}
+
+// scanLegacyLog reads the events of a text log from r like scanLog does for a binary log.
+// A last line without a linebreak is a torn write.
+func scanLegacyLog(r io.Reader, fn func(e Event)) (uint64, error) {
+	br := bufio.NewReader(r)
+	var offset int64
+
+	return scanEvents(func() (Event, int64, error) {
+		line, err := br.ReadString('\n')
+		if err == io.EOF && line != "" {
+			return Event{}, offset, fmt.Errorf("%w: incomplete line %q", errTornWrite, line)
+		}
+		if err != nil {
+			return Event{}, offset, err
+		}
+		offset += int64(len(line))
+
+		e, err := parseLegacyLog(strings.TrimSuffix(line, "\n"))
+		if err != nil {
+			return e, offset, fmt.Errorf("%w: %v", errMalformed, err)
+		}
+		return e, offset, nil
+	}, fn)
+}
+
+// migrateLegacyLog rewrites the text log at filename in the binary format. The events keep their
+// sequence numbers, and like a compaction the migrated log is written separately and atomically
+// renamed over the text log. A torn write at the end of the text log is dropped with a warning,
+// unless strict is set.
+func migrateLegacyLog(filename string, strict bool) error {
+	src, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	var events []Event
+	lastSequence, err := scanLegacyLog(src, func(e Event) { events = append(events, e) })
+	if ce, ok := err.(*corruptionError); ok && ce.torn() && !strict {
+		log.Printf("dropping the end of the text transaction log %s after sequence %d, the last good one: %v",
+			filename, ce.lastSequence, ce.err)
+		err = nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// the sequence numbers of the discarded markers must not be reused
+	events = withCheckpoint(events, lastSequence)
+
+	tmpname := filename + compactSuffix
+	tmp, err := os.OpenFile(tmpname, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0755)
+	if err != nil {
+		return err
+	}
+	defer tmp.Close()
+
+	err = writeCompacted(tmp, events)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if err == nil {
+		err = os.Rename(tmpname, filename)
+	}
+	if err != nil {
+		os.Remove(tmpname)
+		return err
+	}
+
+	log.Printf("migrated %d events of the text transaction log %s to the binary format", len(events), filename)
+
+	return syncDir(filepath.Dir(filename))
+}
@@ -0,0 +1,64 @@
+package logger
+
+import (
+	"github.com/shubham1172/gokv/config"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFileTransactionLoggerMigration(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "transactions.log")
+
+	legacy := "1\t1\ttestKey1\tval\tue1\n" +
+		"2\t1\ttestKey2\tvalue\t2\t0\n" +
+		"3\t3\t\t\t0\n" +
+		"4\t0\ttestKey1\t\t0\n" +
+		"5\t4\t\t\t0\n" +
+		"6\t3\t\t\t0\n" +
+		"7\t1\ttestKey3\tvalue3\t0\n"
+	if err := ioutil.WriteFile(filename, []byte(legacy), 0755); err != nil {
+		t.Fatalf("could not write log: %v", err)
+	}
+
+	l, err := NewFileTransactionLogger(config.LoggingConfiguration{LogFileName: filename})
+	if err != nil {
+		t.Fatalf("could not create logger: %v", err)
+	}
+	fl := l.(*FileTransactionLogger)
+
+	want := []Event{
+		{EventType: EventPut, Key: "testKey1", Value: []byte("val\tue1")},
+		{EventType: EventPut, Key: "testKey2", Value: []byte("value\t2")},
+		{EventType: EventDelete, Key: "testKey1"},
+	}
+	got := stripSequences(readAll(t, l))
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected events %v, got %v instead", want, got)
+	}
+
+	// the incomplete batch is a torn write, the last good sequence is the one before it
+	if seq, _ := fl.LastSequence(); seq != 5 {
+		t.Errorf("expected last sequence 5, got %d instead", seq)
+	}
+	// the markers left out are no changes removed from the log
+	if seq, _ := fl.Compacted(); seq != 0 {
+		t.Errorf("expected no compaction, got one up to %d instead", seq)
+	}
+	if fl.truncated != 0 {
+		t.Errorf("expected no truncation, got one up to %d instead", fl.truncated)
+	}
+	fl.file.Close()
+
+	f, err := os.Open(filename)
+	if err != nil {
+		t.Fatalf("could not open log: %v", err)
+	}
+	defer f.Close()
+
+	if _, err := readHeader(f); err != nil {
+		t.Errorf("expected the log to be migrated to the binary format, got %v", err)
+	}
+}
@@ -2,92 +2,396 @@ package logger
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"fmt"
+	"github.com/shubham1172/gokv/config"
+	"github.com/shubham1172/gokv/pkg/store"
+	"io"
 	"log"
 	"os"
 	"sync"
+	"time"
 )
 
-const logFormat string = "%d\t%d\t%s\t%s\n"
-
 // FileTransactionLogger is a type that defines a logger which writes to
 // a file. It is asynchronous in nature, and is implemented using channels.
 type FileTransactionLogger struct {
 	*transactionLogger
-	sync.Mutex            // Provide locking constructs
-	lastSequence uint64   // The last used event sequence number
-	file         *os.File // Pointer to the physical file
+	sync.Mutex                 // Provide locking constructs
+	lastSequence    uint64     // The last used event sequence number
+	filename        string     // Path of the physical file
+	file            *os.File   // Pointer to the physical file
+	size            int64      // Size of the file in bytes
+	compactedSize   int64      // Size of the file after the last compaction
+	compacted       uint64     // Sequence number up to which events were removed from the file, only set by a rewrite
+	truncated       uint64     // Sequence number up to which the events removed from the file are covered by a snapshot, protected by compactionMutex
+	compactionMutex sync.Mutex // Makes sure that only one compaction runs at a time
+	compacting      bool       // Whether an online compaction has been triggered
+	minCompactSize  int64      // Size the file must reach before it is compacted online
+	compactRatio    float64    // Growth since the last compaction which triggers an online compaction
+	fsync           string     // Policy for flushing the file to the disk
+	written         int64      // Number of bytes written since the logger was created
+	synced          int64      // Number of bytes written since the logger was created which are flushed to the disk
+	syncMutex       sync.Mutex // Makes sure that only one flush runs at a time
+	failed          error      // Error which left the end of the file in an unknown state, refusing every later write
 }
 
-// NewFileTransactionLogger returns a new logger which writes to the file pointed by the filename
-func NewFileTransactionLogger(filename string) (TransactionLogger, error) {
+// NewFileTransactionLogger returns a new logger which writes to the file pointed by loggingConfig.LogFileName.
+// Every event of the file is checked first. A torn write at the end of the file is truncated with a
+// warning, unless loggingConfig.StrictRecovery is set in which case an error is returned instead.
+func NewFileTransactionLogger(loggingConfig config.LoggingConfiguration, opts ...Option) (TransactionLogger, error) {
+	filename := loggingConfig.LogFileName
+
+	fsync, err := fsyncPolicy(loggingConfig.Fsync)
+	if err != nil {
+		return nil, err
+	}
+
+	// a compaction which did not finish is simply discarded, the log is only replaced once it is complete
+	err = os.Remove(filename + compactSuffix)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("cannot remove incomplete compaction: %v", err)
+	}
+
 	file, err := os.OpenFile(filename, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0755)
 	if err != nil {
 		return nil, fmt.Errorf("cannot open transaction log file: %v", err)
 	}
 
-	return &FileTransactionLogger{transactionLogger: newTransactionLogger(), file: file}, nil
-}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("cannot stat transaction log file: %v", err)
+	}
 
-// formatLog returns a serialized version of a sequence number and an Event.
-func (l *FileTransactionLogger) formatLog(seq uint64, e Event) string {
-	return fmt.Sprintf(logFormat, seq, e.EventType, e.Key, e.Value)
-}
+	if info.Size() == 0 {
+		_, err = file.Write(fileHeader())
+	} else {
+		var version uint32
+		version, err = readHeader(io.NewSectionReader(file, 0, int64(headerSize)))
+		if err == nil && version < fileVersion {
+			err = upgradeHeader(filename)
+		}
+	}
+
+	if err == errNotBinary {
+		file.Close()
 
-// insert an Event in the file and increase the last sequence value.
-func (l *FileTransactionLogger) insert(e Event, wg *sync.WaitGroup) {
-	defer wg.Done()
+		err = migrateLegacyLog(filename, loggingConfig.StrictRecovery)
+		if err != nil {
+			return nil, fmt.Errorf("cannot migrate text transaction log: %v", err)
+		}
+
+		file, err = os.OpenFile(filename, os.O_RDWR|os.O_APPEND, 0755)
+		if err != nil {
+			return nil, fmt.Errorf("cannot open transaction log file: %v", err)
+		}
+	} else if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("cannot read transaction log header: %v", err)
+	}
+
+	info, err = file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("cannot stat transaction log file: %v", err)
+	}
+
+	var compacted, truncated uint64
+	lastSequence, err := recoverLog(file, info.Size(), loggingConfig.StrictRecovery, func(e Event) {
+		if e.EventType == EventCheckpoint {
+			truncated, compacted = checkpointMarks(e)
+		}
+	})
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("cannot recover transaction log: %v", err)
+	}
+
+	info, err = file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("cannot stat transaction log file: %v", err)
+	}
 
+	return &FileTransactionLogger{
+		transactionLogger: newTransactionLogger(opts...),
+		lastSequence:      lastSequence,
+		filename:          filename,
+		file:              file,
+		size:              info.Size(),
+		compactedSize:     info.Size(),
+		compacted:         compacted,
+		truncated:         truncated,
+		minCompactSize:    loggingConfig.CompactionMinSize,
+		compactRatio:      loggingConfig.CompactionRatio,
+		fsync:             fsync,
+	}, nil
+}
+
+// insert the events of the requests in the file in order and increase the last sequence value.
+// The events of a request are enclosed within begin and commit markers if there are more than one.
+// All the requests are written with a single write, and with FsyncAlways, the file is flushed to
+// the disk once before the result is sent to their done channels.
+//
+// If the write fails, the file is truncated back to its size before the write and the sequence
+// numbers are given to the next events. If the file cannot be truncated, every later write fails.
+func (l *FileTransactionLogger) insert(reqs []request, wg *sync.WaitGroup) {
 	l.Lock()
-	defer l.Unlock()
 
-	// the first sequence SHOULD start from 1 in order to support ReadEvents
-	l.lastSequence++
-	_, err := fmt.Fprintf(l.file, l.formatLog(l.lastSequence, e))
+	if err := l.failed; err != nil {
+		l.Unlock()
+		for _, req := range reqs {
+			req.done <- err
+		}
+		return
+	}
+
+	size, lastSequence := l.size, l.lastSequence
+
+	var buf []byte
+	var sequenced []Event
+	for _, req := range reqs {
+		events := req.events
+		if len(events) > 1 {
+			batch := make([]Event, 0, len(events)+2)
+			batch = append(batch, Event{EventType: EventBatchBegin})
+			batch = append(batch, events...)
+			events = append(batch, Event{EventType: EventBatchCommit})
+		}
+
+		for _, e := range events {
+			// the first sequence SHOULD start from 1 in order to support ReadEvents
+			l.lastSequence++
+			buf = encodeRecord(buf, l.lastSequence, e)
+
+			if l.hub != nil {
+				e.Sequence = l.lastSequence
+				sequenced = append(sequenced, e)
+			}
+		}
+	}
+
+	n, err := l.file.Write(buf)
 	if err != nil {
+		// the events written partially would be read back as a torn write, or followed by the next ones
+		l.lastSequence = lastSequence
+		n = 0
+		if truncErr := l.file.Truncate(size); truncErr != nil {
+			l.failed = fmt.Errorf("transaction log left in an unknown state by a failed write: %v", err)
+		}
 		go func() { l.errorCh <- err }()
 	}
+	l.size += int64(n)
+	l.written += int64(n)
+	written := l.written
+
+	if l.shouldCompact() {
+		l.compacting = true
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l.compactOnline()
+		}()
+	}
+
+	l.Unlock()
+
+	if err == nil && l.fsync == FsyncAlways {
+		err = l.sync(written)
+		if err != nil {
+			err = fmt.Errorf("failed to flush the transaction log: %v", err)
+			go func() { l.errorCh <- err }()
+		}
+	}
+
+	if err == nil {
+		l.publish(sequenced)
+	}
+
+	for _, req := range reqs {
+		req.done <- err
+	}
 }
 
 // ReadEvents reads the logs and replays the events on the Event channel.
 // If the transaction numbers are out of sequence, or not in monotonical ascending order,
-// it returns an error on the error channel.
+// it returns an error on the error channel. Events of a batch are only replayed once
+// its commit marker is read, an incomplete batch at the end of the log is discarded.
 func (l *FileTransactionLogger) ReadEvents() (<-chan Event, <-chan error) {
-	scanner := bufio.NewScanner(l.file)
 	outEvent := make(chan Event)
 	outError := make(chan error, 1)
 
-	go func() {
-		var e Event
+	l.Lock()
+	file, size := l.file, l.size
+	l.Unlock()
 
+	go func() {
 		defer close(outEvent)
 		defer close(outError)
 
-		for scanner.Scan() {
-			line := scanner.Text()
-			fmt.Sscanf(line, logFormat, &e.Sequence, &e.EventType, &e.Key, &e.Value)
-
-			if l.lastSequence >= e.Sequence {
-				outError <- fmt.Errorf("transaction numbers are out of sequence")
-				return
+		// the offset of the file is at its end once the header of a new file is written
+		lastSequence, err := scanLog(io.NewSectionReader(file, 0, size), func(e Event) {
+			if e.EventType != EventCheckpoint {
+				outEvent <- e
 			}
+		})
+		l.lastSequence = lastSequence
+		if err != nil {
+			outError <- err
+		}
+	}()
+
+	return outEvent, outError
+}
 
-			l.lastSequence = e.Sequence
-			outEvent <- e
+// ReadChangesAfter reads the events written to the file so far, from a copy of the file descriptor
+// opened with the lock held, so that it is not affected by the writes or the compactions running meanwhile.
+func (l *FileTransactionLogger) ReadChangesAfter(ctx context.Context, seq uint64) (<-chan store.Notification, <-chan error) {
+	l.Lock()
+	size := l.size
+	compacted := l.compacted
+	src, err := os.Open(l.filename)
+	l.Unlock()
+
+	return sendChanges(ctx, seq, func(send func(e Event) bool) error {
+		if err != nil {
+			return fmt.Errorf("cannot open transaction log file: %v", err)
 		}
+		defer src.Close()
 
-		if err := scanner.Err(); err != nil {
-			outError <- fmt.Errorf("error while reading the transaction log: %v", err)
+		if seq < compacted {
+			return ErrorCompacted
 		}
-	}()
 
-	return outEvent, outError
+		_, err = scanLog(&contextReader{ctx: ctx, r: io.LimitReader(src, size)}, func(e Event) { send(e) })
+		return err
+	})
+}
+
+// Compacted returns the sequence number of the last event removed from the file by a compaction or a truncation.
+func (l *FileTransactionLogger) Compacted() (uint64, error) {
+	l.Lock()
+	defer l.Unlock()
+
+	return l.compacted, nil
+}
+
+// contextReader is a reader which fails once its context is done.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+// scanLog reads the events of a binary log from r in order and calls fn with each of them, checkpoints
+// included. Events of a batch are only passed to fn once its commit marker is read. It returns the last
+// sequence number read, or a *corruptionError if the log cannot be read past some event.
+func scanLog(r io.Reader, fn func(e Event)) (uint64, error) {
+	br := bufio.NewReader(r)
+
+	_, err := readHeader(br)
+	if err != nil {
+		return 0, fmt.Errorf("error while reading the transaction log: %v", err)
+	}
+
+	offset := int64(headerSize)
+	return scanEvents(func() (Event, int64, error) {
+		e, n, err := readRecord(br)
+		if err != nil && err != io.EOF {
+			return e, offset, tornRecord(br, err)
+		}
+		offset += n
+		return e, offset, err
+	}, fn)
+}
+
+// scanEvents calls fn with each of the events returned by next, checkpoints included, which returns
+// them along with the offset right after them, until it returns io.EOF. It checks that the sequence numbers are ascending and holds back the events of a batch until
+// its commit marker. It returns the last sequence number read.
+// An event which cannot be read, or a batch which is never committed, is returned as a
+// *corruptionError holding the last event which was read outside of a batch.
+func scanEvents(next func() (Event, int64, error), fn func(e Event)) (uint64, error) {
+	var lastSequence uint64
+	var batch []Event // events of the batch being read, nil if outside of a batch
+	var good struct { // last event read outside of a batch
+		sequence uint64
+		offset   int64
+	}
+
+	corrupted := func(err error) (uint64, error) {
+		return good.sequence, &corruptionError{lastSequence: good.sequence, offset: good.offset, err: err}
+	}
+
+	for {
+		e, offset, err := next()
+		if err == io.EOF {
+			break
+		}
+		if errors.Is(err, errTornWrite) || errors.Is(err, errChecksum) || errors.Is(err, errMalformed) {
+			return corrupted(err)
+		}
+		if err != nil {
+			return lastSequence, fmt.Errorf("error while reading the transaction log after sequence %d: %v", lastSequence, err)
+		}
+
+		// a checkpoint may share the sequence number of the last event kept by a compaction
+		shared := e.EventType == EventCheckpoint && lastSequence > 0 && lastSequence == e.Sequence
+		if lastSequence >= e.Sequence && !shared {
+			return corrupted(fmt.Errorf("transaction numbers are out of sequence at sequence %d", e.Sequence))
+		}
+
+		lastSequence = e.Sequence
+
+		switch {
+		case e.EventType == EventCheckpoint && batch == nil:
+			fn(e)
+		case e.EventType == EventBatchBegin && batch == nil:
+			batch = []Event{}
+		case e.EventType == EventBatchCommit && batch != nil:
+			for _, be := range batch {
+				fn(be)
+			}
+			batch = nil
+		case e.EventType == EventBatchBegin || e.EventType == EventBatchCommit || e.EventType == EventCheckpoint:
+			return corrupted(fmt.Errorf("unexpected marker at sequence %d", e.Sequence))
+		case batch != nil:
+			batch = append(batch, e)
+		default:
+			fn(e)
+		}
+
+		if batch == nil {
+			good.sequence, good.offset = lastSequence, offset
+		}
+	}
+
+	// batches are written at once, so one without a commit marker was torn
+	if batch != nil {
+		return corrupted(fmt.Errorf("%w: batch of %d events without a commit marker", errTornWrite, len(batch)))
+	}
+
+	return lastSequence, nil
 }
 
 // close the file and notify shutdown complete.
 func (l *FileTransactionLogger) shutdown() {
 	close(l.eventCh)
 
+	if l.fsync != FsyncNever {
+		err := l.file.Sync()
+		if err != nil {
+			log.Fatalln(err)
+		}
+	}
+
 	err := l.file.Close()
 	if err != nil {
 		log.Fatalln(err)
@@ -100,15 +404,34 @@ func (l *FileTransactionLogger) shutdown() {
 func (l *FileTransactionLogger) Run() {
 	var wg sync.WaitGroup
 
+	// a nil channel never fires, so the file is only flushed periodically with FsyncEverySecond
+	var tick <-chan time.Time
+	if l.fsync == FsyncEverySecond {
+		ticker := time.NewTicker(syncInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
 	run := true
 	for run {
 		select {
 		// handle logging request
-		case e := <-l.eventCh:
+		// the requests are written one batch after the other, so that they are written in order
+		case req := <-l.eventCh:
+			l.insert(l.pending(req), &wg)
+		// flush the file periodically
+		case <-tick:
 			wg.Add(1)
-			go l.insert(e, &wg)
+			go func() {
+				defer wg.Done()
+				l.syncPending()
+			}()
 		// handle shutdown request
 		case _ = <-l.shutdownCh:
+			// the requests sent before Stop may not have been picked up yet
+			for len(l.eventCh) > 0 {
+				l.insert(l.pending(<-l.eventCh), &wg)
+			}
 			wg.Wait()
 			l.shutdown()
 			run = false
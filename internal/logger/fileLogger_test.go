@@ -0,0 +1,317 @@
+package logger
+
+import (
+	"github.com/shubham1172/gokv/config"
+	"github.com/shubham1172/gokv/pkg/store"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// readAll collects all the events replayed by a logger.
+func readAll(t *testing.T, l TransactionLogger) []Event {
+	var got []Event
+
+	events, errors := l.ReadEvents()
+	for e := range events {
+		got = append(got, e)
+	}
+	if err := <-errors; err != nil {
+		t.Fatalf("could not read events: %v", err)
+	}
+
+	return got
+}
+
+// writeLog writes a binary log holding the events, numbered from 1.
+func writeLog(t *testing.T, filename string, events []Event) {
+	f, err := os.Create(filename)
+	if err != nil {
+		t.Fatalf("could not create log: %v", err)
+	}
+	defer f.Close()
+
+	numbered := make([]Event, len(events))
+	for i, e := range events {
+		e.Sequence = uint64(i + 1)
+		numbered[i] = e
+	}
+
+	if err := writeCompacted(f, numbered); err != nil {
+		t.Fatalf("could not write log: %v", err)
+	}
+}
+
+// stripSequences zeroes out the sequence numbers so that events can be compared.
+func stripSequences(events []Event) []Event {
+	for i := range events {
+		events[i].Sequence = 0
+	}
+	return events
+}
+
+func TestFileTransactionLoggerNew(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "transactions.log")
+
+	open := func() TransactionLogger {
+		l, err := NewFileTransactionLogger(config.LoggingConfiguration{LogFileName: filename})
+		if err != nil {
+			t.Fatalf("could not create logger: %v", err)
+		}
+		return l
+	}
+
+	// a new log is replayed without being compacted first
+	l := open()
+	if got := readAll(t, l); len(got) != 0 {
+		t.Errorf("expected no events, got %v instead", got)
+	}
+	go l.Run()
+	if err := <-l.WritePut("testKey1", []byte("value1")); err != nil {
+		t.Fatalf("Expected err to be %v, got %v instead", nil, err)
+	}
+	l.Stop()
+
+	l = open()
+	defer l.(*FileTransactionLogger).file.Close()
+
+	want := []Event{{EventType: EventPut, Key: "testKey1", Value: []byte("value1")}}
+	if got := stripSequences(readAll(t, l)); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected events %v, got %v instead", want, got)
+	}
+}
+
+func TestFileTransactionLoggerBatch(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "transactions.log")
+
+	l, err := NewFileTransactionLogger(config.LoggingConfiguration{LogFileName: filename})
+	if err != nil {
+		t.Fatalf("could not create logger: %v", err)
+	}
+	go l.Run()
+
+	l.WriteBatch([]Event{
+		{EventType: EventPut, Key: "testKey1", Value: []byte("value1")},
+		{EventType: EventPut, Key: "testKey2", Value: []byte("value2")},
+		{EventType: EventDelete, Key: "testKey1"},
+	})
+	l.Stop()
+
+	want := []Event{
+		{EventType: EventPut, Key: "testKey1", Value: []byte("value1")},
+		{EventType: EventPut, Key: "testKey2", Value: []byte("value2")},
+		{EventType: EventDelete, Key: "testKey1"},
+	}
+
+	t.Run("complete batch is replayed", func(t *testing.T) {
+		l, err := NewFileTransactionLogger(config.LoggingConfiguration{LogFileName: filename})
+		if err != nil {
+			t.Fatalf("could not create logger: %v", err)
+		}
+		defer l.(*FileTransactionLogger).file.Close()
+
+		got := stripSequences(readAll(t, l))
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("expected events %v, got %v instead", want, got)
+		}
+	})
+
+	t.Run("incomplete batch is discarded", func(t *testing.T) {
+		f, err := os.OpenFile(filename, os.O_APPEND|os.O_WRONLY, 0755)
+		if err != nil {
+			t.Fatalf("could not open log: %v", err)
+		}
+		var buf []byte
+		buf = encodeRecord(buf, 6, Event{EventType: EventBatchBegin})
+		buf = encodeRecord(buf, 7, Event{EventType: EventPut, Key: "testKey3", Value: []byte("value3")})
+		f.Write(buf)
+		f.Close()
+
+		l, err := NewFileTransactionLogger(config.LoggingConfiguration{LogFileName: filename})
+		if err != nil {
+			t.Fatalf("could not create logger: %v", err)
+		}
+		defer l.(*FileTransactionLogger).file.Close()
+
+		got := stripSequences(readAll(t, l))
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("expected events %v, got %v instead", want, got)
+		}
+	})
+}
+
+func TestFileTransactionLoggerWriteCompletion(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "transactions.log")
+
+	l, err := NewFileTransactionLogger(config.LoggingConfiguration{LogFileName: filename, Fsync: FsyncAlways})
+	if err != nil {
+		t.Fatalf("could not create logger: %v", err)
+	}
+	go l.Run()
+	defer l.Stop()
+
+	if err := <-l.WritePut("testKey1", []byte("value1")); err != nil {
+		t.Fatalf("Expected err to be %v, got %v instead", nil, err)
+	}
+
+	// the event is in the file once the write is complete
+	f, err := os.Open(filename)
+	if err != nil {
+		t.Fatalf("could not open log: %v", err)
+	}
+	defer f.Close()
+
+	var got []Event
+	if _, err := scanLog(f, func(e Event) { got = append(got, e) }); err != nil {
+		t.Fatalf("could not read log: %v", err)
+	}
+
+	want := []Event{{EventType: EventPut, Key: "testKey1", Value: []byte("value1")}}
+	if !reflect.DeepEqual(stripSequences(got), want) {
+		t.Errorf("expected events %v, got %v instead", want, got)
+	}
+
+	if err := <-l.WriteBatch(nil); err != nil {
+		t.Errorf("Expected err to be %v, got %v instead", nil, err)
+	}
+}
+
+func TestFileTransactionLoggerWriteError(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "transactions.log")
+
+	l, err := NewFileTransactionLogger(config.LoggingConfiguration{LogFileName: filename})
+	if err != nil {
+		t.Fatalf("could not create logger: %v", err)
+	}
+	fl := l.(*FileTransactionLogger)
+	go l.Run()
+
+	if err := <-l.WritePut("testKey1", []byte("value1")); err != nil {
+		t.Fatalf("Expected err to be %v, got %v instead", nil, err)
+	}
+
+	// writes to a file opened read-only fail, and so does its truncation
+	fl.Lock()
+	fl.file.Close()
+	fl.file, err = os.Open(filename)
+	size := fl.size
+	fl.Unlock()
+	if err != nil {
+		t.Fatalf("could not open log: %v", err)
+	}
+
+	if err := <-l.WritePut("testKey2", []byte("value2")); err == nil {
+		t.Fatalf("expected the write to fail, got nil instead")
+	}
+	<-l.Err()
+
+	// the end of the file is left as is, so the next writes are refused
+	if err := <-l.WritePut("testKey3", []byte("value3")); err == nil {
+		t.Fatalf("expected the next write to be refused, got nil instead")
+	}
+
+	if seq, _ := fl.LastSequence(); seq != 1 {
+		t.Errorf("expected last sequence 1, got %d instead", seq)
+	}
+	fl.Lock()
+	if fl.size != size {
+		t.Errorf("expected size %d, got %d instead", size, fl.size)
+	}
+	fl.Unlock()
+	l.Stop()
+
+	l, err = NewFileTransactionLogger(config.LoggingConfiguration{LogFileName: filename, StrictRecovery: true})
+	if err != nil {
+		t.Fatalf("could not create logger: %v", err)
+	}
+	defer l.(*FileTransactionLogger).file.Close()
+
+	want := []Event{{EventType: EventPut, Key: "testKey1", Value: []byte("value1")}}
+	if got := stripSequences(readAll(t, l)); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected events %v, got %v instead", want, got)
+	}
+}
+
+func TestFileTransactionLoggerOrder(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "transactions.log")
+
+	l, err := NewFileTransactionLogger(config.LoggingConfiguration{LogFileName: filename})
+	if err != nil {
+		t.Fatalf("could not create logger: %v", err)
+	}
+	go l.Run()
+
+	var want []Event
+	for i := 0; i < 1000; i++ {
+		e := Event{EventType: EventPut, Key: "testKey", Value: []byte("value" + strconv.Itoa(i))}
+		if i%2 == 1 {
+			e = Event{EventType: EventDelete, Key: "testKey"}
+		}
+		want = append(want, e)
+
+		// the writes are not waited for, yet they are logged in order
+		if e.EventType == EventPut {
+			l.WritePut(e.Key, e.Value)
+		} else {
+			l.WriteDelete(e.Key)
+		}
+	}
+	l.Stop()
+
+	l, err = NewFileTransactionLogger(config.LoggingConfiguration{LogFileName: filename})
+	if err != nil {
+		t.Fatalf("could not create logger: %v", err)
+	}
+	defer l.(*FileTransactionLogger).file.Close()
+
+	got := stripSequences(readAll(t, l))
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected the events to be replayed in the order they were written")
+	}
+}
+
+func TestFileTransactionLoggerMaxSizes(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "transactions.log")
+
+	l, err := NewFileTransactionLogger(config.LoggingConfiguration{LogFileName: filename}, WithMaxSizes(8, 2<<20))
+	if err != nil {
+		t.Fatalf("could not create logger: %v", err)
+	}
+	go l.Run()
+
+	large := strings.Repeat("v", 2<<20)
+
+	testCases := []struct {
+		name  string
+		key   string
+		value string
+		err   error
+	}{
+		{"large value", "testKey1", large, nil},
+		{"key too large", "testKey10", "value", store.ErrorKeySizeTooLarge},
+		{"value too large", "testKey2", large + "v", store.ErrorValueSizeTooLarge},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := <-l.WritePut(tc.key, []byte(tc.value)); err != tc.err {
+				t.Errorf("Expected err to be %v, got %v instead", tc.err, err)
+			}
+		})
+	}
+	l.Stop()
+
+	l, err = NewFileTransactionLogger(config.LoggingConfiguration{LogFileName: filename})
+	if err != nil {
+		t.Fatalf("could not create logger: %v", err)
+	}
+	defer l.(*FileTransactionLogger).file.Close()
+
+	got := readAll(t, l)
+	if len(got) != 1 || string(got[0].Value) != large {
+		t.Errorf("expected only the large value to be written, got %d events", len(got))
+	}
+}
@@ -0,0 +1,99 @@
+package logger
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+)
+
+// errTornWrite is wrapped by the errors of an event which was only partially written to the end of
+// the log, which is expected if the process stops in the middle of a write.
+var errTornWrite = errors.New("torn write at the end of the log")
+
+// corruptionError is returned when the log cannot be read past the event with the sequence number
+// lastSequence, which ends at offset. The events up to and including lastSequence are intact.
+type corruptionError struct {
+	lastSequence uint64 // Sequence number of the last good event, outside of any batch
+	offset       int64  // Offset in bytes right after the last good event
+	err          error
+}
+
+func (e *corruptionError) Error() string {
+	return fmt.Sprintf("transaction log is corrupted after sequence %d: %v", e.lastSequence, e.err)
+}
+
+// torn reports whether only the end of the log, which was being written, is corrupted.
+func (e *corruptionError) torn() bool {
+	return errors.Is(e.err, errTornWrite)
+}
+
+// tornRecord classifies an error returned by readRecord. Incomplete records, and corrupted records
+// which are only followed by zeros, are torn writes. Anything else is returned unchanged.
+func tornRecord(r *bufio.Reader, err error) error {
+	if err == io.ErrUnexpectedEOF {
+		return fmt.Errorf("%w: %v", errTornWrite, err)
+	}
+
+	if err != errChecksum && !errors.Is(err, errMalformed) {
+		return err
+	}
+
+	// some file systems fill the end of the file with zeros after a crash
+	zeros, readErr := zeroTail(r)
+	if readErr != nil {
+		return readErr
+	}
+	if zeros {
+		return fmt.Errorf("%w: %v", errTornWrite, err)
+	}
+
+	return err
+}
+
+// zeroTail reports whether r only holds zeros until its end.
+func zeroTail(r io.Reader) (bool, error) {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := r.Read(buf)
+		for _, b := range buf[:n] {
+			if b != 0 {
+				return false, nil
+			}
+		}
+		if err == io.EOF {
+			return true, nil
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+}
+
+// recoverLog checks every event of file, which holds size bytes, calls fn with each of them like
+// scanLog and returns the last sequence number. A torn write at the end of the file is truncated with
+// a warning, unless strict is set. Any other corruption is returned as an error.
+func recoverLog(file *os.File, size int64, strict bool, fn func(e Event)) (uint64, error) {
+	lastSequence, err := scanLog(io.NewSectionReader(file, 0, size), fn)
+
+	ce, ok := err.(*corruptionError)
+	if !ok || !ce.torn() {
+		return lastSequence, err
+	}
+
+	if strict {
+		return lastSequence, fmt.Errorf("%v, refusing to truncate it in strict mode", err)
+	}
+
+	log.Printf("truncating %d bytes at the end of the transaction log %s after sequence %d, the last good one: %v",
+		size-ce.offset, file.Name(), ce.lastSequence, ce.err)
+
+	err = file.Truncate(ce.offset)
+	if err != nil {
+		return lastSequence, err
+	}
+
+	return ce.lastSequence, file.Sync()
+}
@@ -0,0 +1,103 @@
+package logger
+
+import (
+	"github.com/shubham1172/gokv/config"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFileTransactionLoggerRecovery(t *testing.T) {
+	events := []Event{
+		{EventType: EventPut, Key: "testKey1", Value: []byte("value1")},
+		{EventType: EventPut, Key: "testKey2", Value: []byte("value2")},
+		{EventType: EventDelete, Key: "testKey1"},
+	}
+
+	last := encodeRecord(nil, 4, Event{EventType: EventPut, Key: "testKey3", Value: []byte("value3")})
+	corrupted := append([]byte{}, last...)
+	corrupted[len(corrupted)-1] ^= 0xff
+
+	var batch []byte
+	batch = encodeRecord(batch, 4, Event{EventType: EventBatchBegin})
+	batch = encodeRecord(batch, 5, Event{EventType: EventPut, Key: "testKey3", Value: []byte("value3")})
+
+	testCases := []struct {
+		name string
+		tail []byte
+		torn bool
+	}{
+		{"incomplete record", last[:len(last)-3], true},
+		{"incomplete header", last[:5], true},
+		{"corrupted last record", corrupted, true},
+		{"zeros", make([]byte, 64), true},
+		{"incomplete batch", batch, true},
+		{"corrupted record followed by records", append(corrupted, encodeRecord(nil, 5, events[0])...), false},
+	}
+
+	for _, tc := range testCases {
+		for _, strict := range []bool{false, true} {
+			name := tc.name
+			if strict {
+				name += " in strict mode"
+			}
+
+			t.Run(name, func(t *testing.T) {
+				filename := filepath.Join(t.TempDir(), "transactions.log")
+				writeLog(t, filename, events)
+				good, _ := os.Stat(filename)
+
+				f, err := os.OpenFile(filename, os.O_APPEND|os.O_WRONLY, 0755)
+				if err != nil {
+					t.Fatalf("could not open log: %v", err)
+				}
+				f.Write(tc.tail)
+				f.Close()
+
+				loggingConfig := config.LoggingConfiguration{LogFileName: filename, StrictRecovery: strict}
+				l, err := NewFileTransactionLogger(loggingConfig)
+				if !tc.torn || strict {
+					if err == nil {
+						l.(*FileTransactionLogger).file.Close()
+						t.Fatalf("expected an error, got nil instead")
+					}
+					// the last good sequence is reported
+					if !strings.Contains(err.Error(), "after sequence 3") {
+						t.Errorf("expected the error to report sequence 3, got %v", err)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("could not create logger: %v", err)
+				}
+				fl := l.(*FileTransactionLogger)
+
+				if info, _ := os.Stat(filename); info.Size() != good.Size() {
+					t.Errorf("expected the log to be truncated to %d bytes, got %d bytes", good.Size(), info.Size())
+				}
+				if seq, _ := fl.LastSequence(); seq != 3 {
+					t.Errorf("expected last sequence 3, got %d instead", seq)
+				}
+
+				// the log can be written to after the recovery
+				go l.Run()
+				l.WritePut("testKey3", []byte("value3"))
+				l.Stop()
+
+				l, err = NewFileTransactionLogger(loggingConfig)
+				if err != nil {
+					t.Fatalf("could not create logger: %v", err)
+				}
+				defer l.(*FileTransactionLogger).file.Close()
+
+				want := append(append([]Event{}, events...), Event{EventType: EventPut, Key: "testKey3", Value: []byte("value3")})
+				got := stripSequences(readAll(t, l))
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("expected events %v, got %v instead", want, got)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package logger
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+const (
+	// FsyncAlways flushes the file to the disk before a write is complete.
+	// Concurrent writes share a single flush.
+	FsyncAlways = "always"
+	// FsyncEverySecond flushes the file to the disk once every second,
+	// so that at most a second of writes is lost on a power failure.
+	FsyncEverySecond = "everysec"
+	// FsyncNever leaves flushing the file to the operating system.
+	FsyncNever = "never"
+
+	// syncInterval is the interval between two flushes with FsyncEverySecond.
+	syncInterval = time.Second
+)
+
+// ErrorInvalidFsync is returned when the fsync policy is unknown.
+var ErrorInvalidFsync = errors.New("Invalid fsync policy")
+
+// fsyncPolicy validates an fsync policy, an empty policy defaults to FsyncEverySecond.
+func fsyncPolicy(policy string) (string, error) {
+	switch policy {
+	case "":
+		return FsyncEverySecond, nil
+	case FsyncAlways, FsyncEverySecond, FsyncNever:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("%w: %q", ErrorInvalidFsync, policy)
+	}
+}
+
+// sync flushes the file to the disk, so that at least the first written bytes written by the logger are durable.
+//
+// This is a group commit: while a flush is running, the writers which need their bytes flushed
+// wait for it to finish, and the first of them flushes the bytes of all of them at once.
+func (l *FileTransactionLogger) sync(written int64) error {
+	l.syncMutex.Lock()
+	defer l.syncMutex.Unlock()
+
+	if l.synced >= written {
+		// flushed along with the bytes of another writer
+		return nil
+	}
+
+	l.Lock()
+	file, written := l.file, l.written
+	l.Unlock()
+
+	err := file.Sync()
+	if errors.Is(err, os.ErrClosed) {
+		// the file was replaced by a rewrite, which flushed everything that was written to it
+		err = nil
+	}
+	if err != nil {
+		return err
+	}
+
+	l.synced = written
+
+	return nil
+}
+
+// syncPending flushes all the bytes written so far to the disk and sends errors to the error channel.
+func (l *FileTransactionLogger) syncPending() {
+	l.Lock()
+	written := l.written
+	l.Unlock()
+
+	err := l.sync(written)
+	if err != nil {
+		go func() { l.errorCh <- fmt.Errorf("failed to flush the transaction log: %v", err) }()
+	}
+}
@@ -0,0 +1,99 @@
+package logger
+
+import (
+	"errors"
+	"github.com/shubham1172/gokv/config"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFsyncPolicy(t *testing.T) {
+	testCases := []struct {
+		policy string
+		want   string
+		err    error
+	}{
+		{"", FsyncEverySecond, nil},
+		{FsyncAlways, FsyncAlways, nil},
+		{FsyncEverySecond, FsyncEverySecond, nil},
+		{FsyncNever, FsyncNever, nil},
+		{"sometimes", "", ErrorInvalidFsync},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.policy, func(t *testing.T) {
+			got, err := fsyncPolicy(tc.policy)
+			if !errors.Is(err, tc.err) {
+				t.Errorf("Expected err to be %v, got %v instead", tc.err, err)
+			}
+			if got != tc.want {
+				t.Errorf("expected policy %q, got %q instead", tc.want, got)
+			}
+		})
+	}
+}
+
+// synced returns the number of bytes written by the logger and the number of them which were flushed.
+func synced(l *FileTransactionLogger) (int64, int64) {
+	l.syncMutex.Lock()
+	defer l.syncMutex.Unlock()
+	l.Lock()
+	defer l.Unlock()
+
+	return l.written, l.synced
+}
+
+func TestFileTransactionLoggerFsync(t *testing.T) {
+	testCases := []struct {
+		policy string
+		wait   time.Duration
+		synced bool
+	}{
+		{FsyncAlways, time.Second, true},
+		{FsyncEverySecond, 3 * syncInterval, true},
+		{FsyncNever, time.Second, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.policy, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "transactions.log")
+
+			l, err := NewFileTransactionLogger(config.LoggingConfiguration{LogFileName: filename, Fsync: tc.policy})
+			if err != nil {
+				t.Fatalf("could not create logger: %v", err)
+			}
+			fl := l.(*FileTransactionLogger)
+			go l.Run()
+			defer l.Stop()
+
+			// concurrent writers share flushes
+			var wg sync.WaitGroup
+			var size int64
+			for i := 0; i < 100; i++ {
+				size += int64(len(encodeRecord(nil, 0, Event{EventType: EventPut, Key: "testKey" + strconv.Itoa(i), Value: []byte("value")})))
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					l.WritePut("testKey"+strconv.Itoa(i), []byte("value"))
+				}(i)
+			}
+			wg.Wait()
+
+			deadline := time.Now().Add(tc.wait)
+			for {
+				written, flushed := synced(fl)
+				if written == size && (flushed == written) == tc.synced {
+					return
+				}
+				if time.Now().After(deadline) {
+					t.Fatalf("expected %d bytes to be written and flushed %v, got %d bytes written and %d flushed",
+						size, tc.synced, written, flushed)
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+		})
+	}
+}
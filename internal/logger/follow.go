@@ -0,0 +1,73 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"github.com/shubham1172/gokv/pkg/store"
+	"strings"
+	"time"
+)
+
+// followKeepAlive is the interval without changes after which the keepAlive function of Follow is called.
+const followKeepAlive = 15 * time.Second
+
+// Follow sends the changes received by watcher to send until ctx is done, send fails or the watcher falls
+// behind, which is returned as store.ErrorWatcherLagged. If follower is not nil, the changes after the
+// sequence number since are first read back from it, so that a watcher registered before Follow is called
+// misses no change, or ErrorCompacted is returned if some were removed from it. keepAlive, if not nil,
+// is called whenever no change was sent for 15 seconds.
+func Follow(ctx context.Context, watcher *store.Watcher, follower Follower, since uint64,
+	send func(n store.Notification) error, keepAlive func() error) error {
+	last := since // sequence number of the last change read from the log
+
+	// stops reading the log if send fails
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if follower != nil {
+		changes, errors := follower.ReadChangesAfter(ctx, since)
+		for n := range changes {
+			last = n.Sequence
+			if !strings.HasPrefix(n.Key, watcher.Prefix()) {
+				continue
+			}
+			if err := send(n); err != nil {
+				return err
+			}
+		}
+		if err := <-errors; err != nil {
+			return fmt.Errorf("failed to read the changes from the transaction log: %w", err)
+		}
+	}
+
+	// a nil channel never fires
+	var tick <-chan time.Time
+	if keepAlive != nil {
+		ticker := time.NewTicker(followKeepAlive)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		var err error
+
+		select {
+		case n, ok := <-watcher.Notifications():
+			if !ok {
+				return watcher.Err()
+			}
+			// the changes read from the log may have been published after the watcher was registered
+			if n.Sequence > last {
+				err = send(n)
+			}
+		case <-tick:
+			err = keepAlive()
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
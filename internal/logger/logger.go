@@ -1,5 +1,12 @@
 package logger
 
+import (
+	"context"
+	"errors"
+	"github.com/shubham1172/gokv/pkg/store"
+	"time"
+)
+
 // EventType is the type of event used by the logger.
 type EventType byte
 
@@ -8,6 +15,20 @@ const (
 	EventDelete EventType = iota
 	// EventPut represents put operations.
 	EventPut
+	// EventExpire represents keys removed after their time to live ran out.
+	EventExpire
+	// EventBatchBegin marks the start of a batch of events which are applied atomically.
+	// It is only used within the log and is never returned by ReadEvents.
+	EventBatchBegin
+	// EventBatchCommit marks the end of a batch of events which are applied atomically.
+	// It is only used within the log and is never returned by ReadEvents.
+	EventBatchCommit
+	// EventCheckpoint records the last sequence number used by events which were removed from
+	// the log, so that sequence numbers keep ascending, and the sequence number up to which they
+	// are covered by a snapshot. It is never returned by ReadEvents.
+	EventCheckpoint
+	// EventEvict represents keys evicted once the store reached its limits.
+	EventEvict
 )
 
 // Event describes an operation in the transaction.
@@ -20,24 +41,51 @@ type Event struct {
 	// Key which is this transaction is operating on.
 	Key string
 	// Value is only present if the EventType is EventPut.
-	Value string
+	Value []byte
+	// ContentType is the media type of the value, empty if unknown.
+	// It is only present if the EventType is EventPut.
+	ContentType string
+	// Flags are the opaque flags of the value.
+	// They are only present if the EventType is EventPut.
+	Flags uint32
+	// ExpiresAt is the time after which the key expires.
+	// It is only present if the EventType is EventPut and is zero if the key never expires.
+	ExpiresAt time.Time
 }
 
 // TransactionLogger provides a contract that every logger implements.
 type TransactionLogger interface {
+	// The WriteXXX functions return a channel which receives nil once the
+	// events are persisted to the log, or the error which prevented it.
+	// The channel is buffered, so it can safely be ignored. Events are
+	// written in the order the WriteXXX functions are called.
+
 	// WriteDelete writes a delete event to the log
 	// with the key to being deleted.
-	WriteDelete(key string)
+	WriteDelete(key string) <-chan error
 
 	// WritePut writes a put event to the log
 	// along with the key-value pair being put.
-	WritePut(key, value string)
+	WritePut(key string, value []byte) <-chan error
+
+	// WritePutWithExpiry writes a put event to the log
+	// along with the key-value pair being put and its expiry.
+	WritePutWithExpiry(key string, value []byte, expiresAt time.Time) <-chan error
+
+	// WriteExpire writes an expire event to the log
+	// with the key which has expired.
+	WriteExpire(key string) <-chan error
+
+	// WriteBatch writes a list of put and delete events to the log
+	// as a single unit, so that either all or none of them are read back.
+	WriteBatch(events []Event) <-chan error
 
 	// Err returns a channel to read errors from.
 	Err() <-chan error
 
 	// ReadEvents sends all the events from the log to the Event
 	// channel. It also returns an error channel.
+	// Events of a batch are only sent if the whole batch was written.
 	ReadEvents() (<-chan Event, <-chan error)
 
 	// Run a message loop to consume the logs from the channels
@@ -52,32 +100,175 @@ type TransactionLogger interface {
 	Stop()
 }
 
+// Truncater is implemented by loggers which are able to drop the events covered by a snapshot.
+type Truncater interface {
+	// LastSequence returns the sequence number of the last event written to the log.
+	LastSequence() (uint64, error)
+
+	// Truncate removes all the events up to and including the sequence number seq from the log.
+	Truncate(seq uint64) error
+}
+
+// Follower is implemented by loggers which can be read while they are running,
+// so that watchers can catch up on the changes they missed.
+type Follower interface {
+	// ReadChangesAfter sends the changes persisted to the log with a sequence number greater than seq
+	// to the Notification channel in order, until there are none left or ctx is done. If some of them
+	// were removed from the log by a compaction or a snapshot, ErrorCompacted is returned instead.
+	ReadChangesAfter(ctx context.Context, seq uint64) (<-chan store.Notification, <-chan error)
+
+	// Compacted returns the sequence number up to which changes may have been removed from the log
+	// by a compaction or a snapshot, so that they cannot be read after a smaller one.
+	Compacted() (uint64, error)
+}
+
+// ErrorCompacted is returned when the changes after a sequence number cannot be read back since
+// some of them were removed from the log by a compaction or a snapshot.
+var ErrorCompacted = errors.New("Changes removed from the transaction log")
+
+// maxPendingRequests is the number of requests which can be sent to a logger before the senders
+// are blocked, and the maximum number of requests which are written at once.
+const maxPendingRequests = 1024
+
+// request is a batch of events to write to the log.
+type request struct {
+	events []Event
+	done   chan error // Receives the result of the write, buffered so that it never blocks
+}
+
 // transactionLogger provides common fields and methods related to TransactionLogger
 type transactionLogger struct {
-	eventCh            chan Event    // Channel for sending events
+	eventCh            chan request  // Channel for sending batches of events
 	errorCh            chan error    // Channel for receiving errors
 	shutdownCh         chan struct{} // Channel for initiating shutdown
 	shutdownCompleteCh chan struct{} // Channel for receiving shutdown complete signal
+	maxKeySize         int           // Max permissible size of the key of an event
+	maxValueSize       int           // Max permissible size of the value of an event
+	hub                *store.Hub    // Hub notified of the events once they are persisted, nil if none
+}
+
+// Option configures a logger.
+type Option func(*transactionLogger)
+
+// WithMaxSizes sets the max permissible sizes of the keys and values of the events written to the log,
+// which default to the ones of the store. They should match the limits of the store being logged.
+func WithMaxSizes(maxKeySize, maxValueSize int) Option {
+	return func(l *transactionLogger) {
+		l.maxKeySize = maxKeySize
+		l.maxValueSize = maxValueSize
+	}
+}
+
+// WithHub publishes the changes to h once they are persisted to the log, along with their sequence numbers.
+// The store must then not publish them to h too with store.WithHub.
+func WithHub(h *store.Hub) Option {
+	return func(l *transactionLogger) {
+		l.hub = h
+	}
 }
 
-// newTransactionLogger returns a struct instance with sane defaults.
-func newTransactionLogger() *transactionLogger {
-	return &transactionLogger{
-		eventCh:            make(chan Event, 16),
+// newTransactionLogger returns a struct instance with sane defaults, configured with the given options.
+func newTransactionLogger(opts ...Option) *transactionLogger {
+	l := &transactionLogger{
+		eventCh:            make(chan request, maxPendingRequests),
 		errorCh:            make(chan error, 1),
 		shutdownCh:         make(chan struct{}),
 		shutdownCompleteCh: make(chan struct{}),
+		maxKeySize:         store.MaxKeySize,
+		maxValueSize:       store.MaxValueSize,
+	}
+
+	for _, opt := range opts {
+		opt(l)
+	}
+
+	return l
+}
+
+// write sends a batch of events to the eventCh and returns the channel receiving the result.
+// Batches holding an event larger than permitted are refused without being sent.
+func (l *transactionLogger) write(events []Event) <-chan error {
+	done := make(chan error, 1)
+
+	for _, e := range events {
+		if len(e.Key) > l.maxKeySize {
+			done <- store.ErrorKeySizeTooLarge
+			return done
+		}
+		if len(e.Value) > l.maxValueSize {
+			done <- store.ErrorValueSizeTooLarge
+			return done
+		}
 	}
+
+	l.eventCh <- request{events: events, done: done}
+	return done
 }
 
 // WriteDelete sends an EventDelete to eventCh.
-func (l *transactionLogger) WriteDelete(key string) {
-	l.eventCh <- Event{EventType: EventDelete, Key: key}
+func (l *transactionLogger) WriteDelete(key string) <-chan error {
+	return l.write([]Event{{EventType: EventDelete, Key: key}})
 }
 
 // WritePut sends an EventPut to the eventCh.
-func (l *transactionLogger) WritePut(key, value string) {
-	l.eventCh <- Event{EventType: EventPut, Key: key, Value: value}
+func (l *transactionLogger) WritePut(key string, value []byte) <-chan error {
+	return l.write([]Event{{EventType: EventPut, Key: key, Value: value}})
+}
+
+// WritePutWithExpiry sends an EventPut with an expiry to the eventCh.
+func (l *transactionLogger) WritePutWithExpiry(key string, value []byte, expiresAt time.Time) <-chan error {
+	return l.write([]Event{{EventType: EventPut, Key: key, Value: value, ExpiresAt: expiresAt}})
+}
+
+// WriteExpire sends an EventExpire to the eventCh.
+func (l *transactionLogger) WriteExpire(key string) <-chan error {
+	return l.write([]Event{{EventType: EventExpire, Key: key}})
+}
+
+// WriteBatch sends a batch of events to the eventCh.
+func (l *transactionLogger) WriteBatch(events []Event) <-chan error {
+	if len(events) == 0 {
+		done := make(chan error, 1)
+		done <- nil
+		return done
+	}
+	return l.write(events)
+}
+
+// publish sends the events persisted to the log to the hub. The events must hold their sequence numbers,
+// and be published in the order they were written.
+func (l *transactionLogger) publish(events []Event) {
+	if l.hub == nil {
+		return
+	}
+
+	ns := make([]store.Notification, 0, len(events))
+	for _, e := range events {
+		if n, ok := notification(e); ok {
+			ns = append(ns, n)
+		}
+	}
+
+	l.hub.Publish(ns)
+}
+
+// pending returns req along with the requests which are already waiting in eventCh,
+// so that they can be written at once. The requests are returned in the order they were sent.
+func (l *transactionLogger) pending(req request) []request {
+	reqs := []request{req}
+	for len(reqs) < maxPendingRequests {
+		select {
+		case req, ok := <-l.eventCh:
+			if !ok {
+				return reqs
+			}
+			reqs = append(reqs, req)
+		default:
+			return reqs
+		}
+	}
+
+	return reqs
 }
 
 // Err returns a channel that can be used to receive errors from.
@@ -1,27 +1,40 @@
 package logger
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
-	_ "github.com/lib/pq" // Anonymous import for sql driver
+	"github.com/lib/pq"
 	"github.com/shubham1172/gokv/config"
 	"github.com/shubham1172/gokv/pkg/store"
 	"log"
-	"sync"
+	"time"
 )
 
-// Table name where transactions are stored.
-const transactionTableName = "transactions"
+const (
+	// defaultSchema is the schema of the transaction table if it is not configured.
+	defaultSchema = "public"
+	// defaultTableName is the name of the transaction table if it is not configured.
+	defaultTableName = "transactions"
+)
+
+// defaultBatchSize is the number of events flushed at once if the batch size is not configured.
+const defaultBatchSize = 1000
 
 // PostgresTransactionLogger is a type that defines a logger which
 // writes to a postgres instance.
 type PostgresTransactionLogger struct {
 	*transactionLogger
-	db *sql.DB // Database interface
+	db         *sql.DB       // Database interface
+	schema     string        // Schema of the transaction table
+	tableName  string        // Name of the transaction table
+	table      string        // Quoted qualified name of the transaction table
+	batchSize  int           // Number of events after which a batch is flushed
+	maxLatency time.Duration // Time after which a batch is flushed even if it is not full
 }
 
 // NewPostgresTransactionLogger returns a new logger which writes to the postgres instance pointed by the parameters.
-func NewPostgresTransactionLogger(dbConfig config.DatabaseConfiguration) (TransactionLogger, error) {
+func NewPostgresTransactionLogger(dbConfig config.DatabaseConfiguration, opts ...Option) (TransactionLogger, error) {
 	connStr := fmt.Sprintf("host=%s dbname=%s user=%s password=%s sslmode=%s",
 		dbConfig.Host, dbConfig.DBName, dbConfig.User, dbConfig.Password, dbConfig.SslStatus)
 
@@ -35,74 +48,276 @@ func NewPostgresTransactionLogger(dbConfig config.DatabaseConfiguration) (Transa
 		return nil, fmt.Errorf("failed to connect to the database: %v", err)
 	}
 
-	l := &PostgresTransactionLogger{transactionLogger: newTransactionLogger(), db: db}
+	l := &PostgresTransactionLogger{
+		transactionLogger: newTransactionLogger(opts...),
+		db:                db,
+		schema:            dbConfig.Schema,
+		tableName:         dbConfig.Table,
+		batchSize:         dbConfig.BatchSize,
+		maxLatency:        dbConfig.BatchMaxLatency,
+	}
+	if l.schema == "" {
+		l.schema = defaultSchema
+	}
+	if l.tableName == "" {
+		l.tableName = defaultTableName
+	}
+	if l.batchSize <= 0 {
+		l.batchSize = defaultBatchSize
+	}
+	l.table = qualifiedName(l.schema, l.tableName)
 
-	exists, err := l.verifyTableExists()
-	if err != nil {
-		return nil, fmt.Errorf("failed to verify if table exists: %v", err)
+	if err = l.migrate(); err != nil {
+		return nil, fmt.Errorf("failed to migrate the transaction table: %v", err)
 	}
-	if !exists {
-		if err = l.createTable(); err != nil {
-			return nil, fmt.Errorf("failed to create table: %v", err)
+
+	return l, nil
+}
+
+// batch returns req along with the requests sent after it, until the batch holds batchSize events
+// or maxLatency has passed since req was received. The requests which are already waiting are
+// always added to the batch, even if maxLatency is zero.
+func (l *PostgresTransactionLogger) batch(req request) []request {
+	reqs := []request{req}
+	n := len(req.events)
+
+	var timeout <-chan time.Time
+	if l.maxLatency > 0 {
+		timer := time.NewTimer(l.maxLatency)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	for n < l.batchSize {
+		var ok bool
+
+		select {
+		case req, ok = <-l.eventCh:
+		default:
+			if timeout == nil {
+				return reqs
+			}
+
+			select {
+			case req, ok = <-l.eventCh:
+			case <-timeout:
+				return reqs
+			}
+		}
+
+		if !ok {
+			return reqs
 		}
+		reqs = append(reqs, req)
+		n += len(req.events)
 	}
 
-	return l, nil
+	return reqs
 }
 
-// verify if the table transactionTableName exists or not.
-func (l *PostgresTransactionLogger) verifyTableExists() (bool, error) {
-	q := `SELECT to_regclass($1)`
+// insert the events of the requests in order within a single database transaction,
+// and send the result to their done channels.
+func (l *PostgresTransactionLogger) insert(reqs []request) {
+	var events []Event
+	for _, req := range reqs {
+		events = append(events, req.events...)
+	}
 
-	rows, err := l.db.Query(q, transactionTableName)
+	err := l.insertTx(events)
 	if err != nil {
-		return false, err
+		go func() { l.errorCh <- err }()
+	} else {
+		l.publish(events)
 	}
-	defer rows.Close()
 
-	for rows.Next() {
-		var tableName string
-		rows.Scan(&tableName)
+	for _, req := range reqs {
+		req.done <- err
+	}
+}
 
-		// pg returned (null)
-		if tableName == "" {
-			return false, nil
+// insertTx copies the events to the database within a database transaction, so that either all or none of them are stored.
+// The rows are streamed with COPY rather than inserted one round trip at a time. If the events are published to a hub,
+// their ids are drawn beforehand so that the events are published with them, and they are set as the events' sequence numbers.
+func (l *PostgresTransactionLogger) insertTx(events []Event) error {
+	tx, err := l.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	columns := []string{"event_type", "key", "value", "content_type", "flags", "expires_at"}
+	if l.hub != nil {
+		err = l.nextIDs(tx, events)
+		if err != nil {
+			tx.Rollback()
+			return err
 		}
+		columns = append(columns, "id")
+	}
 
-		return true, nil
+	stmt, err := tx.Prepare(pq.CopyInSchema(l.schema, l.tableName, columns...))
+	if err != nil {
+		tx.Rollback()
+		return err
 	}
 
-	return false, nil
+	for _, e := range events {
+		expiresAt := sql.NullTime{Time: e.ExpiresAt, Valid: !e.ExpiresAt.IsZero()}
+		contentType := sql.NullString{String: e.ContentType, Valid: e.ContentType != ""}
+		flags := sql.NullInt64{Int64: int64(e.Flags), Valid: e.Flags != 0}
+
+		args := []interface{}{e.EventType, e.Key, e.Value, contentType, flags, expiresAt}
+		if l.hub != nil {
+			args = append(args, e.Sequence)
+		}
+
+		_, err = stmt.Exec(args...)
+		if err != nil {
+			stmt.Close()
+			tx.Rollback()
+			return err
+		}
+	}
+
+	// flush the rows
+	_, err = stmt.Exec()
+	if err != nil {
+		stmt.Close()
+		tx.Rollback()
+		return err
+	}
+
+	err = stmt.Close()
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
 }
 
-// create the transactionTableName table in the database.
-func (l *PostgresTransactionLogger) createTable() error {
-	q := `CREATE TABLE %s (
-		id SERIAL PRIMARY KEY,
-		event_type INTEGER NOT NULL,
-		key VARCHAR(%d),
-		value VARCHAR (%d)
-	);
-	`
-	_, err := l.db.Exec(fmt.Sprintf(q, transactionTableName, store.MaxKeySize, store.MaxValueSize))
+// nextIDs draws an id for each event from the sequence of the id column, in ascending order,
+// and sets it as the sequence number of the event.
+func (l *PostgresTransactionLogger) nextIDs(tx *sql.Tx, events []Event) error {
+	q := `SELECT nextval(pg_get_serial_sequence($1, 'id')) AS id FROM generate_series(1, $2) ORDER BY id`
+
+	rows, err := tx.Query(q, l.table, len(events))
 	if err != nil {
 		return err
 	}
+	defer rows.Close()
+
+	i := 0
+	for ; rows.Next() && i < len(events); i++ {
+		err = rows.Scan(&events[i].Sequence)
+		if err != nil {
+			return err
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	if i != len(events) {
+		return fmt.Errorf("expected %d ids, got %d instead", len(events), i)
+	}
 
 	return nil
 }
 
-// insert an event in the database.
-func (l *PostgresTransactionLogger) insert(e Event, wg *sync.WaitGroup) {
-	defer wg.Done()
+// ReadChangesAfter queries the events with an id greater than seq. The changes were truncated from
+// the database if the checkpoint is among them.
+func (l *PostgresTransactionLogger) ReadChangesAfter(ctx context.Context, seq uint64) (<-chan store.Notification, <-chan error) {
+	return sendChanges(ctx, seq, func(send func(e Event) bool) error {
+		q := `SELECT id, event_type, key, value, content_type, flags, expires_at FROM ` + l.table + ` WHERE id > $1 ORDER BY id`
 
-	q := `INSERT INTO ` + transactionTableName +
-		`(event_type, key, value) VALUES ($1, $2, $3)`
+		rows, err := l.db.QueryContext(ctx, q, seq)
+		if err != nil {
+			return fmt.Errorf("sql query error: %v", err)
+		}
+		defer rows.Close()
 
-	_, err := l.db.Exec(q, e.EventType, e.Key, e.Value)
+		for rows.Next() {
+			e, err := scanEvent(rows)
+			if err != nil {
+				return fmt.Errorf("error while reading row: %v", err)
+			}
+			// the checkpoint left by a truncation precedes every other event
+			if e.EventType == EventCheckpoint {
+				return ErrorCompacted
+			}
+			if !send(e) {
+				return nil
+			}
+		}
+
+		return rows.Err()
+	})
+}
+
+// scanEvent reads an event from a row holding its id, event_type, key, value, content_type, flags and expires_at.
+func scanEvent(rows *sql.Rows) (Event, error) {
+	var e Event
+	var contentType sql.NullString
+	var flags sql.NullInt64
+	var expiresAt sql.NullTime
+
+	err := rows.Scan(&e.Sequence, &e.EventType, &e.Key, &e.Value, &contentType, &flags, &expiresAt)
 	if err != nil {
-		go func() { l.errorCh <- err }()
+		return e, err
+	}
+
+	e.ContentType = contentType.String
+	e.Flags = uint32(flags.Int64)
+	if expiresAt.Valid {
+		e.ExpiresAt = expiresAt.Time
+	}
+
+	return e, nil
+}
+
+// LastSequence returns the id of the last event inserted in the database.
+func (l *PostgresTransactionLogger) LastSequence() (uint64, error) {
+	var seq uint64
+
+	q := `SELECT COALESCE(MAX(id), 0) FROM ` + l.table
+	err := l.db.QueryRow(q).Scan(&seq)
+
+	return seq, err
+}
+
+// Truncate deletes all the events up to and including the id seq from the database.
+// The ids keep ascending as they are generated by a sequence. The event with the id seq
+// is replaced by a checkpoint rather than deleted, which records the truncation.
+func (l *PostgresTransactionLogger) Truncate(seq uint64) error {
+	tx, err := l.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	q := `DELETE FROM ` + l.table + ` WHERE id < $1`
+	_, err = tx.Exec(q, seq)
+	if err != nil {
+		tx.Rollback()
+		return err
 	}
+
+	q = `UPDATE ` + l.table + ` SET event_type = $2, key = '', value = NULL, content_type = NULL, flags = NULL, expires_at = NULL WHERE id = $1`
+	_, err = tx.Exec(q, seq, EventCheckpoint)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Compacted returns the id of the checkpoint left by the last truncation, 0 if there is none.
+func (l *PostgresTransactionLogger) Compacted() (uint64, error) {
+	var seq uint64
+
+	q := `SELECT COALESCE(MAX(id), 0) FROM ` + l.table + ` WHERE event_type = $1`
+	err := l.db.QueryRow(q, EventCheckpoint).Scan(&seq)
+
+	return seq, err
 }
 
 // close the database and notify shutdown complete.
@@ -126,7 +341,7 @@ func (l *PostgresTransactionLogger) ReadEvents() (<-chan Event, <-chan error) {
 		defer close(outEvent)
 		defer close(outError)
 
-		q := `SELECT id, event_type, key, value FROM ` + transactionTableName + ` ORDER BY id`
+		q := `SELECT id, event_type, key, value, content_type, flags, expires_at FROM ` + l.table + ` ORDER BY id`
 
 		rows, err := l.db.Query(q)
 		if err != nil {
@@ -136,15 +351,15 @@ func (l *PostgresTransactionLogger) ReadEvents() (<-chan Event, <-chan error) {
 
 		defer rows.Close()
 
-		e := Event{}
-
 		for rows.Next() {
-			err = rows.Scan(&e.Sequence, &e.EventType, &e.Key, &e.Value)
+			e, err := scanEvent(rows)
 			if err != nil {
 				outError <- fmt.Errorf("error while reading row: %v", err)
 				return
 			}
-			outEvent <- e
+			if e.EventType != EventCheckpoint {
+				outEvent <- e
+			}
 		}
 
 		err = rows.Err()
@@ -158,18 +373,18 @@ func (l *PostgresTransactionLogger) ReadEvents() (<-chan Event, <-chan error) {
 
 // Run the logger by handling logging requests and shutdown gracefully if required.
 func (l *PostgresTransactionLogger) Run() {
-	var wg sync.WaitGroup
-
 	run := true
 	for run {
 		select {
-		// handle logging request
-		case e := <-l.eventCh:
-			wg.Add(1)
-			go l.insert(e, &wg)
+		// handle logging request, one batch after the other so that they are inserted in order
+		case req := <-l.eventCh:
+			l.insert(l.batch(req))
 		// handle shutdown request
 		case _ = <-l.shutdownCh:
-			wg.Wait()
+			// the requests sent before Stop may not have been picked up yet
+			for len(l.eventCh) > 0 {
+				l.insert(l.pending(<-l.eventCh))
+			}
 			l.shutdown()
 			run = false
 		}
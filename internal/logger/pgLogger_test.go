@@ -0,0 +1,56 @@
+package logger
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPostgresTransactionLoggerBatch(t *testing.T) {
+	testCases := []struct {
+		name       string
+		batchSize  int
+		maxLatency time.Duration
+		sent       []int // number of events of the requests sent before the batch is collected
+		late       []int // number of events of the requests sent while the batch is collected
+		want       int   // number of requests in the batch
+	}{
+		{"no latency takes waiting requests", 10, 0, []int{1, 1, 1}, []int{1}, 3},
+		{"full batch", 3, time.Second, []int{1, 2, 1}, nil, 2},
+		{"large request", 3, time.Second, []int{5, 1}, nil, 1},
+		{"latency waits for requests", 4, time.Second, []int{1}, []int{1, 2}, 3},
+		{"latency elapsed", 10, 50 * time.Millisecond, []int{1}, nil, 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			l := &PostgresTransactionLogger{
+				transactionLogger: newTransactionLogger(),
+				batchSize:         tc.batchSize,
+				maxLatency:        tc.maxLatency,
+			}
+
+			newRequest := func(n int) request {
+				return request{events: make([]Event, n), done: make(chan error, 1)}
+			}
+
+			for _, n := range tc.sent[1:] {
+				l.eventCh <- newRequest(n)
+			}
+
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				for _, n := range tc.late {
+					time.Sleep(10 * time.Millisecond)
+					l.eventCh <- newRequest(n)
+				}
+			}()
+
+			reqs := l.batch(newRequest(tc.sent[0]))
+			if len(reqs) != tc.want {
+				t.Errorf("expected %d requests in the batch, got %d instead", tc.want, len(reqs))
+			}
+			<-done
+		})
+	}
+}
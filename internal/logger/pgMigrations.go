@@ -0,0 +1,144 @@
+package logger
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/lib/pq"
+)
+
+// schemaVersionTableName is the table recording the migrations applied to each transaction table.
+const schemaVersionTableName = "schema_version"
+
+// migration is a change to the schema of the transaction table. Its statements are formatted
+// with the qualified name of the table as their only argument, use %[1]s to refer to it.
+type migration struct {
+	version     int
+	description string
+	statements  []string
+}
+
+// migrations are applied in order, each exactly once. They must never be modified once released,
+// changes to the schema are made by appending a new migration.
+var migrations = []migration{
+	{
+		version:     1,
+		description: "create the transaction table",
+		// tables created before schema versioning existed already have this schema
+		statements: []string{`CREATE TABLE IF NOT EXISTS %[1]s (
+			id SERIAL PRIMARY KEY,
+			event_type INTEGER NOT NULL,
+			key VARCHAR(1024),
+			value VARCHAR(1024)
+		)`},
+	},
+	{
+		version:     2,
+		description: "add the expiry of keys",
+		statements:  []string{`ALTER TABLE %[1]s ADD COLUMN IF NOT EXISTS expires_at TIMESTAMPTZ`},
+	},
+	{
+		version:     3,
+		description: "lift the size limits of keys and values",
+		// the limits are configurable and enforced before the events reach the table
+		statements: []string{`ALTER TABLE %[1]s ALTER COLUMN key TYPE TEXT, ALTER COLUMN value TYPE TEXT`},
+	},
+	{
+		version:     4,
+		description: "store values as bytes along with their content type",
+		statements: []string{
+			`ALTER TABLE %[1]s ALTER COLUMN value TYPE BYTEA USING convert_to(value, 'UTF8')`,
+			`ALTER TABLE %[1]s ADD COLUMN IF NOT EXISTS content_type TEXT`,
+		},
+	},
+	{
+		version:     5,
+		description: "store the flags of values",
+		// flags are unsigned 32-bit integers, which do not fit in an INTEGER
+		statements: []string{`ALTER TABLE %[1]s ADD COLUMN IF NOT EXISTS flags BIGINT`},
+	},
+}
+
+// qualifiedName returns the quoted name of a table within a schema.
+func qualifiedName(schema, table string) string {
+	return pq.QuoteIdentifier(schema) + "." + pq.QuoteIdentifier(table)
+}
+
+// migrate brings the schema of the transaction table up to date by applying the migrations which
+// were not applied yet, within a single database transaction. Concurrent migrations of the same
+// database are serialized, and a schema newer than the known migrations is refused.
+func (l *PostgresTransactionLogger) migrate() error {
+	// the public schema always exists, and creating it may not be permitted
+	if l.schema != "public" {
+		_, err := l.db.Exec(`CREATE SCHEMA IF NOT EXISTS ` + pq.QuoteIdentifier(l.schema))
+		if err != nil {
+			return fmt.Errorf("failed to create schema: %v", err)
+		}
+	}
+
+	versionTable := qualifiedName(l.schema, schemaVersionTableName)
+
+	_, err := l.db.Exec(`CREATE TABLE IF NOT EXISTS ` + versionTable + ` (
+		table_name TEXT NOT NULL,
+		version INTEGER NOT NULL,
+		description TEXT NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+		PRIMARY KEY (table_name, version)
+	)`)
+	if err != nil {
+		return fmt.Errorf("failed to create the schema version table: %v", err)
+	}
+
+	tx, err := l.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	err = l.migrateTx(tx, versionTable)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// migrateTx applies the pending migrations within tx.
+func (l *PostgresTransactionLogger) migrateTx(tx *sql.Tx, versionTable string) error {
+	// held until the end of the transaction, so that only one process migrates at a time
+	_, err := tx.Exec(`LOCK TABLE ` + versionTable + ` IN EXCLUSIVE MODE`)
+	if err != nil {
+		return fmt.Errorf("failed to lock the schema version table: %v", err)
+	}
+
+	var current int
+	err = tx.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM `+versionTable+` WHERE table_name = $1`, l.tableName).Scan(&current)
+	if err != nil {
+		return fmt.Errorf("failed to read the schema version: %v", err)
+	}
+
+	latest := migrations[len(migrations)-1].version
+	if current > latest {
+		return fmt.Errorf("schema version %d of table %s is newer than the latest supported version %d", current, l.table, latest)
+	}
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+
+		for _, stmt := range m.statements {
+			_, err = tx.Exec(fmt.Sprintf(stmt, l.table))
+			if err != nil {
+				return fmt.Errorf("failed to apply migration %d (%s): %v", m.version, m.description, err)
+			}
+		}
+
+		_, err = tx.Exec(`INSERT INTO `+versionTable+` (table_name, version, description) VALUES ($1, $2, $3)`,
+			l.tableName, m.version, m.description)
+		if err != nil {
+			return fmt.Errorf("failed to record migration %d: %v", m.version, err)
+		}
+	}
+
+	return nil
+}
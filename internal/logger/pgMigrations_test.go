@@ -0,0 +1,45 @@
+package logger
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestMigrations(t *testing.T) {
+	for i, m := range migrations {
+		if m.version != i+1 {
+			t.Errorf("expected migration %d to have version %d, got %d instead", i, i+1, m.version)
+		}
+		if m.description == "" || len(m.statements) == 0 {
+			t.Errorf("expected migration %d to have a description and statements", m.version)
+		}
+
+		for _, stmt := range m.statements {
+			q := fmt.Sprintf(stmt, qualifiedName("public", "transactions"))
+			if strings.Contains(q, "%!") || !strings.Contains(q, `"public"."transactions"`) {
+				t.Errorf("expected migration %d to be formatted with the table name, got %q", m.version, q)
+			}
+		}
+	}
+}
+
+func TestQualifiedName(t *testing.T) {
+	testCases := []struct {
+		schema string
+		table  string
+		want   string
+	}{
+		{"public", "transactions", `"public"."transactions"`},
+		{"gokv", "Events", `"gokv"."Events"`},
+		{"gokv", `my"table`, `"gokv"."my""table"`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.want, func(t *testing.T) {
+			if got := qualifiedName(tc.schema, tc.table); got != tc.want {
+				t.Errorf("expected %s, got %s instead", tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+// Package snapshot persists point-in-time copies of a store, each tagged with the sequence
+// number of the last event of the transaction log which it covers.
+package snapshot
+
+import (
+	"fmt"
+	"github.com/shubham1172/gokv/pkg/store"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	filePrefix = "snapshot-"
+	fileSuffix = ".json"
+	tmpSuffix  = ".tmp"
+)
+
+// filename returns the name of the snapshot file covering the events up to seq.
+func filename(seq uint64) string {
+	return fmt.Sprintf("%s%020d%s", filePrefix, seq, fileSuffix)
+}
+
+// list returns the sequence numbers of the snapshots in dir in ascending order.
+func list(dir string) ([]uint64, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var seqs []uint64
+	for _, f := range files {
+		name := f.Name()
+		if !strings.HasPrefix(name, filePrefix) || !strings.HasSuffix(name, fileSuffix) {
+			continue
+		}
+
+		seq, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, filePrefix), fileSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		seqs = append(seqs, seq)
+	}
+
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+	return seqs, nil
+}
+
+// Save writes a snapshot of s covering the events up to seq to dir, and removes the older snapshots.
+// The snapshot is written to a temporary file first and renamed once complete, so that a crash
+// never leaves a partial snapshot behind.
+func Save(dir string, seq uint64, s *store.Store) error {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return fmt.Errorf("cannot create snapshot directory: %v", err)
+	}
+
+	name := filepath.Join(dir, filename(seq))
+	tmp, err := os.Create(name + tmpSuffix)
+	if err != nil {
+		return fmt.Errorf("cannot create snapshot: %v", err)
+	}
+
+	err = s.WriteSnapshot(tmp)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(name+tmpSuffix, name)
+	}
+	if err != nil {
+		os.Remove(name + tmpSuffix)
+		return fmt.Errorf("cannot write snapshot: %v", err)
+	}
+
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	err = d.Sync()
+	d.Close()
+	if err != nil {
+		return err
+	}
+
+	seqs, err := list(dir)
+	if err != nil {
+		return err
+	}
+	for _, old := range seqs {
+		if old < seq {
+			os.Remove(filepath.Join(dir, filename(old)))
+		}
+	}
+
+	return nil
+}
+
+// Load puts the key-value pairs of the newest snapshot in dir in s, and returns the sequence
+// number of the last event it covers. It returns 0 if there is no snapshot.
+func Load(dir string, s *store.Store) (uint64, error) {
+	seqs, err := list(dir)
+	if err != nil || len(seqs) == 0 {
+		return 0, err
+	}
+
+	seq := seqs[len(seqs)-1]
+	f, err := os.Open(filepath.Join(dir, filename(seq)))
+	if err != nil {
+		return 0, fmt.Errorf("cannot open snapshot: %v", err)
+	}
+	defer f.Close()
+
+	err = s.LoadSnapshot(f)
+	if err != nil {
+		return 0, fmt.Errorf("cannot load snapshot %s: %v", f.Name(), err)
+	}
+
+	return seq, nil
+}
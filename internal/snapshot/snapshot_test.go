@@ -0,0 +1,51 @@
+package snapshot
+
+import (
+	"github.com/shubham1172/gokv/pkg/store"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSaveLoad(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "snapshots")
+
+	t.Run("no snapshot", func(t *testing.T) {
+		seq, err := Load(dir, store.New())
+		if seq != 0 || err != nil {
+			t.Errorf("expected (0, nil), got (%d, %v) instead", seq, err)
+		}
+	})
+
+	s := store.New()
+	s.Put("testKey1", []byte("value1"))
+	if err := Save(dir, 7, s); err != nil {
+		t.Fatalf("could not save snapshot: %v", err)
+	}
+
+	s.Put("testKey2", []byte("value2"))
+	if err := Save(dir, 42, s); err != nil {
+		t.Fatalf("could not save snapshot: %v", err)
+	}
+
+	// leftovers of a crash while saving are ignored
+	ioutil.WriteFile(filepath.Join(dir, filename(50)+tmpSuffix), []byte("{"), 0644)
+
+	t.Run("newest snapshot is loaded", func(t *testing.T) {
+		s := store.New()
+		seq, err := Load(dir, s)
+		if seq != 42 || err != nil {
+			t.Fatalf("expected (42, nil), got (%d, %v) instead", seq, err)
+		}
+		if v, _ := s.Get("testKey2"); string(v) != "value2" {
+			t.Errorf("expected value2, got %s instead", v)
+		}
+	})
+
+	t.Run("older snapshots are removed", func(t *testing.T) {
+		if _, err := os.Stat(filepath.Join(dir, filename(7))); !os.IsNotExist(err) {
+			t.Errorf("expected the older snapshot to be removed, got %v", err)
+		}
+	})
+}
@@ -2,21 +2,27 @@ package main
 
 import (
 	"fmt"
+	"github.com/shubham1172/gokv/api/v1/grpcserver"
+	"github.com/shubham1172/gokv/api/v1/memcachedserver"
+	"github.com/shubham1172/gokv/api/v1/redisserver"
 	"github.com/shubham1172/gokv/api/v1/server"
 	"github.com/shubham1172/gokv/config"
 	"github.com/shubham1172/gokv/internal/logger"
+	"github.com/shubham1172/gokv/internal/snapshot"
 	"github.com/shubham1172/gokv/pkg/store"
 	"log"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 )
 
 // Port to start the server on.
 const Port = 8000
 
-// This will read the events from the log and replay them to make sure that the internal state is upto date.
-func initializeTransactionLogger(tlogger logger.TransactionLogger) error {
+// This will read the events from the log and replay them on the store to make sure that the internal state is upto date.
+// Events up to and including the sequence number afterSeq are already covered by a snapshot and are skipped.
+func initializeTransactionLogger(tlogger logger.TransactionLogger, s *store.Store, afterSeq uint64) error {
 	var err error
 
 	events, errors := tlogger.ReadEvents()
@@ -27,19 +33,70 @@ func initializeTransactionLogger(tlogger logger.TransactionLogger) error {
 		case err, ok = <-errors:
 			// return this error
 		case e, ok = <-events:
+			if e.Sequence <= afterSeq {
+				continue
+			}
+
 			// replay the event
 			switch e.EventType {
-			case logger.EventDelete:
-				err = store.Delete(e.Key)
+			case logger.EventDelete, logger.EventExpire, logger.EventEvict:
+				err = s.Delete(e.Key)
 			case logger.EventPut:
-				err = store.Put(e.Key, e.Value)
+				// keys which expired while the process was down are not resurrected
+				_, _, err = s.Apply([]store.Op{
+					{Type: store.OpPut, Key: e.Key, Value: e.Value, ContentType: e.ContentType, Flags: e.Flags, ExpiresAt: e.ExpiresAt},
+				})
 			}
 		}
 	}
 
+	// the events may be closed before the error is picked up
+	if err == nil {
+		err = <-errors
+	}
+
 	return err
 }
 
+// takeSnapshot saves a snapshot of the store and truncates the events it covers from the log.
+// The sequence number is read before the store is copied, so that every event it covers has
+// already been applied to the store. Events applied in the meantime are replayed on top.
+func takeSnapshot(dir string, s *store.Store, t logger.Truncater) error {
+	seq, err := t.LastSequence()
+	if err != nil {
+		return fmt.Errorf("cannot read the last sequence number: %v", err)
+	}
+
+	err = snapshot.Save(dir, seq, s)
+	if err != nil {
+		return err
+	}
+
+	return t.Truncate(seq)
+}
+
+// newEngine returns the storage engine of the store described by the configuration.
+func newEngine(storageConfig config.StorageConfiguration) (store.Engine, error) {
+	if storageConfig.Engine == "memory" {
+		return store.NewMemoryEngine(0), nil
+	} else if storageConfig.Engine == "bolt" {
+		if storageConfig.MaxKeySize > store.MaxBoltKeySize {
+			return nil, fmt.Errorf("the bolt engine supports keys of up to %d bytes", store.MaxBoltKeySize)
+		}
+
+		e, err := store.NewBoltEngine(storageConfig.Path)
+		if err != nil {
+			return nil, err
+		}
+		if storageConfig.CacheSize > 0 {
+			e = store.NewCachedEngine(e, storageConfig.CacheSize)
+		}
+		return e, nil
+	}
+
+	return nil, fmt.Errorf("invalid storage engine defined; supported: memory, bolt")
+}
+
 func main() {
 	configuration, err := config.GetConfiguration()
 	if err != nil {
@@ -48,32 +105,119 @@ func main() {
 
 	var tlogger logger.TransactionLogger
 
+	// the changes are published to the watchers once they are persisted to the log
+	hub := store.NewHub()
+	loggerOpts := []logger.Option{
+		logger.WithMaxSizes(configuration.Storage.MaxKeySize, configuration.Storage.MaxValueSize),
+		logger.WithHub(hub),
+	}
+
 	if configuration.Logging.LogType == "file" {
-		tlogger, err = logger.NewFileTransactionLogger(configuration.Logging.LogFileName)
+		tlogger, err = logger.NewFileTransactionLogger(configuration.Logging, loggerOpts...)
 	} else if configuration.Logging.LogType == "database" {
-		tlogger, err = logger.NewPostgresTransactionLogger(configuration.Database)
+		tlogger, err = logger.NewPostgresTransactionLogger(configuration.Database, loggerOpts...)
+	} else if configuration.Logging.LogType == "bolt" {
+		tlogger, err = logger.NewBoltTransactionLogger(configuration.Logging, loggerOpts...)
 	} else {
-		err = fmt.Errorf("invalid logtype defined; supported: file, database")
+		err = fmt.Errorf("invalid logtype defined; supported: file, database, bolt")
 	}
 	if err != nil {
 		log.Fatalf("failed to create a new instance of logger: %v", err)
 	}
 
-	err = initializeTransactionLogger(tlogger)
+	if c, ok := tlogger.(logger.Compactor); ok && configuration.Logging.CompactOnStartup {
+		if err = c.Compact(); err != nil {
+			log.Fatalf("failed to compact the transaction log: %v", err)
+		}
+	}
+
+	engine, err := newEngine(configuration.Storage)
+	if err != nil {
+		log.Fatalf("failed to create the storage engine: %v", err)
+	}
+
+	policy, err := store.ParseEvictionPolicy(configuration.Storage.EvictionPolicy)
+	if err != nil {
+		log.Fatalf("failed to read the eviction policy: %v", err)
+	}
+
+	// the log is replayed on top of the pairs held by a persistent engine, which ends up in the same state
+	s, err := store.Open(engine,
+		store.WithMaxKeySize(configuration.Storage.MaxKeySize),
+		store.WithMaxValueSize(configuration.Storage.MaxValueSize),
+		store.WithMaxKeys(configuration.Storage.MaxKeys),
+		store.WithMaxMemory(configuration.Storage.MaxMemory),
+		store.WithEvictionPolicy(policy))
+	if err != nil {
+		log.Fatalf("failed to open the store: %v", err)
+	}
+
+	seq, err := snapshot.Load(configuration.Logging.SnapshotDir, s)
+	if err != nil {
+		log.Fatalf("failed to load snapshot: %v", err)
+	}
+
+	err = initializeTransactionLogger(tlogger, s, seq)
 	if err != nil {
 		log.Fatalf("failed to initialize logger: %v", err)
 	}
 
+	// every change is logged from now on in the order it is applied, including expirations
+	// so that replay does not depend on the clock
+	s.SetCommitFunc(logger.CommitFunc(tlogger))
+
+	if t, ok := tlogger.(logger.Truncater); ok && configuration.Logging.SnapshotInterval > 0 {
+		go func() {
+			for range time.Tick(configuration.Logging.SnapshotInterval) {
+				if err := takeSnapshot(configuration.Logging.SnapshotDir, s, t); err != nil {
+					log.Printf("failed to take snapshot: %v", err)
+				}
+			}
+		}()
+	}
+
 	sigchan := make(chan os.Signal, 1)
 	signal.Notify(sigchan, syscall.SIGINT, syscall.SIGTERM)
 	go func() {
 		for sig := range sigchan {
 			log.Printf("captured %v, exiting..", sig)
+			s.Close()
 			tlogger.Stop()
+			engine.Close()
 			os.Exit(1)
 		}
 	}()
 
+	opts := []server.Option{server.WithMaxTxnSize(configuration.Server.MaxTxnSize), server.WithHub(hub)}
+	if configuration.Logging.AsyncWrites {
+		opts = append(opts, server.WithAsyncWrites())
+	}
+
 	go tlogger.Run()
-	server.Start(configuration.Server.Address, tlogger)
+
+	if configuration.Server.GRPCAddress != "" {
+		grpcOpts := []grpcserver.Option{grpcserver.WithMaxTxnSize(configuration.Server.MaxTxnSize), grpcserver.WithHub(hub)}
+		if configuration.Logging.AsyncWrites {
+			grpcOpts = append(grpcOpts, grpcserver.WithAsyncWrites())
+		}
+		go grpcserver.Start(configuration.Server.GRPCAddress, s, tlogger, grpcOpts...)
+	}
+
+	if configuration.Server.RedisAddress != "" {
+		redisOpts := []redisserver.Option{redisserver.WithHub(hub)}
+		if configuration.Logging.AsyncWrites {
+			redisOpts = append(redisOpts, redisserver.WithAsyncWrites())
+		}
+		go redisserver.Start(configuration.Server.RedisAddress, s, redisOpts...)
+	}
+
+	if configuration.Memcached.Enabled {
+		var memcachedOpts []memcachedserver.Option
+		if configuration.Logging.AsyncWrites {
+			memcachedOpts = append(memcachedOpts, memcachedserver.WithAsyncWrites())
+		}
+		go memcachedserver.Start(configuration.Memcached.Address, s, memcachedOpts...)
+	}
+
+	server.Start(configuration.Server.Address, s, tlogger, opts...)
 }
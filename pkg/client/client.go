@@ -0,0 +1,385 @@
+// Package client is a Go client for the gokv http api.
+//
+// A Client is safe for concurrent use and keeps a pool of connections to the server, so it should
+// be created once and reused. Failed requests which are safe to send again are retried with
+// exponential backoff, and errors returned by the server can be matched with errors.Is against
+// the errors of this package, such as ErrorKeyNotFound.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultMaxIdleConns is the number of idle connections to the server kept open for reuse.
+	defaultMaxIdleConns = 64
+	// defaultRetries is the number of times a failed request is retried.
+	defaultRetries = 3
+	// defaultBackoff is the delay before the first retry, which doubles with every retry.
+	defaultBackoff = 50 * time.Millisecond
+	// maxBackoff is the max delay before a retry.
+	maxBackoff = 5 * time.Second
+)
+
+// NoExpiry is returned by TTL for keys which never expire.
+const NoExpiry time.Duration = -1
+
+// Client sends requests to a gokv server.
+type Client struct {
+	baseURL      string
+	http         *http.Client
+	maxIdleConns int           // Idle connections kept open by the default http client
+	retries      int           // Number of times a failed request is retried
+	backoff      time.Duration // Delay before the first retry
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithHTTPClient sends the requests with hc instead of a client pooling up to 64 idle connections.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		c.http = hc
+	}
+}
+
+// WithMaxIdleConns keeps up to n idle connections to the server open for reuse.
+// It has no effect along with WithHTTPClient.
+func WithMaxIdleConns(n int) Option {
+	return func(c *Client) {
+		c.maxIdleConns = n
+	}
+}
+
+// WithRetries retries a failed request up to n times, waiting for backoff before the first retry
+// and twice as long before each of the next ones, with some jitter. n = 0 disables retries.
+func WithRetries(n int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.retries = n
+		c.backoff = backoff
+	}
+}
+
+// New returns a client of the server at baseURL, such as http://localhost:8000.
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:      strings.TrimRight(baseURL, "/"),
+		maxIdleConns: defaultMaxIdleConns,
+		retries:      defaultRetries,
+		backoff:      defaultBackoff,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	// the default transport only keeps 2 idle connections per host
+	if c.http == nil {
+		t := http.DefaultTransport.(*http.Transport).Clone()
+		t.MaxIdleConns = c.maxIdleConns
+		t.MaxIdleConnsPerHost = c.maxIdleConns
+		c.http = &http.Client{Transport: t}
+	}
+
+	return c
+}
+
+// request is a request to the server, which can be sent more than once.
+type request struct {
+	method string
+	path   string // Escaped path and query
+	header http.Header
+	body   []byte
+	// retry is set if the request can safely be sent again after an attempt whose outcome is unknown.
+	retry bool
+}
+
+// do sends a request and returns its response, whose body must be closed. Error responses are
+// returned as an *Error. A request which can safely be sent again is retried if it failed because
+// of the network or of a temporary unavailability of the server, until ctx is done.
+func (c *Client) do(ctx context.Context, req request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		res, err := c.send(ctx, req)
+		if err == nil {
+			// 304 is not an error
+			if res.StatusCode < http.StatusBadRequest {
+				return res, nil
+			}
+			err = responseError(res)
+		}
+
+		if !req.retry || attempt >= c.retries || !temporary(err) || ctx.Err() != nil {
+			return nil, err
+		}
+
+		t := time.NewTimer(c.delay(attempt))
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// send sends a request once.
+func (c *Client) send(ctx context.Context, req request) (*http.Response, error) {
+	r, err := http.NewRequestWithContext(ctx, req.method, c.baseURL+req.path, bytes.NewReader(req.body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range req.header {
+		r.Header[k] = v
+	}
+
+	return c.http.Do(r)
+}
+
+// delay returns the time to wait before a retry: the backoff doubled with every attempt, up to
+// maxBackoff, of which a random half is waited so that clients do not retry all at once.
+func (c *Client) delay(attempt int) time.Duration {
+	d := c.backoff << uint(attempt)
+	if d > maxBackoff || d <= 0 {
+		d = maxBackoff
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// temporary reports whether a request may succeed if it is sent again: if it could not reach the
+// server, or if the server or a proxy in front of it is unavailable.
+func temporary(err error) bool {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.StatusCode == http.StatusBadGateway || e.StatusCode == http.StatusServiceUnavailable ||
+			e.StatusCode == http.StatusGatewayTimeout
+	}
+	return true
+}
+
+// keyPath returns the escaped path of a key under an endpoint such as /api/v1/key/.
+func keyPath(endpoint, key string) (string, error) {
+	if key == "" || strings.Contains(key, "/") {
+		return "", ErrorInvalidKey
+	}
+	return endpoint + url.PathEscape(key), nil
+}
+
+// Entry is a value along with its metadata.
+type Entry struct {
+	Value []byte
+	// ContentType the value was put with, empty if none.
+	ContentType string
+	// Version of the value, which increases with every put.
+	Version uint64
+}
+
+// Get returns the value of a key.
+func (c *Client) Get(ctx context.Context, key string) ([]byte, error) {
+	e, err := c.GetEntry(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return e.Value, nil
+}
+
+// GetEntry returns the value of a key along with its content type and version.
+func (c *Client) GetEntry(ctx context.Context, key string) (*Entry, error) {
+	path, err := keyPath("/api/v1/key/", key)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := c.do(ctx, request{method: "GET", path: path, retry: true})
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	value, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	version, err := parseETag(res.Header.Get("ETag"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Entry{Value: value, ContentType: res.Header.Get("Content-Type"), Version: version}, nil
+}
+
+// WriteOption configures a Put or a Delete.
+type WriteOption func(*writeOptions)
+
+// writeOptions are the options of a Put or a Delete.
+type writeOptions struct {
+	contentType string
+	ttl         time.Duration
+	header      http.Header // Conditions of the write
+}
+
+// WithContentType puts a value with a content type, which is returned along with it.
+func WithContentType(contentType string) WriteOption {
+	return func(o *writeOptions) {
+		o.contentType = contentType
+	}
+}
+
+// WithTTL puts a value which expires after ttl.
+func WithTTL(ttl time.Duration) WriteOption {
+	return func(o *writeOptions) {
+		o.ttl = ttl
+	}
+}
+
+// IfVersion only applies a write if the key is at version, version 0 standing for a missing key.
+// Otherwise the write returns ErrorVersionMismatch.
+func IfVersion(version uint64) WriteOption {
+	return func(o *writeOptions) {
+		if version == 0 {
+			o.header.Set("If-None-Match", "*")
+		} else {
+			o.header.Set("If-Match", formatETag(version))
+		}
+	}
+}
+
+// IfExists only applies a write if the key exists. Otherwise the write returns ErrorVersionMismatch.
+func IfExists() WriteOption {
+	return func(o *writeOptions) {
+		o.header.Set("If-Match", "*")
+	}
+}
+
+// newWriteOptions applies the options of a write.
+func newWriteOptions(opts []WriteOption) *writeOptions {
+	o := &writeOptions{header: make(http.Header)}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// Put puts a value against a key and returns its new version. Values must not be empty.
+func (c *Client) Put(ctx context.Context, key string, value []byte, opts ...WriteOption) (uint64, error) {
+	path, err := keyPath("/api/v1/key/", key)
+	if err != nil {
+		return 0, err
+	}
+
+	o := newWriteOptions(opts)
+	if o.ttl != 0 {
+		path += "?ttl=" + url.QueryEscape(o.ttl.String())
+	}
+	if o.contentType != "" {
+		o.header.Set("Content-Type", o.contentType)
+	}
+
+	// a conditional put which failed could have been applied, it is not sent again
+	retry := o.header.Get("If-Match") == "" && o.header.Get("If-None-Match") == ""
+
+	res, err := c.do(ctx, request{method: "PUT", path: path, header: o.header, body: value, retry: retry})
+	if err != nil {
+		return 0, err
+	}
+	res.Body.Close()
+
+	return parseETag(res.Header.Get("ETag"))
+}
+
+// Delete deletes a key. Deleting a missing key is not an error.
+func (c *Client) Delete(ctx context.Context, key string, opts ...WriteOption) error {
+	path, err := keyPath("/api/v1/key/", key)
+	if err != nil {
+		return err
+	}
+
+	o := newWriteOptions(opts)
+	retry := o.header.Get("If-Match") == "" && o.header.Get("If-None-Match") == ""
+
+	res, err := c.do(ctx, request{method: "DELETE", path: path, header: o.header, retry: retry})
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+
+	return nil
+}
+
+// TTL returns the remaining time to live of a key rounded up to the second, or NoExpiry if the key never expires.
+func (c *Client) TTL(ctx context.Context, key string) (time.Duration, error) {
+	path, err := keyPath("/api/v1/ttl/", key)
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := c.do(ctx, request{method: "GET", path: path, retry: true})
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return 0, err
+	}
+
+	seconds, err := strconv.ParseInt(string(b), 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if seconds < 0 {
+		return NoExpiry, nil
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
+
+// Stats are statistics of the store.
+type Stats struct {
+	// Keys is the number of keys in the store, including expired keys yet to be removed.
+	Keys int `json:"keys"`
+	// Evictions is the number of keys evicted since the store was created.
+	Evictions uint64 `json:"evictions"`
+}
+
+// Stats returns statistics of the store.
+func (c *Client) Stats(ctx context.Context) (*Stats, error) {
+	var stats Stats
+	if err := c.getJSON(ctx, "/api/v1/stats", &stats); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// getJSON decodes the body of a GET request into v.
+func (c *Client) getJSON(ctx context.Context, path string, v interface{}) error {
+	res, err := c.do(ctx, request{method: "GET", path: path, retry: true})
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+// formatETag returns the entity tag of a version.
+func formatETag(version uint64) string {
+	return `"` + strconv.FormatUint(version, 10) + `"`
+}
+
+// parseETag returns the version of an entity tag.
+func parseETag(tag string) (uint64, error) {
+	if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+		return 0, errors.New("invalid entity tag: " + tag)
+	}
+	return strconv.ParseUint(tag[1:len(tag)-1], 10, 64)
+}
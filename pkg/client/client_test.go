@@ -0,0 +1,397 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/shubham1172/gokv/api/v1/server"
+	"github.com/shubham1172/gokv/config"
+	"github.com/shubham1172/gokv/internal/logger"
+	"github.com/shubham1172/gokv/pkg/store"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestClient returns a client of an httptest server running the real router, on top of a store
+// whose changes are persisted to a bolt logger publishing them to a hub. wrap, if not nil, wraps the router.
+func newTestClient(t *testing.T, wrap func(http.Handler) http.Handler, opts ...Option) (*Client, *store.Store, func()) {
+	hub := store.NewHub()
+	l, err := logger.NewBoltTransactionLogger(config.LoggingConfiguration{BoltFileName: filepath.Join(t.TempDir(), "transactions.db")}, logger.WithHub(hub))
+	if err != nil {
+		t.Fatalf("could not create logger: %v", err)
+	}
+	go l.Run()
+
+	st := store.New(store.WithMaxValueSize(32), store.WithCommitFunc(logger.CommitFunc(l)))
+
+	var h http.Handler = server.NewRouter(st, l, server.WithHub(hub))
+	if wrap != nil {
+		h = wrap(h)
+	}
+	srv := httptest.NewServer(h)
+
+	return New(srv.URL, opts...), st, func() {
+		srv.Close()
+		st.Close()
+		l.Stop()
+	}
+}
+
+func version(v uint64) *uint64 {
+	return &v
+}
+
+func TestKeys(t *testing.T) {
+	c, _, stop := newTestClient(t, nil)
+	defer stop()
+	ctx := context.Background()
+
+	v1, err := c.Put(ctx, "testKey", []byte("testValue"), WithContentType("text/plain"), WithTTL(time.Hour))
+	if err != nil {
+		t.Fatalf("Expected err to be %v, got %v instead", nil, err)
+	}
+
+	e, err := c.GetEntry(ctx, "testKey")
+	if err != nil {
+		t.Fatalf("Expected err to be %v, got %v instead", nil, err)
+	}
+	if want := (&Entry{Value: []byte("testValue"), ContentType: "text/plain", Version: v1}); !reflect.DeepEqual(e, want) {
+		t.Errorf("expected entry %v, got %v instead", want, e)
+	}
+
+	if ttl, err := c.TTL(ctx, "testKey"); err != nil || ttl != time.Hour {
+		t.Errorf("expected ttl %v, got %v (%v) instead", time.Hour, ttl, err)
+	}
+
+	testCases := []struct {
+		name string
+		call func() error
+		want error
+	}{
+		{"put if absent", func() error {
+			_, err := c.Put(ctx, "testKey", []byte("v"), IfVersion(0))
+			return err
+		}, ErrorVersionMismatch},
+		{"put stale version", func() error {
+			_, err := c.Put(ctx, "testKey", []byte("v"), IfVersion(v1+1))
+			return err
+		}, ErrorVersionMismatch},
+		{"put if exists", func() error {
+			_, err := c.Put(ctx, "missingKey", []byte("v"), IfExists())
+			return err
+		}, ErrorVersionMismatch},
+		{"put value too large", func() error {
+			_, err := c.Put(ctx, "testKey", make([]byte, 33))
+			return err
+		}, ErrorInvalidRequest},
+		{"put invalid key", func() error {
+			_, err := c.Put(ctx, "a/1", []byte("v"))
+			return err
+		}, ErrorInvalidKey},
+		{"get missing key", func() error {
+			_, err := c.Get(ctx, "missingKey")
+			return err
+		}, ErrorKeyNotFound},
+		{"ttl missing key", func() error {
+			_, err := c.TTL(ctx, "missingKey")
+			return err
+		}, ErrorKeyNotFound},
+		{"delete stale version", func() error {
+			return c.Delete(ctx, "testKey", IfVersion(v1+1))
+		}, ErrorVersionMismatch},
+		{"put current version", func() error {
+			_, err := c.Put(ctx, "testKey", []byte("testValue2"), IfVersion(v1))
+			return err
+		}, nil},
+		{"delete", func() error {
+			return c.Delete(ctx, "testKey", IfExists())
+		}, nil},
+		{"get deleted key", func() error {
+			_, err := c.Get(ctx, "testKey")
+			return err
+		}, ErrorKeyNotFound},
+		{"delete missing key", func() error {
+			return c.Delete(ctx, "testKey")
+		}, nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.call(); !errors.Is(err, tc.want) {
+				t.Errorf("Expected err to be %v, got %v instead", tc.want, err)
+			}
+		})
+	}
+
+	// errors carry the response of the server
+	_, err = c.Get(ctx, "missingKey")
+	var e404 *Error
+	if !errors.As(err, &e404) || e404.StatusCode != http.StatusNotFound || e404.Message != store.ErrorKeyNotFound.Error() {
+		t.Errorf("expected a 404 error with message %q, got %v instead", store.ErrorKeyNotFound, err)
+	}
+}
+
+func TestTxn(t *testing.T) {
+	c, _, stop := newTestClient(t, nil)
+	defer stop()
+	ctx := context.Background()
+
+	if _, err := c.Put(ctx, "testKey1", []byte("value1")); err != nil {
+		t.Fatalf("Expected err to be %v, got %v instead", nil, err)
+	}
+
+	testCases := []struct {
+		name string
+		ops  []Op
+		want error
+	}{
+		{"empty", nil, ErrorInvalidRequest},
+		{"version mismatch", []Op{
+			{Type: OpPut, Key: "a/1", Value: []byte("1")},
+			{Type: OpDelete, Key: "testKey1", Version: version(0)},
+		}, ErrorVersionMismatch},
+		{"applied", []Op{
+			{Type: OpPut, Key: "a/1", Value: []byte("1"), ContentType: "text/plain", TTL: time.Hour, Version: version(0)},
+			{Type: OpDelete, Key: "testKey1"},
+		}, nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			versions, err := c.Txn(ctx, tc.ops)
+			if !errors.Is(err, tc.want) {
+				t.Fatalf("Expected err to be %v, got %v instead", tc.want, err)
+			}
+			if err == nil && (len(versions) != 2 || versions[0] == 0 || versions[1] != 0) {
+				t.Errorf("expected a version for the put and 0 for the delete, got %v instead", versions)
+			}
+		})
+	}
+
+	// values which are not valid UTF-8 are read back as they were put
+	value := []byte{0xff, 0xfe, 'a', 0x00}
+	if _, err := c.Txn(ctx, []Op{{Type: OpPut, Key: "testKey2", Value: value}}); err != nil {
+		t.Fatalf("Expected err to be %v, got %v instead", nil, err)
+	}
+	if got, err := c.Get(ctx, "testKey2"); err != nil || !bytes.Equal(got, value) {
+		t.Errorf("expected value %q, got %q (%v) instead", value, got, err)
+	}
+	if err := c.Delete(ctx, "testKey2"); err != nil {
+		t.Fatalf("Expected err to be %v, got %v instead", nil, err)
+	}
+
+	// keys containing a slash can be written with a transaction, and listed
+	if keys, err := c.AllKeys(ctx, ""); err != nil || !reflect.DeepEqual(keys, []string{"a/1"}) {
+		t.Errorf("expected keys %v, got %v (%v) instead", []string{"a/1"}, keys, err)
+	}
+}
+
+func TestListKeys(t *testing.T) {
+	c, st, stop := newTestClient(t, nil)
+	defer stop()
+	ctx := context.Background()
+
+	var ops []store.Op
+	for i := 0; i < maxPageSize+5; i++ {
+		ops = append(ops, store.Op{Type: store.OpPut, Key: fmt.Sprintf("a%04d", i), Value: []byte("v")})
+	}
+	ops = append(ops, store.Op{Type: store.OpPut, Key: "b", Value: []byte("v")})
+	if _, err := st.Txn(ops); err != nil {
+		t.Fatalf("Expected err to be %v, got %v instead", nil, err)
+	}
+
+	page, err := c.Keys(ctx, ListOptions{Prefix: "a", Start: "a0002", Limit: 2})
+	if err != nil {
+		t.Fatalf("Expected err to be %v, got %v instead", nil, err)
+	}
+	if want := []string{"a0002", "a0003"}; !reflect.DeepEqual(page.Keys, want) || page.Next == "" {
+		t.Errorf("expected keys %v and a next page, got %v instead", want, page)
+	}
+
+	page, err = c.Keys(ctx, ListOptions{Prefix: "a", Limit: 2, Continue: page.Next})
+	if err != nil {
+		t.Fatalf("Expected err to be %v, got %v instead", nil, err)
+	}
+	if want := []string{"a0004", "a0005"}; !reflect.DeepEqual(page.Keys, want) {
+		t.Errorf("expected keys %v, got %v instead", want, page.Keys)
+	}
+
+	if _, err := c.Keys(ctx, ListOptions{Limit: maxPageSize + 1}); !errors.Is(err, ErrorInvalidRequest) {
+		t.Errorf("Expected err to be %v, got %v instead", ErrorInvalidRequest, err)
+	}
+
+	keys, err := c.AllKeys(ctx, "a")
+	if err != nil {
+		t.Fatalf("Expected err to be %v, got %v instead", nil, err)
+	}
+	if len(keys) != maxPageSize+5 || keys[0] != "a0000" || keys[len(keys)-1] != fmt.Sprintf("a%04d", maxPageSize+4) {
+		t.Errorf("expected %d keys starting with a, got %d instead", maxPageSize+5, len(keys))
+	}
+
+	stats, err := c.Stats(ctx)
+	if err != nil {
+		t.Fatalf("Expected err to be %v, got %v instead", nil, err)
+	}
+	if stats.Keys != maxPageSize+6 {
+		t.Errorf("expected %d keys, got %d instead", maxPageSize+6, stats.Keys)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	c, _, stop := newTestClient(t, nil)
+	defer stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// the watch reads the log from the start, so that the puts applied before the stream is open are not missed
+	events, errs := c.Watch(ctx, WatchOptions{Prefix: "a", Since: version(0)})
+
+	if _, err := c.Put(ctx, "b", []byte("v")); err != nil {
+		t.Fatalf("Expected err to be %v, got %v instead", nil, err)
+	}
+	if _, err := c.Put(ctx, "a1", []byte("v1"), WithContentType("text/plain")); err != nil {
+		t.Fatalf("Expected err to be %v, got %v instead", nil, err)
+	}
+	if err := c.Delete(ctx, "a1"); err != nil {
+		t.Fatalf("Expected err to be %v, got %v instead", nil, err)
+	}
+
+	put, del := <-events, <-events
+	if put.Type != "put" || put.Key != "a1" || string(put.Value) != "v1" || put.ContentType != "text/plain" {
+		t.Errorf("expected the put of a1, got %v instead", put)
+	}
+	if del.Type != "delete" || del.Key != "a1" || del.Sequence <= put.Sequence {
+		t.Errorf("expected the delete of a1 after sequence %d, got %v instead", put.Sequence, del)
+	}
+
+	cancel()
+	for range events {
+	}
+	if err := <-errs; err != context.Canceled {
+		t.Errorf("Expected err to be %v, got %v instead", context.Canceled, err)
+	}
+}
+
+func TestWatchResume(t *testing.T) {
+	var mu sync.Mutex
+	var requests []string
+
+	// the first stream is closed by the server after an event, the watch resumes from it
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r.URL.RawQuery)
+		first := len(requests) == 1
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		if first {
+			fmt.Fprint(w, ": keep-alive\n\nid: 7\nevent: put\ndata: {\"key\": \"a1\", \"value\": \"djE=\"}\n\n")
+			return
+		}
+		fmt.Fprint(w, "id: 8\nevent: delete\ndata: {\"key\": \"a1\"}\n\n")
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL, WithRetries(1, time.Millisecond))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	events, _ := c.Watch(ctx, WatchOptions{Prefix: "a"})
+
+	want := []Event{{Sequence: 7, Type: "put", Key: "a1", Value: []byte("v1")}, {Sequence: 8, Type: "delete", Key: "a1"}}
+	for _, w := range want {
+		if got := <-events; !reflect.DeepEqual(got, w) {
+			t.Errorf("expected event %v, got %v instead", w, got)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if want := []string{"prefix=a", "prefix=a&since=7"}; !reflect.DeepEqual(requests, want) {
+		t.Errorf("expected requests %v, got %v instead", want, requests)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	var failures, attempts int32
+
+	// the first requests fail with 503 until failures is exhausted
+	c, _, stop := newTestClient(t, func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&attempts, 1)
+			if atomic.AddInt32(&failures, -1) >= 0 {
+				http.Error(w, "unavailable", http.StatusServiceUnavailable)
+				return
+			}
+			h.ServeHTTP(w, r)
+		})
+	}, WithRetries(2, time.Millisecond))
+	defer stop()
+	ctx := context.Background()
+
+	testCases := []struct {
+		name         string
+		failures     int32
+		call         func() error
+		want         error
+		wantAttempts int32
+	}{
+		{"get retried", 2, func() error {
+			_, err := c.Get(ctx, "missingKey")
+			return err
+		}, ErrorKeyNotFound, 3},
+		{"get retried too often", 3, func() error {
+			_, err := c.Get(ctx, "missingKey")
+			return err
+		}, ErrorUnavailable, 3},
+		{"put retried", 1, func() error {
+			_, err := c.Put(ctx, "testKey", []byte("v"))
+			return err
+		}, nil, 2},
+		{"conditional put not retried", 1, func() error {
+			_, err := c.Put(ctx, "testKey", []byte("v"), IfExists())
+			return err
+		}, ErrorUnavailable, 1},
+		{"txn not retried", 1, func() error {
+			_, err := c.Txn(ctx, []Op{{Type: OpDelete, Key: "testKey"}})
+			return err
+		}, ErrorUnavailable, 1},
+		{"not found not retried", 0, func() error {
+			_, err := c.TTL(ctx, "missingKey")
+			return err
+		}, ErrorKeyNotFound, 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			atomic.StoreInt32(&failures, tc.failures)
+			atomic.StoreInt32(&attempts, 0)
+
+			if err := tc.call(); !errors.Is(err, tc.want) {
+				t.Errorf("Expected err to be %v, got %v instead", tc.want, err)
+			}
+			if got := atomic.LoadInt32(&attempts); got != tc.wantAttempts {
+				t.Errorf("expected %d attempts, got %d instead", tc.wantAttempts, got)
+			}
+		})
+	}
+
+	// the backoff stops once the context is done
+	atomic.StoreInt32(&failures, 1)
+	c = New(c.baseURL, WithRetries(1, time.Hour))
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if _, err := c.Get(ctx, "missingKey"); err != context.DeadlineExceeded {
+		t.Errorf("Expected err to be %v, got %v instead", context.DeadlineExceeded, err)
+	}
+}
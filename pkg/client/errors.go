@@ -0,0 +1,85 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// maxErrorSize is the max size in bytes of the message read from an error response.
+const maxErrorSize = 64 << 10
+
+var (
+	// ErrorInvalidKey is returned for keys which cannot be put in the URL of a request: empty keys,
+	// and keys containing a slash, which can only be written with a transaction.
+	ErrorInvalidKey = errors.New("Invalid key, keys in a URL must be non-empty and cannot contain a slash")
+
+	// ErrorInvalidRequest is returned if the server refused a request as invalid, with status 400,
+	// including keys and values larger than its limits. It is also returned for transactions with
+	// values which cannot be sent.
+	ErrorInvalidRequest = errors.New("Invalid request")
+
+	// ErrorKeyNotFound is returned if the key does not exist, with status 404.
+	ErrorKeyNotFound = errors.New("Key not found")
+
+	// ErrorVersionMismatch is returned if the condition of a conditional write was not met, with status 412.
+	ErrorVersionMismatch = errors.New("Version mismatch")
+
+	// ErrorRequestTooLarge is returned if a transaction is larger than permitted, with status 413.
+	ErrorRequestTooLarge = errors.New("Request too large")
+
+	// ErrorNotSupported is returned if the server does not support a request, such as watching changes, with status 501.
+	ErrorNotSupported = errors.New("Not supported by the server")
+
+	// ErrorCompacted is returned by Watch with status 410 if the changes to resume from were removed
+	// from the transaction log of the server by a compaction or a snapshot.
+	ErrorCompacted = errors.New("Changes removed from the transaction log")
+
+	// ErrorUnavailable is returned with status 503, which the server returns if a write could not be persisted
+	// to its transaction log. The write is then undone by the server.
+	ErrorUnavailable = errors.New("Server unavailable")
+
+	// ErrorStoreFull is returned if a write was refused because the store reached its limits, with status 507.
+	ErrorStoreFull = errors.New("Store full")
+)
+
+// statusErrors are the errors wrapped by Error, by status code.
+var statusErrors = map[int]error{
+	http.StatusBadRequest:            ErrorInvalidRequest,
+	http.StatusNotFound:              ErrorKeyNotFound,
+	http.StatusGone:                  ErrorCompacted,
+	http.StatusPreconditionFailed:    ErrorVersionMismatch,
+	http.StatusRequestEntityTooLarge: ErrorRequestTooLarge,
+	http.StatusNotImplemented:        ErrorNotSupported,
+	http.StatusServiceUnavailable:    ErrorUnavailable,
+	http.StatusInsufficientStorage:   ErrorStoreFull,
+}
+
+// Error is an error response of the server. It wraps the error standing for its status code,
+// if any, so that it can be matched with errors.Is.
+type Error struct {
+	// StatusCode of the response.
+	StatusCode int
+	// Message returned by the server.
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("gokv: %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// Unwrap returns the error standing for the status code, nil if there is none.
+func (e *Error) Unwrap() error {
+	return statusErrors[e.StatusCode]
+}
+
+// responseError reads an error response and closes its body.
+func responseError(res *http.Response) error {
+	defer res.Body.Close()
+
+	b, _ := ioutil.ReadAll(io.LimitReader(res.Body, maxErrorSize))
+	return &Error{StatusCode: res.StatusCode, Message: strings.TrimSpace(string(b))}
+}
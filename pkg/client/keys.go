@@ -0,0 +1,77 @@
+package client
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+)
+
+// maxPageSize is the max number of keys in a page.
+const maxPageSize = 1000
+
+// ListOptions selects the keys listed by Keys.
+type ListOptions struct {
+	// Prefix restricts the keys to the ones starting with it.
+	Prefix string
+	// Start is the first key listed.
+	Start string
+	// Limit is the max number of keys listed, 100 if 0 and at most 1000.
+	Limit int
+	// Continue is the token of the page to list, returned as Next by the previous page.
+	Continue string
+}
+
+// KeyPage is a page of keys in lexicographical order.
+type KeyPage struct {
+	Keys []string `json:"keys"`
+	// Next is the token of the next page, to be passed as Continue. It is empty on the last page.
+	Next string `json:"next,omitempty"`
+}
+
+// Keys returns a page of the keys in lexicographical order.
+func (c *Client) Keys(ctx context.Context, opts ListOptions) (*KeyPage, error) {
+	q := url.Values{}
+	if opts.Prefix != "" {
+		q.Set("prefix", opts.Prefix)
+	}
+	if opts.Start != "" {
+		q.Set("start", opts.Start)
+	}
+	if opts.Limit != 0 {
+		q.Set("limit", strconv.Itoa(opts.Limit))
+	}
+	if opts.Continue != "" {
+		q.Set("continue", opts.Continue)
+	}
+
+	path := "/api/v1/keys"
+	if len(q) > 0 {
+		path += "?" + q.Encode()
+	}
+
+	var page KeyPage
+	if err := c.getJSON(ctx, path, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// AllKeys returns every key starting with prefix in lexicographical order, fetching as many pages as needed.
+// The keys are not read at a single point in time, keys written in the meantime may or may not be listed.
+func (c *Client) AllKeys(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+
+	opts := ListOptions{Prefix: prefix, Limit: maxPageSize}
+	for {
+		page, err := c.Keys(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, page.Keys...)
+
+		if page.Next == "" {
+			return keys, nil
+		}
+		opts.Continue = page.Next
+	}
+}
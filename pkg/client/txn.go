@@ -0,0 +1,87 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// OpType is the type of an operation in a transaction.
+type OpType string
+
+const (
+	// OpPut puts a value against a key.
+	OpPut OpType = "put"
+	// OpDelete deletes a key.
+	OpDelete OpType = "delete"
+)
+
+// Op is a single operation in a transaction.
+type Op struct {
+	Type OpType
+	Key  string
+	// Value is only used by puts.
+	Value []byte
+	// ContentType is an optional content type returned along with the value put.
+	ContentType string
+	// TTL is an optional duration after which a put key expires.
+	TTL time.Duration
+	// Version, if not nil, must match the version of the key for the transaction to be applied.
+	// Version 0 requires the key to not exist.
+	Version *uint64
+}
+
+// txnOp is the JSON encoding of an Op.
+type txnOp struct {
+	Op          OpType  `json:"op"`
+	Key         string  `json:"key"`
+	Value       []byte  `json:"value,omitempty"`
+	ContentType string  `json:"content_type,omitempty"`
+	TTL         string  `json:"ttl,omitempty"`
+	Version     *uint64 `json:"version,omitempty"`
+}
+
+// txnResponse is the body returned by POST /api/v1/txn.
+type txnResponse struct {
+	Versions []uint64 `json:"versions"`
+}
+
+// jsonHeader returns the header of a request with a JSON body.
+func jsonHeader() http.Header {
+	return http.Header{"Content-Type": []string{"application/json"}}
+}
+
+// Txn atomically applies a list of operations in order: either all of them are applied, or none of them
+// are. It returns the new version of each key put, and 0 for each key deleted. If the version of an
+// operation does not match, nothing is applied and ErrorVersionMismatch is returned.
+// A transaction which failed could have been applied, so it is not retried.
+func (c *Client) Txn(ctx context.Context, ops []Op) ([]uint64, error) {
+	req := struct {
+		Ops []txnOp `json:"ops"`
+	}{Ops: make([]txnOp, len(ops))}
+
+	for i, op := range ops {
+		req.Ops[i] = txnOp{Op: op.Type, Key: op.Key, Value: op.Value, ContentType: op.ContentType, Version: op.Version}
+		if op.TTL != 0 {
+			req.Ops[i].TTL = op.TTL.String()
+		}
+	}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := c.do(ctx, request{method: "POST", path: "/api/v1/txn", header: jsonHeader(), body: body})
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	var txn txnResponse
+	if err := json.NewDecoder(res.Body).Decode(&txn); err != nil {
+		return nil, err
+	}
+	return txn.Versions, nil
+}
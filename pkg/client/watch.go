@@ -0,0 +1,178 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrorWatchClosed is returned by Watch if the server ended the stream of changes, such as when the
+// watch fell behind the changes, and the watch could not be resumed.
+var ErrorWatchClosed = errors.New("Watch closed by the server")
+
+// Event is a change of a key streamed by Watch.
+type Event struct {
+	// Sequence number of the change in the transaction log, from which a watch can be resumed.
+	Sequence uint64
+	// Type of the change: "put", "delete", "expire" or "evict".
+	Type string
+	Key  string
+	// Value, ContentType and ExpiresAt are only present for puts. ExpiresAt is zero if the key never expires.
+	Value       []byte
+	ContentType string
+	ExpiresAt   time.Time
+}
+
+// watchEvent is the data of a server-sent event of GET /api/v1/watch.
+type watchEvent struct {
+	Key         string     `json:"key"`
+	Value       []byte     `json:"value,omitempty"`
+	ContentType string     `json:"content_type,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+}
+
+// WatchOptions selects the changes streamed by Watch.
+type WatchOptions struct {
+	// Prefix restricts the changes to the keys starting with it.
+	Prefix string
+	// Since, if not nil, first reads back the changes after this sequence number from the transaction log.
+	Since *uint64
+}
+
+// Watch streams the changes of keys once they are persisted to the transaction log of the server.
+// The events channel is closed once ctx is done or the watch fails, then the reason is sent on
+// the errors channel. If the stream breaks after an event was received, or if Since is set, the
+// watch is resumed from the last event received with the retries of the client, so that no
+// change is missed. If the changes to resume from were removed from the transaction log of the
+// server, the watch fails with ErrorCompacted.
+func (c *Client) Watch(ctx context.Context, opts WatchOptions) (<-chan Event, <-chan error) {
+	events := make(chan Event)
+	errs := make(chan error, 1)
+
+	go func() {
+		err := c.watch(ctx, opts, events)
+		close(events)
+		errs <- err
+		close(errs)
+	}()
+
+	return events, errs
+}
+
+// watch sends the changes to events, resuming the stream when it breaks if no change would be missed.
+func (c *Client) watch(ctx context.Context, opts WatchOptions, events chan<- Event) error {
+	since := opts.Since
+
+	for failures := 0; ; failures++ {
+		err := c.stream(ctx, opts.Prefix, since, func(e Event) error {
+			select {
+			case events <- e:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+
+			failures = 0
+			since = &e.Sequence
+			return nil
+		})
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if since == nil || failures >= c.retries || !temporary(err) {
+			return err
+		}
+
+		t := time.NewTimer(c.delay(failures))
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// stream opens a stream of changes and passes them to send until it ends.
+func (c *Client) stream(ctx context.Context, prefix string, since *uint64, send func(e Event) error) error {
+	q := url.Values{}
+	if prefix != "" {
+		q.Set("prefix", prefix)
+	}
+	if since != nil {
+		q.Set("since", strconv.FormatUint(*since, 10))
+	}
+
+	path := "/api/v1/watch"
+	if len(q) > 0 {
+		path += "?" + q.Encode()
+	}
+
+	res, err := c.do(ctx, request{method: "GET", path: path, header: http.Header{"Accept": []string{"text/event-stream"}}})
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	var e Event
+	var data string
+
+	br := bufio.NewReader(res.Body)
+	for {
+		line, err := br.ReadString('\n')
+		if err == io.EOF {
+			return ErrorWatchClosed
+		}
+		if err != nil {
+			return err
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		// a blank line ends an event
+		if line == "" {
+			if data == "" {
+				continue
+			}
+
+			var we watchEvent
+			if err := json.Unmarshal([]byte(data), &we); err != nil {
+				return err
+			}
+			e.Key, e.Value, e.ContentType = we.Key, we.Value, we.ContentType
+			if we.ExpiresAt != nil {
+				e.ExpiresAt = *we.ExpiresAt
+			}
+
+			if err := send(e); err != nil {
+				return err
+			}
+			e, data = Event{}, ""
+			continue
+		}
+
+		field, value := line, ""
+		if i := strings.Index(line, ":"); i >= 0 {
+			field, value = line[:i], strings.TrimPrefix(line[i+1:], " ")
+		}
+
+		// comments such as keep-alives and unknown fields are ignored
+		switch field {
+		case "id":
+			e.Sequence, err = strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				return err
+			}
+		case "event":
+			e.Type = value
+		case "data":
+			data += value
+		}
+	}
+}
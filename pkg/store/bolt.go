@@ -0,0 +1,288 @@
+package store
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	bolt "go.etcd.io/bbolt"
+	"time"
+)
+
+var (
+	// entriesBucket holds the entries keyed by their key, so that they are sorted.
+	entriesBucket = []byte("entries")
+	// metaBucket holds the last version assigned, the number of keys and the format of the entries.
+	metaBucket = []byte("meta")
+
+	versionKey = []byte("version")
+	countKey   = []byte("count")
+	formatKey  = []byte("format")
+)
+
+// MaxBoltKeySize is the max size of a key supported by the bolt engine.
+const MaxBoltKeySize = bolt.MaxKeySize
+
+// entryHeaderSize is the size of the version, the expiry and the flags which start an encoded entry.
+const entryHeaderSize = 20
+
+// entryFormat is the format of the entries written by the engine. Entries of format 1, written before
+// the format was recorded, lack the flags.
+const entryFormat = 2
+
+var (
+	// errMalformedEntry is returned when an entry read from the database cannot be decoded.
+	errMalformedEntry = errors.New("Malformed entry")
+
+	// errEmptyKey is returned when an empty key is put, which bolt does not support.
+	errEmptyKey = errors.New("Empty key")
+)
+
+// boltEngine is an Engine which holds the entries on disk in a bbolt B+tree,
+// so that they do not need to fit in memory.
+type boltEngine struct {
+	db *bolt.DB
+}
+
+// NewBoltEngine returns an Engine which holds the entries in the bbolt database file at path,
+// created if it does not exist. Every call to Apply is flushed to the disk.
+func NewBoltEngine(path string) (Engine, error) {
+	// the database is locked by the process which opened it, give up instead of waiting forever
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("cannot open bolt database: %v", err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(entriesBucket); err != nil {
+			return err
+		}
+		meta, err := tx.CreateBucketIfNotExists(metaBucket)
+		if err != nil {
+			return err
+		}
+		if readUint64(meta, formatKey) < entryFormat {
+			err = upgradeEntries(tx.Bucket(entriesBucket))
+			if err != nil {
+				return err
+			}
+		}
+		return meta.Put(formatKey, uint64Value(entryFormat))
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("cannot create buckets: %v", err)
+	}
+
+	return &boltEngine{db: db}, nil
+}
+
+// upgradeEntries rewrites the entries of format 1 to the current format, with flags of 0.
+func upgradeEntries(entries *bolt.Bucket) error {
+	var keys, values [][]byte
+
+	err := entries.ForEach(func(k, v []byte) error {
+		if len(v) < 16 {
+			return errMalformedEntry
+		}
+
+		// the flags follow the version and the expiry
+		upgraded := make([]byte, 0, len(v)+4)
+		upgraded = append(upgraded, v[:16]...)
+		upgraded = append(upgraded, 0, 0, 0, 0)
+		upgraded = append(upgraded, v[16:]...)
+
+		keys = append(keys, append([]byte(nil), k...))
+		values = append(values, upgraded)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// keys cannot be put while iterating over the bucket
+	for i, k := range keys {
+		err = entries.Put(k, values[i])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// encodeEntry returns the version, the expiry in nanoseconds, the flags, the length prefixed content type
+// and the value of an entry.
+func encodeEntry(e Entry) []byte {
+	var expiresAt int64
+	if !e.ExpiresAt.IsZero() {
+		expiresAt = e.ExpiresAt.UnixNano()
+	}
+
+	buf := make([]byte, entryHeaderSize, entryHeaderSize+binary.MaxVarintLen64+len(e.ContentType)+len(e.Value))
+	binary.BigEndian.PutUint64(buf, e.Version)
+	binary.BigEndian.PutUint64(buf[8:], uint64(expiresAt))
+	binary.BigEndian.PutUint32(buf[16:], e.Flags)
+
+	var n [binary.MaxVarintLen64]byte
+	buf = append(buf, n[:binary.PutUvarint(n[:], uint64(len(e.ContentType)))]...)
+	buf = append(buf, e.ContentType...)
+
+	return append(buf, e.Value...)
+}
+
+// decodeEntry decodes an entry encoded by encodeEntry.
+// The entry does not reference buf, which is only valid within a database transaction.
+func decodeEntry(buf []byte) (Entry, error) {
+	if len(buf) < entryHeaderSize {
+		return Entry{}, errMalformedEntry
+	}
+
+	rest := buf[entryHeaderSize:]
+	length, n := binary.Uvarint(rest)
+	if n <= 0 || uint64(len(rest)-n) < length {
+		return Entry{}, errMalformedEntry
+	}
+	rest = rest[n:]
+
+	e := Entry{
+		Value:       copyBytes(rest[length:]),
+		ContentType: string(rest[:length]),
+		Flags:       binary.BigEndian.Uint32(buf[16:]),
+		Version:     binary.BigEndian.Uint64(buf),
+	}
+	if expiresAt := int64(binary.BigEndian.Uint64(buf[8:])); expiresAt != 0 {
+		e.ExpiresAt = time.Unix(0, expiresAt)
+	}
+
+	return e, nil
+}
+
+// uint64Value returns the big endian encoding of n.
+func uint64Value(n uint64) []byte {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, n)
+	return buf
+}
+
+// readUint64 returns the number stored against key in b, or 0 if there is none.
+func readUint64(b *bolt.Bucket, key []byte) uint64 {
+	v := b.Get(key)
+	if len(v) != 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(v)
+}
+
+// Get returns the entry of a key, and false if the key is not present.
+func (b *boltEngine) Get(k string) (Entry, bool, error) {
+	var e Entry
+	var ok bool
+
+	err := b.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(entriesBucket).Get([]byte(k))
+		if v == nil {
+			return nil
+		}
+
+		var err error
+		e, err = decodeEntry(v)
+		ok = err == nil
+		return err
+	})
+
+	return e, ok, err
+}
+
+// Apply applies the writes in order within a single database transaction.
+func (b *boltEngine) Apply(writes []Write, version uint64) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		entries := tx.Bucket(entriesBucket)
+		meta := tx.Bucket(metaBucket)
+		count := readUint64(meta, countKey)
+
+		for _, w := range writes {
+			key := []byte(w.Key)
+			exists := entries.Get(key) != nil
+
+			if w.Delete {
+				if !exists {
+					continue
+				}
+				if err := entries.Delete(key); err != nil {
+					return err
+				}
+				count--
+				continue
+			}
+
+			if len(key) == 0 {
+				return errEmptyKey
+			}
+			if err := entries.Put(key, encodeEntry(w.Entry)); err != nil {
+				return err
+			}
+			if !exists {
+				count++
+			}
+		}
+
+		if err := meta.Put(countKey, uint64Value(count)); err != nil {
+			return err
+		}
+		return meta.Put(versionKey, uint64Value(version))
+	})
+}
+
+// Version returns the last version recorded by Apply.
+func (b *boltEngine) Version() (uint64, error) {
+	var version uint64
+
+	err := b.db.View(func(tx *bolt.Tx) error {
+		version = readUint64(tx.Bucket(metaBucket), versionKey)
+		return nil
+	})
+
+	return version, err
+}
+
+// Range calls fn with the keys in the range [start, end) in lexicographical order.
+// The keys are read from a consistent view of the database.
+func (b *boltEngine) Range(start, end string, fn func(k string, e Entry) bool) error {
+	return b.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(entriesBucket).Cursor()
+
+		for k, v := c.Seek([]byte(start)); k != nil; k, v = c.Next() {
+			key := string(k)
+			if end != "" && key >= end {
+				break
+			}
+
+			e, err := decodeEntry(v)
+			if err != nil {
+				return fmt.Errorf("%v: %q", err, key)
+			}
+			if !fn(key, e) {
+				break
+			}
+		}
+
+		return nil
+	})
+}
+
+// Len returns the number of keys present.
+func (b *boltEngine) Len() int {
+	var count uint64
+
+	b.db.View(func(tx *bolt.Tx) error {
+		count = readUint64(tx.Bucket(metaBucket), countKey)
+		return nil
+	})
+
+	return int(count)
+}
+
+// Close closes the database.
+func (b *boltEngine) Close() error {
+	return b.db.Close()
+}
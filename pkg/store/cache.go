@@ -0,0 +1,104 @@
+package store
+
+import (
+	"container/list"
+	"sync"
+)
+
+// cacheItem is an entry held by a cachedEngine.
+type cacheItem struct {
+	key   string
+	entry Entry
+}
+
+// cachedEngine is an Engine which keeps the most recently used entries of another Engine in memory.
+// Writes go through to the other engine, and ranges are always read from it.
+type cachedEngine struct {
+	Engine
+	mu    sync.Mutex               // Protects the fields below, as Get may be called concurrently
+	size  int                      // Max number of entries held
+	items map[string]*list.Element // Elements of lru by key
+	lru   *list.List               // Entries from the most to the least recently used
+}
+
+// NewCachedEngine returns an Engine which keeps up to size of the most recently used entries
+// of e in memory, so that reading them does not go through e.
+func NewCachedEngine(e Engine, size int) Engine {
+	return &cachedEngine{
+		Engine: e,
+		size:   size,
+		items:  make(map[string]*list.Element, size),
+		lru:    list.New(),
+	}
+}
+
+// Get returns the entry of a key from the cache, or from the underlying engine if it is not cached.
+func (c *cachedEngine) Get(k string) (Entry, bool, error) {
+	c.mu.Lock()
+	if el, ok := c.items[k]; ok {
+		c.lru.MoveToFront(el)
+		e := el.Value.(*cacheItem).entry
+		c.mu.Unlock()
+		return e, true, nil
+	}
+	c.mu.Unlock()
+
+	e, ok, err := c.Engine.Get(k)
+	if err != nil || !ok {
+		return e, ok, err
+	}
+
+	c.mu.Lock()
+	// the entry cannot have changed in the meantime, as Apply is never concurrent with Get
+	c.add(k, e)
+	c.mu.Unlock()
+
+	return e, true, nil
+}
+
+// Apply applies the writes to the underlying engine, then to the cache.
+func (c *cachedEngine) Apply(writes []Write, version uint64) error {
+	err := c.Engine.Apply(writes, version)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, w := range writes {
+		if w.Delete {
+			c.remove(w.Key)
+		} else {
+			c.add(w.Key, w.Entry)
+		}
+	}
+
+	return nil
+}
+
+// add puts an entry in the cache as the most recently used, evicting the least recently used
+// entry if the cache is full. The caller must hold the lock.
+func (c *cachedEngine) add(k string, e Entry) {
+	if el, ok := c.items[k]; ok {
+		el.Value.(*cacheItem).entry = e
+		c.lru.MoveToFront(el)
+		return
+	}
+
+	if c.size <= 0 {
+		return
+	}
+	if c.lru.Len() >= c.size {
+		c.remove(c.lru.Back().Value.(*cacheItem).key)
+	}
+	c.items[k] = c.lru.PushFront(&cacheItem{key: k, entry: e})
+}
+
+// remove drops a key from the cache. The caller must hold the lock.
+func (c *cachedEngine) remove(k string) {
+	if el, ok := c.items[k]; ok {
+		c.lru.Remove(el)
+		delete(c.items, k)
+	}
+}
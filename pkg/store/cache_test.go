@@ -0,0 +1,58 @@
+package store
+
+import (
+	"testing"
+)
+
+// countingEngine counts the calls to Get which reach the engine.
+type countingEngine struct {
+	Engine
+	gets int
+}
+
+func (c *countingEngine) Get(k string) (Entry, bool, error) {
+	c.gets++
+	return c.Engine.Get(k)
+}
+
+func TestCachedEngine(t *testing.T) {
+	inner := &countingEngine{Engine: NewMemoryEngine(0)}
+	e := NewCachedEngine(inner, 2)
+
+	e.Apply([]Write{
+		{Key: "a", Entry: Entry{Value: []byte("value-a")}},
+		{Key: "b", Entry: Entry{Value: []byte("value-b")}},
+		{Key: "c", Entry: Entry{Value: []byte("value-c")}},
+	}, 3)
+
+	testCases := []struct {
+		name  string
+		key   string
+		value string
+		gets  int // expected number of calls reaching the engine
+	}{
+		{"recently written key is cached", "c", "value-c", 0},
+		{"least recently used key is evicted", "a", "value-a", 1},
+		{"key read is cached", "a", "value-a", 1},
+		{"key evicted by the read", "b", "value-b", 2},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, ok, err := e.Get(tc.key)
+			if err != nil || !ok || string(got.Value) != tc.value {
+				t.Errorf("Expected value %s, got %v, %v, %v instead", tc.value, got, ok, err)
+			}
+			if inner.gets != tc.gets {
+				t.Errorf("Expected %d gets to reach the engine, got %d instead", tc.gets, inner.gets)
+			}
+		})
+	}
+
+	t.Run("deleted key is dropped", func(t *testing.T) {
+		e.Apply([]Write{{Key: "b", Delete: true}}, 3)
+		if _, ok, _ := e.Get("b"); ok {
+			t.Errorf("Expected the deleted key to be missing")
+		}
+	})
+}
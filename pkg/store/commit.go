@@ -0,0 +1,176 @@
+package store
+
+import (
+	"fmt"
+	"time"
+)
+
+// ChangeType is the type of a change applied to the store.
+type ChangeType byte
+
+const (
+	// ChangeDelete is a key which was deleted.
+	ChangeDelete ChangeType = iota
+	// ChangePut is a value which was put against a key.
+	ChangePut
+	// ChangeExpire is a key which was removed after its time to live ran out.
+	ChangeExpire
+	// ChangeEvict is a key which was evicted to make room for a write once the store reached its limits.
+	ChangeEvict
+)
+
+// Change describes a modification applied to the store.
+type Change struct {
+	// Type of the change.
+	Type ChangeType
+	// Key which was changed.
+	Key string
+	// Value is only present if the Type is ChangePut. It must not be modified, it is shared with the store.
+	Value []byte
+	// ContentType is the media type of the value, empty if unknown. It is only present if the Type is ChangePut.
+	ContentType string
+	// Flags are the opaque flags of the value. They are only present if the Type is ChangePut.
+	Flags uint32
+	// ExpiresAt is only present if the Type is ChangePut. Zero means that the key never expires.
+	ExpiresAt time.Time
+}
+
+// CommitFunc is called with the changes of every write while the lock on the store is held, so
+// that it sees the writes in the order they are applied. The changes of a write, such as those of
+// a transaction, are passed together. It returns a channel which receives the result of recording
+// the changes, for example in a transaction log, or nil if the result is not reported.
+//
+// If recording the changes fails, the write is undone: its keys are restored as they were before
+// it, unless a later write whose changes were recorded has overwritten them since. The channel
+// returned by Apply receives the result once the write is undone.
+//
+// A CommitFunc must not use the store, and should not block for long as it holds up every write.
+type CommitFunc func(changes []Change) <-chan error
+
+// pendingWrite is a write to a key whose changes are yet to be recorded by the CommitFunc.
+type pendingWrite struct {
+	undo Write // Restores the key as it was before the write
+}
+
+// WithCommitFunc registers f to be called with the changes of every write.
+func WithCommitFunc(f CommitFunc) Option {
+	return func(s *Store) {
+		s.onCommit = f
+	}
+}
+
+// SetCommitFunc registers f to be called with the changes of every write from now on,
+// replacing the CommitFunc registered before. A nil f unregisters it.
+func (s *Store) SetCommitFunc(f CommitFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.onCommit = f
+}
+
+// undo returns the writes restoring the keys of writes as they are now, one for each key, if there is
+// a CommitFunc which may fail to record them. The caller must hold the lock.
+func (s *Store) undo(writes []Write) ([]Write, error) {
+	if s.onCommit == nil {
+		return nil, nil
+	}
+
+	undo := make([]Write, 0, len(writes))
+	seen := make(map[string]struct{}, len(writes))
+	for _, w := range writes {
+		if _, ok := seen[w.Key]; ok {
+			continue
+		}
+		seen[w.Key] = struct{}{}
+
+		e, ok, err := s.engine.Get(w.Key)
+		if err != nil {
+			return nil, err
+		}
+		undo = append(undo, Write{Key: w.Key, Entry: e, Delete: !ok})
+	}
+
+	return undo, nil
+}
+
+// commit passes the changes to the CommitFunc and returns a channel receiving its result, or nil if
+// it does not report one. undo are the writes returned by undo before the changes were applied, which
+// are applied if the changes are not recorded. The caller must hold the lock.
+func (s *Store) commit(changes []Change, undo []Write) <-chan error {
+	s.publish(changes)
+
+	if s.onCommit == nil || len(changes) == 0 {
+		return nil
+	}
+
+	done := s.onCommit(changes)
+	if done == nil {
+		return nil
+	}
+
+	pending := make([]*pendingWrite, len(undo))
+	for i, w := range undo {
+		pending[i] = &pendingWrite{undo: w}
+		s.pending[w.Key] = append(s.pending[w.Key], pending[i])
+	}
+
+	result := make(chan error, 1)
+	go func() {
+		err := <-done
+
+		s.mu.Lock()
+		undoErr := s.settle(pending, err != nil)
+		s.mu.Unlock()
+
+		if undoErr != nil {
+			err = fmt.Errorf("%w, and the write could not be undone: %v", err, undoErr)
+		}
+		result <- err
+	}()
+
+	return result
+}
+
+// settle forgets the pending writes once their changes are recorded, along with the earlier
+// writes of their keys which are overwritten. If they failed, the writes are undone instead:
+// the keys which were not written since are restored, and the next writes of the others are
+// made to restore them in their place. The caller must hold the lock.
+func (s *Store) settle(pending []*pendingWrite, failed bool) error {
+	var undo []Write
+	for _, p := range pending {
+		k := p.undo.Key
+		writes := s.pending[k]
+
+		i := 0
+		for i < len(writes) && writes[i] != p {
+			i++
+		}
+		if i == len(writes) {
+			// forgotten along with an earlier write, since a later write was recorded
+			continue
+		}
+
+		switch {
+		case !failed:
+			writes = writes[i+1:]
+		case i == len(writes)-1:
+			undo = append(undo, p.undo)
+			writes = writes[:i]
+		default:
+			writes[i+1].undo = p.undo
+			writes = append(writes[:i], writes[i+1:]...)
+		}
+
+		if len(writes) == 0 {
+			delete(s.pending, k)
+		} else {
+			s.pending[k] = writes
+		}
+	}
+
+	if len(undo) == 0 {
+		return nil
+	}
+	// the keys are restored as the CommitFunc recorded them, so the writes are not committed
+	return s.write(undo, s.version, time.Now())
+}
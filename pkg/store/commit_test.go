@@ -0,0 +1,202 @@
+package store
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCommitFunc(t *testing.T) {
+	var changes []Change
+	var failing bool
+	errCommit := errors.New("commit failed")
+
+	s := New(WithCommitFunc(func(c []Change) <-chan error {
+		changes = append(changes, c...)
+		done := make(chan error, 1)
+		if failing {
+			done <- errCommit
+		} else {
+			done <- nil
+		}
+		return done
+	}))
+	defer s.Close()
+
+	expiresAt := time.Now().Add(time.Minute)
+
+	s.Put("testCommitKey1", []byte("value1"))
+	s.PutWithExpiry("testCommitKey2", []byte("value2"), expiresAt)
+	s.CompareAndSwap("testCommitKey1", 0, []byte("value3"))
+	s.Delete("testCommitKey1")
+
+	failing = true
+	_, done, err := s.Apply([]Op{
+		{Type: OpPut, Key: "testCommitKey3", Value: []byte("value3")},
+		{Type: OpDelete, Key: "testCommitKey2"},
+	})
+	if err != nil {
+		t.Fatalf("Expected err to be %v, got %v instead", nil, err)
+	}
+	if err := <-done; err != errCommit {
+		t.Errorf("Expected err to be %v, got %v instead", errCommit, err)
+	}
+	failing = false
+
+	// the transaction which could not be committed is undone
+	if _, err := s.Get("testCommitKey3"); err != ErrorKeyNotFound {
+		t.Errorf("Expected err to be %v, got %v instead", ErrorKeyNotFound, err)
+	}
+	if v, err := s.Get("testCommitKey2"); err != nil || string(v) != "value2" {
+		t.Errorf("Expected value %q, got %q with err %v instead", "value2", v, err)
+	}
+
+	expiredAt := time.Now().Add(-time.Second)
+	s.PutWithExpiry("testCommitKey4", []byte("value4"), expiredAt)
+	s.SetCommitFunc(nil)
+	s.Put("testCommitKey5", []byte("value5"))
+
+	// the failed compare-and-swap is not a change, and the expired key is removed as soon as it is put
+	want := []Change{
+		{Type: ChangePut, Key: "testCommitKey1", Value: []byte("value1")},
+		{Type: ChangePut, Key: "testCommitKey2", Value: []byte("value2"), ExpiresAt: expiresAt},
+		{Type: ChangeDelete, Key: "testCommitKey1"},
+		{Type: ChangePut, Key: "testCommitKey3", Value: []byte("value3")},
+		{Type: ChangeDelete, Key: "testCommitKey2"},
+		{Type: ChangePut, Key: "testCommitKey4", Value: []byte("value4"), ExpiresAt: expiredAt},
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("Expected changes %v, got %v instead", want, changes)
+	}
+}
+
+func TestCommitFuncUndo(t *testing.T) {
+	errCommit := errors.New("commit failed")
+
+	// each step puts a value, and the results of the puts are sent in the given order
+	testCases := []struct {
+		name    string
+		results []error
+		order   []int
+		value   string // expected once every result is sent, empty if the key is missing
+	}{
+		{"first failed", []error{errCommit, nil}, []int{0, 1}, "value1"},
+		{"first failed last", []error{errCommit, nil}, []int{1, 0}, "value1"},
+		{"last failed", []error{nil, errCommit}, []int{0, 1}, "value0"},
+		{"last failed first", []error{nil, errCommit}, []int{1, 0}, "value0"},
+		{"all failed", []error{errCommit, errCommit}, []int{0, 1}, ""},
+		{"all failed last first", []error{errCommit, errCommit}, []int{1, 0}, ""},
+		{"middle failed", []error{nil, errCommit, nil}, []int{2, 1, 0}, "value2"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var results []chan error
+			s := New(WithCommitFunc(func(c []Change) <-chan error {
+				results = append(results, make(chan error, 1))
+				return results[len(results)-1]
+			}))
+			defer s.Close()
+
+			var dones []<-chan error
+			for i := range tc.results {
+				_, done, err := s.Apply([]Op{{Type: OpPut, Key: "testUndoKey", Value: []byte("value" + strconv.Itoa(i))}})
+				if err != nil {
+					t.Fatalf("Expected err to be %v, got %v instead", nil, err)
+				}
+				dones = append(dones, done)
+			}
+
+			for _, i := range tc.order {
+				results[i] <- tc.results[i]
+				if err := <-dones[i]; err != tc.results[i] {
+					t.Errorf("Expected err to be %v, got %v instead", tc.results[i], err)
+				}
+			}
+
+			v, err := s.Get("testUndoKey")
+			if tc.value == "" && err != ErrorKeyNotFound {
+				t.Errorf("Expected err to be %v, got %v instead", ErrorKeyNotFound, err)
+			}
+			if tc.value != "" && string(v) != tc.value {
+				t.Errorf("Expected value %q, got %q with err %v instead", tc.value, v, err)
+			}
+			if len(s.pending) != 0 {
+				t.Errorf("Expected every write to be settled, got %v", s.pending)
+			}
+		})
+	}
+}
+
+func TestCommitFuncExpiry(t *testing.T) {
+	var mu sync.Mutex
+	var changes []Change
+
+	s := New(WithExpiryInterval(10*time.Millisecond), WithCommitFunc(func(c []Change) <-chan error {
+		mu.Lock()
+		changes = append(changes, c...)
+		mu.Unlock()
+		return nil
+	}))
+	defer s.Close()
+
+	s.PutWithTTL("testCommitKey1", []byte("value1"), 5*time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if n := len(changes); n != 2 || !reflect.DeepEqual(changes[1], Change{Type: ChangeExpire, Key: "testCommitKey1"}) {
+		t.Errorf("Expected the expiry to be committed, got %v", changes)
+	}
+}
+
+func TestCommitFuncOrder(t *testing.T) {
+	// replaying the changes in the order they are committed rebuilds the store
+	replayed := map[string]string{}
+
+	s := New(WithCommitFunc(func(c []Change) <-chan error {
+		for _, change := range c {
+			if change.Type == ChangePut {
+				replayed[change.Key] = string(change.Value)
+			} else {
+				delete(replayed, change.Key)
+			}
+		}
+		return nil
+	}))
+	defer s.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				k := "testCommitKey" + strconv.Itoa(j%5)
+				if (i+j)%3 == 0 {
+					s.Delete(k)
+				} else {
+					s.Put(k, []byte(strconv.Itoa(i*100+j)))
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	kvs, err := s.Scan("", "", 0)
+	if err != nil {
+		t.Fatalf("Expected err to be nil, got %v instead", err)
+	}
+
+	want := map[string]string{}
+	for _, kv := range kvs {
+		want[kv.Key] = string(kv.Value)
+	}
+	if !reflect.DeepEqual(replayed, want) {
+		t.Errorf("Expected replayed state %v, got %v instead", want, replayed)
+	}
+}
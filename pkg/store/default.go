@@ -0,0 +1,42 @@
+package store
+
+import (
+	"time"
+)
+
+// defaultStore backs the package level functions.
+var defaultStore = New()
+
+// Default returns the Store used by the package level functions.
+func Default() *Store {
+	return defaultStore
+}
+
+// Put a value in the default store against a key. If the key already exists,
+// it is overwritten.
+func Put(k string, v []byte) error {
+	return defaultStore.Put(k, v)
+}
+
+// Get returns a value from the default store associated with a key.
+// Returns ErrorKeyNotFound if key does not exist.
+func Get(k string) ([]byte, error) {
+	return defaultStore.Get(k)
+}
+
+// Delete ensures that a key does not exist in the default store.
+// If a key is missing, the function passes silently.
+func Delete(k string) error {
+	return defaultStore.Delete(k)
+}
+
+// PutWithTTL puts a value in the default store against a key which expires after ttl.
+func PutWithTTL(k string, v []byte, ttl time.Duration) error {
+	return defaultStore.PutWithTTL(k, v, ttl)
+}
+
+// TTL returns the remaining time to live of a key in the default store,
+// or NoExpiry if the key never expires.
+func TTL(k string) (time.Duration, error) {
+	return defaultStore.TTL(k)
+}
@@ -0,0 +1,128 @@
+package store
+
+import (
+	"time"
+)
+
+// Entry is a value held by the store along with its metadata.
+// The value must not be modified, it is shared with the store.
+type Entry struct {
+	Value       []byte
+	ContentType string    // Media type of the value, empty if unknown
+	Flags       uint32    // Opaque flags of the value, such as those of memcached clients
+	Version     uint64    // Version of the store when the value was put
+	ExpiresAt   time.Time // Zero if the key never expires
+}
+
+// expired reports whether the entry has expired at the given time.
+func (e Entry) expired(now time.Time) bool {
+	return !e.ExpiresAt.IsZero() && !now.Before(e.ExpiresAt)
+}
+
+// Write is a modification of a key applied by an Engine.
+type Write struct {
+	// Key which is modified.
+	Key string
+	// Entry is the new entry of the key, unless Delete is set.
+	Entry Entry
+	// Delete removes the key instead of putting Entry.
+	Delete bool
+}
+
+// Engine holds the entries of a Store. The store serializes the calls to Apply, which are never
+// concurrent with any other call, but Get, Range and Len may be called concurrently.
+type Engine interface {
+	// Get returns the entry of a key, and false if the key is not present.
+	Get(k string) (Entry, bool, error)
+
+	// Apply applies the writes in order, atomically if the engine persists them, and records
+	// version as the last version assigned by the store.
+	Apply(writes []Write, version uint64) error
+
+	// Version returns the last version recorded by Apply, or 0 if Apply was never called.
+	Version() (uint64, error)
+
+	// Range calls fn with the keys in the range [start, end) in lexicographical order, along with
+	// their entry, until fn returns false. An empty end means that the range is unbounded.
+	Range(start, end string, fn func(k string, e Entry) bool) error
+
+	// Len returns the number of keys present.
+	Len() int
+
+	// Close releases the resources held by the engine.
+	Close() error
+}
+
+// memoryEngine is an Engine which holds the entries in memory.
+type memoryEngine struct {
+	m       map[string]Entry
+	index   *index // Keys of m in lexicographical order
+	version uint64
+}
+
+// NewMemoryEngine returns an empty Engine which holds the entries in memory,
+// with space preallocated for capacity keys.
+func NewMemoryEngine(capacity int) Engine {
+	return &memoryEngine{
+		m:     make(map[string]Entry, capacity),
+		index: newIndex(),
+	}
+}
+
+// Get returns the entry of a key, and false if the key is not present.
+func (m *memoryEngine) Get(k string) (Entry, bool, error) {
+	e, ok := m.m[k]
+	return e, ok, nil
+}
+
+// Apply applies the writes in order.
+func (m *memoryEngine) Apply(writes []Write, version uint64) error {
+	for _, w := range writes {
+		_, ok := m.m[w.Key]
+
+		if w.Delete {
+			if ok {
+				m.index.delete(w.Key)
+				delete(m.m, w.Key)
+			}
+			continue
+		}
+
+		if !ok {
+			m.index.insert(w.Key)
+		}
+		m.m[w.Key] = w.Entry
+	}
+	m.version = version
+
+	return nil
+}
+
+// Version returns the last version recorded by Apply.
+func (m *memoryEngine) Version() (uint64, error) {
+	return m.version, nil
+}
+
+// Range calls fn with the keys in the range [start, end) in lexicographical order.
+func (m *memoryEngine) Range(start, end string, fn func(k string, e Entry) bool) error {
+	for n := m.index.seek(start); n != nil; n = n.next[0] {
+		if end != "" && n.key >= end {
+			break
+		}
+		if !fn(n.key, m.m[n.key]) {
+			break
+		}
+	}
+
+	return nil
+}
+
+// Len returns the number of keys present.
+func (m *memoryEngine) Len() int {
+	return len(m.m)
+}
+
+// Close does nothing, the entries are dropped along with the engine.
+func (m *memoryEngine) Close() error {
+	return nil
+}
@@ -0,0 +1,170 @@
+package store
+
+import (
+	bolt "go.etcd.io/bbolt"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// engines returns an empty engine of each kind, closed at the end of the test.
+func engines(t *testing.T) map[string]Engine {
+	b, err := NewBoltEngine(filepath.Join(t.TempDir(), "data.db"))
+	if err != nil {
+		t.Fatalf("could not create engine: %v", err)
+	}
+	c, err := NewBoltEngine(filepath.Join(t.TempDir(), "data.db"))
+	if err != nil {
+		t.Fatalf("could not create engine: %v", err)
+	}
+
+	t.Cleanup(func() {
+		b.Close()
+		c.Close()
+	})
+
+	return map[string]Engine{
+		"memory": NewMemoryEngine(0),
+		"bolt":   b,
+		"cached": NewCachedEngine(c, 2),
+	}
+}
+
+func TestEngine(t *testing.T) {
+	expiresAt := time.Unix(0, time.Now().Add(time.Hour).UnixNano())
+
+	for name, e := range engines(t) {
+		t.Run(name, func(t *testing.T) {
+			err := e.Apply([]Write{
+				{Key: "b", Entry: Entry{Value: []byte("value-b"), Version: 1}},
+				{Key: "a", Entry: Entry{Value: []byte("value-a"), ContentType: "text/plain", Flags: 42, Version: 2, ExpiresAt: expiresAt}},
+				{Key: "c", Entry: Entry{Value: []byte("value-c"), Version: 3}},
+				{Key: "d", Delete: true},
+			}, 3)
+			if err != nil {
+				t.Fatalf("Expected err to be nil, got %v instead", err)
+			}
+			err = e.Apply([]Write{
+				{Key: "c", Delete: true},
+				{Key: "b", Entry: Entry{Value: []byte("value-b2"), Version: 4}},
+			}, 4)
+			if err != nil {
+				t.Fatalf("Expected err to be nil, got %v instead", err)
+			}
+
+			got, ok, err := e.Get("a")
+			if want := (Entry{Value: []byte("value-a"), ContentType: "text/plain", Flags: 42, Version: 2, ExpiresAt: expiresAt}); err != nil || !ok || !reflect.DeepEqual(got, want) {
+				t.Errorf("Expected entry %v, got %v, %v, %v instead", want, got, ok, err)
+			}
+			if _, ok, err := e.Get("c"); err != nil || ok {
+				t.Errorf("Expected the deleted key to be missing, got %v, %v", ok, err)
+			}
+
+			var keys []string
+			err = e.Range("a", "c", func(k string, e Entry) bool {
+				keys = append(keys, k+"="+string(e.Value))
+				return true
+			})
+			if want := []string{"a=value-a", "b=value-b2"}; err != nil || !reflect.DeepEqual(keys, want) {
+				t.Errorf("Expected range %v, got %v, %v instead", want, keys, err)
+			}
+
+			if n := e.Len(); n != 2 {
+				t.Errorf("Expected %d keys, got %d instead", 2, n)
+			}
+			if v, err := e.Version(); err != nil || v != 4 {
+				t.Errorf("Expected version %d, got %d, %v instead", 4, v, err)
+			}
+		})
+	}
+}
+
+func TestBoltEngineUpgrade(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.db")
+
+	// an entry of format 1 lacks the flags
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatalf("could not open database: %v", err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket(entriesBucket)
+		if err != nil {
+			return err
+		}
+		v := append(append(uint64Value(7), uint64Value(0)...), 10)
+		v = append(append(v, "text/plain"...), "value1"...)
+		return b.Put([]byte("testKey"), v)
+	})
+	db.Close()
+	if err != nil {
+		t.Fatalf("could not write entry: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		e, err := NewBoltEngine(path)
+		if err != nil {
+			t.Fatalf("could not create engine: %v", err)
+		}
+
+		got, ok, err := e.Get("testKey")
+		if want := (Entry{Value: []byte("value1"), ContentType: "text/plain", Version: 7}); err != nil || !ok || !reflect.DeepEqual(got, want) {
+			t.Errorf("Expected entry %v, got %v, %v, %v instead", want, got, ok, err)
+		}
+		e.Close()
+	}
+}
+
+func TestOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.db")
+
+	e, err := NewBoltEngine(path)
+	if err != nil {
+		t.Fatalf("could not create engine: %v", err)
+	}
+
+	s1, err := Open(e)
+	if err != nil {
+		t.Fatalf("Expected err to be nil, got %v instead", err)
+	}
+	s1.Put("testOpenKey1", []byte("value1"))
+	s1.PutWithExpiry("testOpenKey2", []byte("value2"), time.Now().Add(50*time.Millisecond))
+	version, _ := s1.PutIfAbsent("testOpenKey3", []byte("value3"))
+	s1.Close()
+	e.Close()
+
+	e, err = NewBoltEngine(path)
+	if err != nil {
+		t.Fatalf("could not create engine: %v", err)
+	}
+	defer e.Close()
+
+	s2, err := Open(e, WithExpiryInterval(10*time.Millisecond))
+	if err != nil {
+		t.Fatalf("Expected err to be nil, got %v instead", err)
+	}
+	defer s2.Close()
+
+	t.Run("pairs are persisted", func(t *testing.T) {
+		if v, _ := s2.Get("testOpenKey1"); string(v) != "value1" {
+			t.Errorf("Value was incorrect, expected: %s, got: %s", "value1", v)
+		}
+		if _, v, _ := s2.GetWithVersion("testOpenKey3"); v != version {
+			t.Errorf("Expected version %d, got %d instead", version, v)
+		}
+	})
+
+	t.Run("versions keep increasing", func(t *testing.T) {
+		if v, _ := s2.PutIfAbsent("testOpenKey4", []byte("value4")); v <= version {
+			t.Errorf("Expected a version greater than %d, got %d instead", version, v)
+		}
+	})
+
+	t.Run("expiring keys are swept", func(t *testing.T) {
+		time.Sleep(100 * time.Millisecond)
+		if n := s2.Len(); n != 3 {
+			t.Errorf("Expected %d keys, got %d instead", 3, n)
+		}
+	})
+}
@@ -0,0 +1,253 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// EvictionPolicy decides which keys are evicted to make room for writes once the store reaches its limits.
+type EvictionPolicy string
+
+const (
+	// EvictNone evicts no keys, writes which do not fit fail with ErrorStoreFull.
+	EvictNone EvictionPolicy = "noeviction"
+	// EvictLRU evicts the least recently used keys.
+	EvictLRU EvictionPolicy = "lru"
+	// EvictLFU evicts the least frequently read keys.
+	EvictLFU EvictionPolicy = "lfu"
+	// EvictRandom evicts random keys.
+	EvictRandom EvictionPolicy = "random"
+	// EvictVolatileTTL evicts the keys with an expiry which expire the soonest. Writes which
+	// do not fit fail with ErrorStoreFull if no key has an expiry.
+	EvictVolatileTTL EvictionPolicy = "volatile-ttl"
+)
+
+const (
+	// evictionSamples is the number of keys sampled to pick each key to evict. Like Redis, the
+	// policies are approximated by sampling, so that keys do not need to be kept sorted.
+	evictionSamples = 5
+
+	// entryOverhead is the estimated memory used by a key on top of the bytes of the key and the value.
+	entryOverhead = 96
+)
+
+var (
+	// ErrorStoreFull is returned to indicate that a write does not fit within the limits of the store,
+	// and that no key can be evicted to make room for it.
+	ErrorStoreFull = errors.New("Store full")
+
+	// ErrorInvalidEvictionPolicy is returned when the eviction policy is unknown.
+	ErrorInvalidEvictionPolicy = errors.New("Invalid eviction policy")
+)
+
+// ParseEvictionPolicy returns the eviction policy named p. An empty p stands for EvictLRU.
+func ParseEvictionPolicy(p string) (EvictionPolicy, error) {
+	switch policy := EvictionPolicy(p); policy {
+	case "":
+		return EvictLRU, nil
+	case EvictNone, EvictLRU, EvictLFU, EvictRandom, EvictVolatileTTL:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("%w: %q", ErrorInvalidEvictionPolicy, p)
+	}
+}
+
+// WithMaxKeys limits the number of keys in the store to n. 0 means no limit.
+func WithMaxKeys(n int) Option {
+	return func(s *Store) {
+		s.maxKeys = n
+	}
+}
+
+// WithMaxMemory limits the estimated memory used by the keys and values of the store to n bytes.
+// 0 means no limit.
+func WithMaxMemory(n int64) Option {
+	return func(s *Store) {
+		s.maxMemory = n
+	}
+}
+
+// WithEvictionPolicy sets the policy deciding which keys are evicted once the store reaches its limits.
+// It defaults to EvictLRU.
+func WithEvictionPolicy(p EvictionPolicy) Option {
+	return func(s *Store) {
+		s.policy = p
+	}
+}
+
+// usage is what the store knows about a key to pick the keys to evict.
+type usage struct {
+	accessed  int64     // Time of the last access in nanoseconds, updated atomically
+	hits      uint32    // Number of reads, updated atomically
+	size      int64     // Estimated memory used by the key and its value
+	expiresAt time.Time // Zero if the key never expires
+}
+
+// entrySize returns the estimated memory used by a key and its entry.
+func entrySize(k string, e Entry) int64 {
+	return int64(len(k)+len(e.Value)+len(e.ContentType)) + entryOverhead
+}
+
+// limited reports whether the store has limits, and so keeps track of the usage of the keys.
+func (s *Store) limited() bool {
+	return s.maxKeys > 0 || s.maxMemory > 0
+}
+
+// over reports whether a number of keys using an amount of memory exceed the limits of the store.
+func (s *Store) over(keys int, used int64) bool {
+	return (s.maxKeys > 0 && keys > s.maxKeys) || (s.maxMemory > 0 && used > s.maxMemory)
+}
+
+// Evictions returns the number of keys evicted since the store was created.
+func (s *Store) Evictions() uint64 {
+	return atomic.LoadUint64(&s.evictions)
+}
+
+// track updates the usage of the keys after the writes are applied. The caller must hold the lock.
+func (s *Store) track(writes []Write, now time.Time) {
+	if !s.limited() {
+		return
+	}
+
+	for _, w := range writes {
+		u, ok := s.usage[w.Key]
+		if ok {
+			s.used -= u.size
+		}
+
+		if w.Delete {
+			delete(s.usage, w.Key)
+			continue
+		}
+
+		if !ok {
+			u = &usage{}
+			s.usage[w.Key] = u
+		}
+		u.size = entrySize(w.Key, w.Entry)
+		u.expiresAt = w.Entry.ExpiresAt
+		atomic.StoreInt64(&u.accessed, now.UnixNano())
+		s.used += u.size
+	}
+}
+
+// touch records a read of a key. The caller must hold at least the read lock.
+func (s *Store) touch(k string, now time.Time) {
+	if u, ok := s.usage[k]; ok {
+		atomic.StoreInt64(&u.accessed, now.UnixNano())
+		atomic.AddUint32(&u.hits, 1)
+	}
+}
+
+// makeRoom returns the deletes of the keys to evict so that the writes fit within the limits
+// of the store, or ErrorStoreFull if there are not enough keys to evict. Writes which do not
+// grow the store are never refused. The caller must hold the lock.
+func (s *Store) makeRoom(writes []Write) ([]Write, error) {
+	if !s.limited() {
+		return nil, nil
+	}
+
+	// size of the keys once written, 0 for deleted keys, which are not evicted
+	sizes := make(map[string]int64, len(writes))
+	keys, used := len(s.usage), s.used
+
+	for _, w := range writes {
+		old, ok := sizes[w.Key]
+		if u, found := s.usage[w.Key]; !ok && found {
+			old = u.size
+		}
+
+		var size int64
+		if !w.Delete {
+			size = entrySize(w.Key, w.Entry)
+		}
+
+		if old == 0 && size != 0 {
+			keys++
+		} else if old != 0 && size == 0 {
+			keys--
+		}
+		used += size - old
+		sizes[w.Key] = size
+	}
+
+	var evictions []Write
+	for s.over(keys, used) {
+		k, ok := s.victim(sizes)
+		if !ok {
+			if keys <= len(s.usage) && used <= s.used {
+				break
+			}
+			return nil, ErrorStoreFull
+		}
+
+		evictions = append(evictions, Write{Key: k, Delete: true})
+		keys--
+		used -= s.usage[k].size
+		sizes[k] = 0
+	}
+
+	return evictions, nil
+}
+
+// victim returns the key to evict according to the policy among a sample of the keys,
+// skipping the excluded keys. It returns false if there is no key to evict.
+// The caller must hold the lock.
+func (s *Store) victim(excluded map[string]int64) (string, bool) {
+	var candidates map[string]struct{}
+	if s.policy == EvictNone {
+		return "", false
+	} else if s.policy == EvictVolatileTTL {
+		candidates = s.volatile
+	}
+
+	var victim string
+	var best *usage
+	samples := 0
+
+	// the iteration order of maps is randomized, which gives a random sample
+	sample := func(k string, u *usage) bool {
+		if _, ok := excluded[k]; ok {
+			return true
+		}
+
+		if best == nil || s.better(u, best) {
+			victim, best = k, u
+		}
+		samples++
+		return samples < evictionSamples && s.policy != EvictRandom
+	}
+
+	if candidates != nil {
+		for k := range candidates {
+			if !sample(k, s.usage[k]) {
+				break
+			}
+		}
+	} else {
+		for k, u := range s.usage {
+			if !sample(k, u) {
+				break
+			}
+		}
+	}
+
+	return victim, best != nil
+}
+
+// better reports whether u should be evicted rather than best according to the policy.
+func (s *Store) better(u, best *usage) bool {
+	switch s.policy {
+	case EvictLFU:
+		hits, bestHits := atomic.LoadUint32(&u.hits), atomic.LoadUint32(&best.hits)
+		if hits != bestHits {
+			return hits < bestHits
+		}
+	case EvictVolatileTTL:
+		return u.expiresAt.Before(best.expiresAt)
+	}
+
+	return atomic.LoadInt64(&u.accessed) < atomic.LoadInt64(&best.accessed)
+}
@@ -0,0 +1,160 @@
+package store
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEviction(t *testing.T) {
+	testCases := []struct {
+		name    string
+		policy  EvictionPolicy
+		setup   func(s *Store)
+		evicted string // key expected to be evicted, empty if any key may be
+		err     error  // expected error from the put
+	}{
+		{"lru", EvictLRU, func(s *Store) {
+			s.Put("a", []byte("value"))
+			s.Put("b", []byte("value"))
+			s.Put("c", []byte("value"))
+			time.Sleep(time.Millisecond)
+			s.Get("a")
+			s.Get("b")
+		}, "c", nil},
+		{"lfu", EvictLFU, func(s *Store) {
+			s.Put("a", []byte("value"))
+			s.Put("b", []byte("value"))
+			s.Put("c", []byte("value"))
+			s.Get("a")
+			s.Get("a")
+			s.Get("c")
+		}, "b", nil},
+		{"volatile-ttl", EvictVolatileTTL, func(s *Store) {
+			s.Put("a", []byte("value"))
+			s.PutWithTTL("b", []byte("value"), time.Hour)
+			s.PutWithTTL("c", []byte("value"), 2*time.Hour)
+		}, "b", nil},
+		{"random", EvictRandom, func(s *Store) {
+			s.Put("a", []byte("value"))
+			s.Put("b", []byte("value"))
+			s.Put("c", []byte("value"))
+		}, "", nil},
+		{"noeviction", EvictNone, func(s *Store) {
+			s.Put("a", []byte("value"))
+			s.Put("b", []byte("value"))
+			s.Put("c", []byte("value"))
+		}, "", ErrorStoreFull},
+		{"volatile-ttl without expiring keys", EvictVolatileTTL, func(s *Store) {
+			s.Put("a", []byte("value"))
+			s.Put("b", []byte("value"))
+			s.Put("c", []byte("value"))
+		}, "", ErrorStoreFull},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var changes []Change
+			s := New(WithMaxKeys(3), WithEvictionPolicy(tc.policy), WithCommitFunc(func(c []Change) <-chan error {
+				changes = c
+				return nil
+			}))
+			defer s.Close()
+
+			tc.setup(s)
+
+			err := s.Put("d", []byte("value"))
+			if err != tc.err {
+				t.Fatalf("Expected err to be %v, got %v instead", tc.err, err)
+			}
+			if s.Len() != 3 {
+				t.Errorf("Expected %d keys, got %d instead", 3, s.Len())
+			}
+			if err != nil {
+				if s.Evictions() != 0 {
+					t.Errorf("Expected no evictions, got %d", s.Evictions())
+				}
+				return
+			}
+
+			if s.Evictions() != 1 || len(changes) != 2 || changes[0].Type != ChangeEvict {
+				t.Fatalf("Expected one eviction to be committed before the put, got %d evictions and %v", s.Evictions(), changes)
+			}
+			if tc.evicted != "" && changes[0].Key != tc.evicted {
+				t.Errorf("Expected %s to be evicted, got %s instead", tc.evicted, changes[0].Key)
+			}
+			if _, err := s.Get(changes[0].Key); err != ErrorKeyNotFound {
+				t.Errorf("Expected the evicted key to be missing, got %v", err)
+			}
+		})
+	}
+}
+
+func TestEvictionLimits(t *testing.T) {
+	t.Run("max memory", func(t *testing.T) {
+		s := New(WithMaxMemory(3 * (entryOverhead + 2)))
+		defer s.Close()
+
+		for _, k := range []string{"k1", "k2", "k3", "k4"} {
+			if err := s.Put(k, []byte("")); err != nil {
+				t.Fatalf("Expected err to be %v, got %v instead", nil, err)
+			}
+		}
+		if s.Len() != 3 || s.Evictions() != 1 {
+			t.Errorf("Expected 3 keys and 1 eviction, got %d keys and %d evictions", s.Len(), s.Evictions())
+		}
+
+		// a value too large to fit even once every other key is evicted
+		if err := s.Put("k5", []byte(strings.Repeat("v", 3*entryOverhead))); err != ErrorStoreFull {
+			t.Errorf("Expected err to be %v, got %v instead", ErrorStoreFull, err)
+		}
+	})
+
+	t.Run("writes which do not grow the store are applied", func(t *testing.T) {
+		s := New(WithMaxKeys(2), WithEvictionPolicy(EvictNone))
+		defer s.Close()
+
+		s.Put("a", []byte("value"))
+		s.Put("b", []byte("value"))
+
+		if err := s.Put("a", []byte("value2")); err != nil {
+			t.Errorf("Expected err to be %v, got %v instead", nil, err)
+		}
+		_, err := s.Txn([]Op{{Type: OpDelete, Key: "a"}, {Type: OpPut, Key: "c", Value: []byte("value")}})
+		if err != nil {
+			t.Errorf("Expected err to be %v, got %v instead", nil, err)
+		}
+		_, err = s.Txn([]Op{{Type: OpPut, Key: "d", Value: []byte("value")}, {Type: OpDelete, Key: "b"}, {Type: OpPut, Key: "e", Value: []byte("value")}})
+		if err != ErrorStoreFull {
+			t.Errorf("Expected err to be %v, got %v instead", ErrorStoreFull, err)
+		}
+
+		kvs, _ := s.ScanPrefix("")
+		if keys := keysOf(kvs); !reflect.DeepEqual(keys, []string{"b", "c"}) {
+			t.Errorf("Expected keys [b c], got %v", keys)
+		}
+	})
+}
+
+func TestParseEvictionPolicy(t *testing.T) {
+	testCases := []struct {
+		policy string
+		want   EvictionPolicy
+		err    error
+	}{
+		{"", EvictLRU, nil},
+		{"lfu", EvictLFU, nil},
+		{"volatile-ttl", EvictVolatileTTL, nil},
+		{"noeviction", EvictNone, nil},
+		{"mru", "", ErrorInvalidEvictionPolicy},
+	}
+
+	for _, tc := range testCases {
+		policy, err := ParseEvictionPolicy(tc.policy)
+		if policy != tc.want || !errors.Is(err, tc.err) {
+			t.Errorf("Expected %q to be %q, %v, got %q, %v instead", tc.policy, tc.want, tc.err, policy, err)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package store
+
+import (
+	"math/rand"
+)
+
+const (
+	// maxLevel is the max number of levels of the index, enough for 4^maxLevel keys.
+	maxLevel = 24
+	// levelProbability is the probability of a node being promoted to the next level.
+	levelProbability = 0.25
+)
+
+// node is an element of the index.
+type node struct {
+	key  string
+	next []*node // Next node at each level
+}
+
+// index keeps the keys of the memory engine in lexicographical order using a skip list.
+// It is not safe for concurrent writes, the store lock must be held.
+type index struct {
+	head  *node // Sentinel before the first key
+	level int   // Number of levels currently in use
+	len   int
+	rnd   *rand.Rand
+}
+
+// newIndex returns an empty index.
+func newIndex() *index {
+	return &index{
+		head:  &node{next: make([]*node, maxLevel)},
+		level: 1,
+		rnd:   rand.New(rand.NewSource(rand.Int63())),
+	}
+}
+
+// randomLevel returns the level of a new node.
+func (idx *index) randomLevel() int {
+	level := 1
+	for level < maxLevel && idx.rnd.Float64() < levelProbability {
+		level++
+	}
+	return level
+}
+
+// findPrev fills prev with the last node before k at each level and returns the first node at or after k.
+func (idx *index) findPrev(k string, prev []*node) *node {
+	x := idx.head
+	for i := idx.level - 1; i >= 0; i-- {
+		for x.next[i] != nil && x.next[i].key < k {
+			x = x.next[i]
+		}
+		if prev != nil {
+			prev[i] = x
+		}
+	}
+	return x.next[0]
+}
+
+// insert adds a key to the index if it is not present already.
+func (idx *index) insert(k string) {
+	prev := make([]*node, maxLevel)
+	if n := idx.findPrev(k, prev); n != nil && n.key == k {
+		return
+	}
+
+	level := idx.randomLevel()
+	if level > idx.level {
+		for i := idx.level; i < level; i++ {
+			prev[i] = idx.head
+		}
+		idx.level = level
+	}
+
+	n := &node{key: k, next: make([]*node, level)}
+	for i := 0; i < level; i++ {
+		n.next[i] = prev[i].next[i]
+		prev[i].next[i] = n
+	}
+	idx.len++
+}
+
+// delete removes a key from the index if it is present.
+func (idx *index) delete(k string) {
+	prev := make([]*node, maxLevel)
+	n := idx.findPrev(k, prev)
+	if n == nil || n.key != k {
+		return
+	}
+
+	for i := 0; i < len(n.next); i++ {
+		prev[i].next[i] = n.next[i]
+	}
+	for idx.level > 1 && idx.head.next[idx.level-1] == nil {
+		idx.level--
+	}
+	idx.len--
+}
+
+// seek returns the first node with a key at or after k, or nil if there is none.
+func (idx *index) seek(k string) *node {
+	return idx.findPrev(k, nil)
+}
@@ -0,0 +1,59 @@
+package store
+
+import (
+	"time"
+)
+
+// KeyValue is a key-value pair returned by scans.
+// The value must not be modified, it is shared with the store.
+type KeyValue struct {
+	Key         string
+	Value       []byte
+	ContentType string
+	Version     uint64
+}
+
+// Scan returns the key-value pairs with keys in the range [start, end) in lexicographical order.
+// An empty end means that the range is unbounded, and a limit <= 0 means that all the pairs
+// in the range are returned. Expired keys are skipped.
+func (s *Store) Scan(start, end string, limit int) ([]KeyValue, error) {
+	var kvs []KeyValue
+	now := time.Now()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	err := s.engine.Range(start, end, func(k string, e Entry) bool {
+		if limit > 0 && len(kvs) == limit {
+			return false
+		}
+		if !e.expired(now) {
+			kvs = append(kvs, KeyValue{Key: k, Value: e.Value, ContentType: e.ContentType, Version: e.Version})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return kvs, nil
+}
+
+// ScanPrefix returns the key-value pairs with keys starting with prefix in lexicographical order.
+func (s *Store) ScanPrefix(prefix string) ([]KeyValue, error) {
+	return s.Scan(prefix, PrefixEnd(prefix), 0)
+}
+
+// PrefixEnd returns the smallest key which is greater than all the keys starting with prefix,
+// so that [prefix, PrefixEnd(prefix)) covers all of them. It returns an empty string, which
+// stands for an unbounded end, if there is no such key.
+func PrefixEnd(prefix string) string {
+	b := []byte(prefix)
+	for i := len(b) - 1; i >= 0; i-- {
+		if b[i] < 0xff {
+			b[i]++
+			return string(b[:i+1])
+		}
+	}
+	return ""
+}
@@ -0,0 +1,120 @@
+package store
+
+import (
+	"math/rand"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// keysOf returns the keys of the key-value pairs.
+func keysOf(kvs []KeyValue) []string {
+	keys := []string{}
+	for _, kv := range kvs {
+		keys = append(keys, kv.Key)
+	}
+	return keys
+}
+
+func TestScan(t *testing.T) {
+	s := New()
+	for _, k := range []string{"b", "a/2", "a/1", "c", "a/3", "a", "ab"} {
+		s.Put(k, []byte("value-"+k))
+	}
+	s.PutWithExpiry("a/4", []byte("value-a/4"), time.Now().Add(time.Millisecond))
+	s.Delete("c")
+	time.Sleep(2 * time.Millisecond)
+
+	testCases := []struct {
+		name  string
+		start string
+		end   string
+		limit int
+		keys  []string
+	}{
+		{"everything", "", "", 0, []string{"a", "a/1", "a/2", "a/3", "ab", "b"}},
+		{"bounded range", "a/", "ab", 0, []string{"a/1", "a/2", "a/3"}},
+		{"start is inclusive", "a/2", "", 2, []string{"a/2", "a/3"}},
+		{"end is exclusive", "", "a/2", 0, []string{"a", "a/1"}},
+		{"limit", "", "", 3, []string{"a", "a/1", "a/2"}},
+		{"empty range", "x", "", 0, []string{}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			kvs, err := s.Scan(tc.start, tc.end, tc.limit)
+			if err != nil {
+				t.Fatalf("Expected err to be nil, got %v instead", err)
+			}
+			if keys := keysOf(kvs); !reflect.DeepEqual(keys, tc.keys) {
+				t.Errorf("Expected keys %v, got %v", tc.keys, keys)
+			}
+		})
+	}
+
+	t.Run("prefix", func(t *testing.T) {
+		kvs, err := s.ScanPrefix("a/")
+		if err != nil {
+			t.Fatalf("Expected err to be nil, got %v instead", err)
+		}
+		if keys := keysOf(kvs); !reflect.DeepEqual(keys, []string{"a/1", "a/2", "a/3"}) {
+			t.Errorf("Expected keys [a/1 a/2 a/3], got %v", keys)
+		}
+		if string(kvs[0].Value) != "value-a/1" || kvs[0].Version == 0 {
+			t.Errorf("Expected value-a/1 with a version, got %v", kvs[0])
+		}
+	})
+}
+
+func TestPrefixEnd(t *testing.T) {
+	testCases := []struct {
+		prefix string
+		end    string
+	}{
+		{"", ""},
+		{"a", "b"},
+		{"a/", "a0"},
+		{"a\xff", "b"},
+		{"\xff\xff", ""},
+	}
+
+	for _, tc := range testCases {
+		if end := PrefixEnd(tc.prefix); end != tc.end {
+			t.Errorf("Expected end of %q to be %q, got %q", tc.prefix, tc.end, end)
+		}
+	}
+}
+
+func TestIndex(t *testing.T) {
+	idx := newIndex()
+	present := map[string]bool{}
+	rnd := rand.New(rand.NewSource(1))
+
+	for i := 0; i < 5000; i++ {
+		k := strconv.Itoa(rnd.Intn(1000))
+		if rnd.Intn(3) == 0 {
+			idx.delete(k)
+			delete(present, k)
+		} else {
+			idx.insert(k)
+			present[k] = true
+		}
+	}
+
+	want := []string{}
+	for k := range present {
+		want = append(want, k)
+	}
+	sort.Strings(want)
+
+	got := []string{}
+	for n := idx.seek(""); n != nil; n = n.next[0] {
+		got = append(got, n.key)
+	}
+
+	if !reflect.DeepEqual(got, want) || idx.len != len(want) {
+		t.Errorf("Expected the index to hold %d sorted keys, got %d keys, len %d", len(want), len(got), idx.len)
+	}
+}
@@ -0,0 +1,75 @@
+package store
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// snapshotEntry is the serialized form of a key-value pair in a snapshot.
+type snapshotEntry struct {
+	Key string `json:"key"`
+	// Data is the value, base64 encoded.
+	Data []byte `json:"data"`
+	// Value is the value in snapshots written before values could hold arbitrary bytes.
+	Value       string    `json:"value,omitempty"`
+	ContentType string    `json:"content_type,omitempty"`
+	Flags       uint32    `json:"flags,omitempty"`
+	ExpiresAt   time.Time `json:"expires_at,omitempty"`
+}
+
+// WriteSnapshot writes a point-in-time copy of all the live key-value pairs, and their expiries, to w.
+// Writers are only blocked while the pairs are copied in memory, not while they are written out.
+func (s *Store) WriteSnapshot(w io.Writer) error {
+	now := time.Now()
+
+	s.mu.RLock()
+	entries := make([]snapshotEntry, 0, s.engine.Len())
+	err := s.engine.Range("", "", func(k string, e Entry) bool {
+		if !e.expired(now) {
+			entries = append(entries, snapshotEntry{Key: k, Data: e.Value, ContentType: e.ContentType, Flags: e.Flags, ExpiresAt: e.ExpiresAt})
+		}
+		return true
+	})
+	s.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+
+	return bw.Flush()
+}
+
+// LoadSnapshot puts all the key-value pairs of a snapshot written by WriteSnapshot in the store.
+// Pairs which have expired since the snapshot was taken are skipped.
+func (s *Store) LoadSnapshot(r io.Reader) error {
+	dec := json.NewDecoder(bufio.NewReader(r))
+	for {
+		var e snapshotEntry
+
+		err := dec.Decode(&e)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if e.Data == nil {
+			e.Data = []byte(e.Value)
+		}
+
+		_, _, err = s.Apply([]Op{{Type: OpPut, Key: e.Key, Value: e.Data, ContentType: e.ContentType, Flags: e.Flags, ExpiresAt: e.ExpiresAt}})
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package store
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSnapshot(t *testing.T) {
+	s1 := New()
+	s1.Put("testSnapshotKey1", []byte("value1"))
+	s1.Put("testSnapshotKey2", []byte("value with\ttabs and\nnewlines"))
+	s1.PutWithTTL("testSnapshotKey3", []byte("value3"), time.Hour)
+	s1.PutWithExpiry("testSnapshotKey4", []byte("value4"), time.Now().Add(time.Millisecond))
+	time.Sleep(2 * time.Millisecond)
+
+	var buf bytes.Buffer
+	if err := s1.WriteSnapshot(&buf); err != nil {
+		t.Fatalf("Expected err to be nil, got %v instead", err)
+	}
+
+	s2 := New()
+	if err := s2.LoadSnapshot(&buf); err != nil {
+		t.Fatalf("Expected err to be nil, got %v instead", err)
+	}
+
+	kvs, err := s2.ScanPrefix("")
+	if err != nil {
+		t.Fatalf("Expected err to be nil, got %v instead", err)
+	}
+
+	want := []string{"testSnapshotKey1", "testSnapshotKey2", "testSnapshotKey3"}
+	if keys := keysOf(kvs); !reflect.DeepEqual(keys, want) {
+		t.Errorf("Expected keys %v, got %v", want, keys)
+	}
+
+	if v, _ := s2.Get("testSnapshotKey2"); string(v) != "value with\ttabs and\nnewlines" {
+		t.Errorf("Value was incorrect, got: %q", v)
+	}
+
+	if ttl, _ := s2.TTL("testSnapshotKey3"); ttl == NoExpiry || ttl > time.Hour {
+		t.Errorf("Expected the expiry to be restored, got ttl %v", ttl)
+	}
+}
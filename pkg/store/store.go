@@ -2,16 +2,19 @@ package store
 
 import (
 	"errors"
-	"fmt"
 	"sync"
+	"time"
 )
 
 const (
-	// MaxKeySize for store keys
+	// MaxKeySize is the default maximum size for store keys
 	MaxKeySize = 1024
 
-	// MaxValueSize for store values
+	// MaxValueSize is the default maximum size for store values
 	MaxValueSize = 1024
+
+	// ExpiryInterval is the default interval between two runs of the expiry sweeper
+	ExpiryInterval = time.Second
 )
 
 var (
@@ -19,59 +22,257 @@ var (
 	ErrorKeyNotFound = errors.New("Key not found")
 
 	// ErrorKeySizeTooLarge is returned to indicate that the key size is more than the max permittable size.
-	ErrorKeySizeTooLarge = fmt.Errorf("Key size too large, max permissible: %d", MaxKeySize)
+	ErrorKeySizeTooLarge = errors.New("Key size too large")
 
 	// ErrorValueSizeTooLarge is return to indicate that the value size is more than the max permittable size.
-	ErrorValueSizeTooLarge = fmt.Errorf("Value size too large, max permissible: %d", MaxValueSize)
+	ErrorValueSizeTooLarge = errors.New("Value size too large")
+
+	// ErrorVersionMismatch is returned to indicate that the condition of a conditional operation was not met.
+	ErrorVersionMismatch = errors.New("Version mismatch")
 )
 
-var store = struct {
-	sync.RWMutex
-	m map[string]string
-}{m: make(map[string]string)}
+// Store is a key-value store which is safe for concurrent use. Its entries are held by an Engine,
+// in memory unless another engine is given to Open.
+// The zero value is not usable, use New or Open to create a Store.
+type Store struct {
+	mu             sync.RWMutex
+	engine         Engine                     // Holds the entries
+	version        uint64                     // Last version assigned to a value
+	volatile       map[string]struct{}        // Keys which have an expiry set
+	capacity       int                        // Initial capacity of the memory engine
+	maxKeySize     int                        // Max permissible size of a key
+	maxValueSize   int                        // Max permissible size of a value
+	expiryInterval time.Duration              // Interval between two runs of the sweeper
+	onExpire       func(k string)             // Called after a key has expired
+	onCommit       CommitFunc                 // Called with the changes of every write
+	pending        map[string][]*pendingWrite // Writes of each key whose changes are yet to be recorded by onCommit, oldest first
+	hub            *Hub                       // Hub notified of the changes as they are applied, nil if none
+	published      uint64                     // Sequence number of the last change published to hub
+	maxKeys        int                        // Max number of keys, 0 means no limit
+	maxMemory      int64                      // Max estimated memory used by the keys, 0 means no limit
+	policy         EvictionPolicy             // Decides which keys are evicted once the limits are reached
+	usage          map[string]*usage          // Usage of each key, only tracked if the store has limits
+	used           int64                      // Estimated memory used by the keys, only tracked if the store has limits
+	evictions      uint64                     // Number of keys evicted, updated atomically
+	sweeperOnce    sync.Once                  // Makes sure that only one sweeper is started
+	closeOnce      sync.Once                  // Makes sure that done is closed only once
+	done           chan struct{}              // Closed to stop the sweeper
+}
 
-// Put a value in the store against a key. If the key already exists,
-// it is overwritten.
-func Put(k string, v string) error {
-	if len(k) > MaxKeySize {
-		return ErrorKeySizeTooLarge
+// Option configures a Store.
+type Option func(*Store)
+
+// WithMaxKeySize sets the max permissible size of a key.
+func WithMaxKeySize(n int) Option {
+	return func(s *Store) {
+		s.maxKeySize = n
 	}
-	if len(v) > MaxValueSize {
-		return ErrorValueSizeTooLarge
+}
+
+// WithMaxValueSize sets the max permissible size of a value.
+func WithMaxValueSize(n int) Option {
+	return func(s *Store) {
+		s.maxValueSize = n
 	}
+}
 
-	store.Lock()
-	store.m[k] = v
-	store.Unlock()
+// WithInitialCapacity preallocates space for n keys in the memory engine created by New.
+func WithInitialCapacity(n int) Option {
+	return func(s *Store) {
+		s.capacity = n
+	}
+}
 
-	return nil
+// WithExpiryInterval sets the interval between two runs of the expiry sweeper.
+func WithExpiryInterval(d time.Duration) Option {
+	return func(s *Store) {
+		s.expiryInterval = d
+	}
+}
+
+// WithExpireFunc registers f to be called with the key each time a key expires.
+// f is called without holding any locks on the store, so it can safely block.
+func WithExpireFunc(f func(k string)) Option {
+	return func(s *Store) {
+		s.onExpire = f
+	}
+}
+
+// New returns an empty Store which holds its entries in memory, configured with the given options.
+func New(opts ...Option) *Store {
+	s := newStore(opts)
+	s.engine = NewMemoryEngine(s.capacity)
+
+	return s
+}
+
+// Open returns a Store which holds its entries in e, configured with the given options.
+// The entries already held by e are served, and the keys among them which have an expiry
+// are read to be swept. The store does not close e, which is left to the caller.
+func Open(e Engine, opts ...Option) (*Store, error) {
+	s := newStore(opts)
+	s.engine = e
+
+	version, err := e.Version()
+	if err != nil {
+		return nil, err
+	}
+	s.version = version
+
+	now := time.Now()
+	err = e.Range("", "", func(k string, e Entry) bool {
+		if !e.ExpiresAt.IsZero() {
+			s.volatile[k] = struct{}{}
+		}
+		// the keys are read as if they had just been put
+		s.track([]Write{{Key: k, Entry: e}}, now)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(s.volatile) > 0 {
+		s.startSweeper()
+	}
+
+	return s, nil
+}
+
+// newStore returns a Store without an engine configured with the given options.
+func newStore(opts []Option) *Store {
+	s := &Store{
+		volatile:       make(map[string]struct{}),
+		pending:        make(map[string][]*pendingWrite),
+		policy:         EvictLRU,
+		usage:          make(map[string]*usage),
+		maxKeySize:     MaxKeySize,
+		maxValueSize:   MaxValueSize,
+		expiryInterval: ExpiryInterval,
+		done:           make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// MaxKeySize returns the max permissible size of a key.
+func (s *Store) MaxKeySize() int {
+	return s.maxKeySize
 }
 
-// Get returns a value from the store associated with a key.
-// Returns ErrorKeyNotFound if key does not exist.
-func Get(k string) (string, error) {
-	if len(k) > MaxKeySize {
-		return "", ErrorKeySizeTooLarge
+// MaxValueSize returns the max permissible size of a value.
+func (s *Store) MaxValueSize() int {
+	return s.maxValueSize
+}
+
+// Put a value in the store against a key. If the key already exists,
+// it is overwritten along with its expiry.
+func (s *Store) Put(k string, v []byte) error {
+	return s.PutWithExpiry(k, v, time.Time{})
+}
+
+// PutWithTTL puts a value in the store against a key which expires after ttl.
+func (s *Store) PutWithTTL(k string, v []byte, ttl time.Duration) error {
+	return s.PutWithExpiry(k, v, time.Now().Add(ttl))
+}
+
+// PutWithExpiry puts a value in the store against a key which expires at the given time.
+// A zero expiresAt means that the key never expires. If expiresAt is already in the past,
+// the key is removed from the store.
+func (s *Store) PutWithExpiry(k string, v []byte, expiresAt time.Time) error {
+	_, err := s.PutIf(k, v, expiresAt, nil)
+	return err
+}
+
+// PutIf puts a value in the store against a key which expires at the given time, only if
+// the current version of the key satisfies cond. A nil cond is always satisfied.
+// It returns the new version of the key, or ErrorVersionMismatch if cond was not satisfied.
+// A zero expiresAt means that the key never expires. If expiresAt is already in the past,
+// the key is removed from the store.
+func (s *Store) PutIf(k string, v []byte, expiresAt time.Time, cond Condition) (uint64, error) {
+	versions, _, err := s.Apply([]Op{{Type: OpPut, Key: k, Value: v, ExpiresAt: expiresAt, Cond: cond}})
+	if err != nil {
+		return 0, err
 	}
 
-	store.RLock()
-	v, ok := store.m[k]
-	store.RUnlock()
+	return versions[0], nil
+}
+
+// Get returns a value from the store associated with a key. The value must not be modified.
+// Returns ErrorKeyNotFound if key does not exist or has expired.
+func (s *Store) Get(k string) ([]byte, error) {
+	e, err := s.GetEntry(k)
+	return e.Value, err
+}
+
+// GetEntry returns a value from the store associated with a key along with its metadata.
+// Returns ErrorKeyNotFound if key does not exist or has expired.
+func (s *Store) GetEntry(k string) (Entry, error) {
+	if len(k) > s.maxKeySize {
+		return Entry{}, ErrorKeySizeTooLarge
+	}
 
+	e, ok, err := s.lookup(k, time.Now())
+	if err != nil {
+		return Entry{}, err
+	}
 	if !ok {
-		return "", ErrorKeyNotFound
+		return Entry{}, ErrorKeyNotFound
 	}
 
-	return v, nil
+	return e, nil
 }
 
 // Delete ensures that a key does not exist in the store.
 // If a key is missing, the function passes silently.
-func Delete(k string) error {
-	if len(k) > MaxKeySize {
-		return ErrorKeySizeTooLarge
+func (s *Store) Delete(k string) error {
+	return s.DeleteIf(k, nil)
+}
+
+// DeleteIf ensures that a key does not exist in the store, only if the current version
+// of the key satisfies cond. A nil cond is always satisfied.
+// Returns ErrorVersionMismatch if cond was not satisfied.
+func (s *Store) DeleteIf(k string, cond Condition) error {
+	_, _, err := s.Apply([]Op{{Type: OpDelete, Key: k, Cond: cond}})
+	return err
+}
+
+// write applies the writes to the engine and keeps track of the keys which have an expiry,
+// and of their usage. version is the last version assigned by the writes. The caller must hold the lock.
+func (s *Store) write(writes []Write, version uint64, now time.Time) error {
+	err := s.engine.Apply(writes, version)
+	if err != nil {
+		return err
 	}
+	s.version = version
+
+	for _, w := range writes {
+		if w.Delete || w.Entry.ExpiresAt.IsZero() {
+			delete(s.volatile, w.Key)
+		} else {
+			s.volatile[w.Key] = struct{}{}
+		}
+	}
+	s.track(writes, now)
 
-	delete(store.m, k)
 	return nil
 }
+
+// Len returns the number of keys in the store.
+// Keys which have expired but are yet to be removed are included.
+func (s *Store) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.engine.Len()
+}
+
+// Close stops the background expiry of keys.
+// The store remains usable, but expired keys are only removed when they are read.
+// The engine given to Open is not closed.
+func (s *Store) Close() {
+	s.closeOnce.Do(func() { close(s.done) })
+}
@@ -26,7 +26,7 @@ func TestPut(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			err := Put(tc.pkey, tc.pval)
+			err := Put(tc.pkey, []byte(tc.pval))
 			if err != tc.err {
 				t.Errorf("Error was incorrect, expected: %v, got: %v", tc.err, err)
 			}
@@ -37,7 +37,7 @@ func TestPut(t *testing.T) {
 			}
 
 			v, _ := Get(tc.pkey)
-			if v != tc.gval {
+			if string(v) != tc.gval {
 				t.Errorf("Value was incorrect, expected: %s, got: %s", tc.gval, v)
 			}
 		})
@@ -54,10 +54,10 @@ func TestGet(t *testing.T) {
 
 	t.Run("value present in store", func(t *testing.T) {
 		v0 := "value1"
-		Put("testGetKey1", v0)
+		Put("testGetKey1", []byte(v0))
 		v, err := Get("testGetKey1")
 
-		if v != v0 {
+		if string(v) != v0 {
 			t.Errorf("Value was incorrect, expected %s, got %s", v0, v)
 		}
 
@@ -76,7 +76,7 @@ func TestGet(t *testing.T) {
 }
 
 func TestDelete(t *testing.T) {
-	Put("testKeyDelete1", "value1")
+	Put("testKeyDelete1", []byte("value1"))
 
 	testCases := []struct {
 		name string
@@ -97,3 +97,34 @@ func TestDelete(t *testing.T) {
 		})
 	}
 }
+
+func TestNew(t *testing.T) {
+	t.Run("stores are independent", func(t *testing.T) {
+		s1, s2 := New(), New()
+
+		s1.Put("testNewKey1", []byte("value1"))
+		if _, err := s2.Get("testNewKey1"); err != ErrorKeyNotFound {
+			t.Errorf("Expected to throw %v, got %v", ErrorKeyNotFound, err)
+		}
+		if s1.Len() != 1 || s2.Len() != 0 {
+			t.Errorf("Expected lengths 1 and 0, got %d and %d", s1.Len(), s2.Len())
+		}
+	})
+
+	t.Run("custom size limits", func(t *testing.T) {
+		s := New(WithMaxKeySize(4), WithMaxValueSize(8), WithInitialCapacity(16))
+
+		if err := s.Put("12345", []byte("value")); err != ErrorKeySizeTooLarge {
+			t.Errorf("Expected to throw %v, got %v", ErrorKeySizeTooLarge, err)
+		}
+		if err := s.Put("1234", []byte("123456789")); err != ErrorValueSizeTooLarge {
+			t.Errorf("Expected to throw %v, got %v", ErrorValueSizeTooLarge, err)
+		}
+		if err := s.Put("1234", []byte("12345678")); err != nil {
+			t.Errorf("Expected err to be nil, got %v instead", err)
+		}
+		if s.MaxKeySize() != 4 || s.MaxValueSize() != 8 {
+			t.Errorf("Expected limits 4 and 8, got %d and %d", s.MaxKeySize(), s.MaxValueSize())
+		}
+	})
+}
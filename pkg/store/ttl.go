@@ -0,0 +1,125 @@
+package store
+
+import (
+	"time"
+)
+
+// NoExpiry is returned by TTL for keys which never expire.
+const NoExpiry time.Duration = -1
+
+// TTL returns the remaining time to live of a key, or NoExpiry if the key never expires.
+// Returns ErrorKeyNotFound if key does not exist or has expired.
+func (s *Store) TTL(k string) (time.Duration, error) {
+	if len(k) > s.maxKeySize {
+		return 0, ErrorKeySizeTooLarge
+	}
+
+	now := time.Now()
+
+	e, ok, err := s.lookup(k, now)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return 0, ErrorKeyNotFound
+	}
+	if e.ExpiresAt.IsZero() {
+		return NoExpiry, nil
+	}
+
+	return e.ExpiresAt.Sub(now), nil
+}
+
+// lookup returns the entry associated with a key, removing it first if it has expired at the given time.
+func (s *Store) lookup(k string, now time.Time) (Entry, bool, error) {
+	s.mu.RLock()
+	e, ok, err := s.engine.Get(k)
+	if ok && s.limited() {
+		s.touch(k, now)
+	}
+	s.mu.RUnlock()
+
+	if err != nil {
+		return Entry{}, false, err
+	}
+	if ok && e.expired(now) {
+		s.expire(k, now)
+		return Entry{}, false, nil
+	}
+
+	return e, ok, nil
+}
+
+// expire removes a key if it has expired at the given time and notifies onCommit and onExpire.
+// If the engine fails, the key is left to be removed by a later read or sweep.
+func (s *Store) expire(k string, now time.Time) {
+	s.mu.Lock()
+	e, ok, err := s.engine.Get(k)
+	ok = err == nil && ok && e.expired(now)
+	writes := []Write{{Key: k, Delete: true}}
+	var undo []Write
+	if ok {
+		undo, err = s.undo(writes)
+		ok = err == nil && s.write(writes, s.version, now) == nil
+	}
+	if ok {
+		s.commit([]Change{{Type: ChangeExpire, Key: k}}, undo)
+	}
+	s.mu.Unlock()
+
+	if ok && s.onExpire != nil {
+		s.onExpire(k)
+	}
+}
+
+// expireAll removes all the keys which have expired at the given time and notifies onCommit and onExpire.
+func (s *Store) expireAll(now time.Time) {
+	var expired []string
+	var writes []Write
+	var changes []Change
+
+	s.mu.Lock()
+	for k := range s.volatile {
+		e, ok, err := s.engine.Get(k)
+		if err == nil && ok && e.expired(now) {
+			expired = append(expired, k)
+			writes = append(writes, Write{Key: k, Delete: true})
+			changes = append(changes, Change{Type: ChangeExpire, Key: k})
+		}
+	}
+	// if the engine fails, the keys are left to be removed by the next sweep
+	undo, err := s.undo(writes)
+	if len(writes) > 0 && (err != nil || s.write(writes, s.version, now) != nil) {
+		expired = nil
+		changes = nil
+	}
+	s.commit(changes, undo)
+	s.mu.Unlock()
+
+	if s.onExpire != nil {
+		for _, k := range expired {
+			s.onExpire(k)
+		}
+	}
+}
+
+// startSweeper starts the sweeper if it is not running already.
+func (s *Store) startSweeper() {
+	s.sweeperOnce.Do(func() { go s.sweep() })
+}
+
+// sweep actively removes expired keys every expiryInterval until the store is closed.
+// Should be started as a goroutine.
+func (s *Store) sweep() {
+	ticker := time.NewTicker(s.expiryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			s.expireAll(now)
+		case <-s.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package store
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTTL(t *testing.T) {
+	s := New()
+	defer s.Close()
+
+	s.Put("testTTLKey1", []byte("value1"))
+	s.PutWithTTL("testTTLKey2", []byte("value2"), time.Minute)
+
+	testCases := []struct {
+		name string
+		key  string
+		min  time.Duration // expected minimum ttl
+		max  time.Duration // expected maximum ttl
+		err  error
+	}{
+		{"key without expiry", "testTTLKey1", NoExpiry, NoExpiry, nil},
+		{"key with expiry", "testTTLKey2", 59 * time.Second, time.Minute, nil},
+		{"missing key", "testTTLKey3", 0, 0, ErrorKeyNotFound},
+		{"key too large", getALongString(), 0, 0, ErrorKeySizeTooLarge},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ttl, err := s.TTL(tc.key)
+			if err != tc.err {
+				t.Errorf("Expected err to be %v, got %v instead", tc.err, err)
+			}
+			if ttl < tc.min || ttl > tc.max {
+				t.Errorf("Expected ttl between %v and %v, got %v", tc.min, tc.max, ttl)
+			}
+		})
+	}
+
+	t.Run("put clears expiry", func(t *testing.T) {
+		s.Put("testTTLKey2", []byte("value3"))
+
+		ttl, _ := s.TTL("testTTLKey2")
+		if ttl != NoExpiry {
+			t.Errorf("Expected ttl to be %v, got %v", NoExpiry, ttl)
+		}
+	})
+}
+
+func TestExpiry(t *testing.T) {
+	var mu sync.Mutex
+	var expired []string
+
+	s := New(WithExpiryInterval(10*time.Millisecond), WithExpireFunc(func(k string) {
+		mu.Lock()
+		expired = append(expired, k)
+		mu.Unlock()
+	}))
+	defer s.Close()
+
+	t.Run("lazy expiry on get", func(t *testing.T) {
+		s.PutWithExpiry("testExpiryKey1", []byte("value1"), time.Now().Add(time.Millisecond))
+		time.Sleep(2 * time.Millisecond)
+
+		// the sweeper may remove the key first, either way it must be gone
+		if _, err := s.Get("testExpiryKey1"); err != ErrorKeyNotFound {
+			t.Errorf("Expected to throw %v, got %v", ErrorKeyNotFound, err)
+		}
+	})
+
+	t.Run("active expiry by the sweeper", func(t *testing.T) {
+		s.PutWithTTL("testExpiryKey2", []byte("value2"), 5*time.Millisecond)
+		time.Sleep(100 * time.Millisecond)
+
+		if s.Len() != 0 {
+			t.Errorf("Expected the store to be empty, got %d keys", s.Len())
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if len(expired) != 2 {
+			t.Errorf("Expected 2 keys to be expired, got %v", expired)
+		}
+	})
+
+	t.Run("put with expiry in the past", func(t *testing.T) {
+		s.Put("testExpiryKey3", []byte("value3"))
+		s.PutWithExpiry("testExpiryKey3", []byte("value3"), time.Now().Add(-time.Second))
+
+		if _, err := s.Get("testExpiryKey3"); err != ErrorKeyNotFound {
+			t.Errorf("Expected to throw %v, got %v", ErrorKeyNotFound, err)
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if len(expired) != 2 {
+			t.Errorf("Expected no more keys to be expired, got %v", expired)
+		}
+	})
+}
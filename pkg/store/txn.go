@@ -0,0 +1,150 @@
+package store
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// ErrorInvalidOp is returned by Txn to indicate that an operation has an unknown type.
+var ErrorInvalidOp = errors.New("Invalid operation")
+
+// OpType is the type of an operation in a transaction.
+type OpType byte
+
+const (
+	// OpDelete ensures that a key does not exist in the store.
+	OpDelete OpType = iota
+	// OpPut puts a value in the store against a key.
+	OpPut
+)
+
+// Op is a single operation in a transaction.
+type Op struct {
+	// Type of the operation.
+	Type OpType
+	// Key which the operation is operating on.
+	Key string
+	// Value is only used if the Type is OpPut. It is copied, so it can be modified once the operation is applied.
+	Value []byte
+	// ContentType is the media type of the value, empty if unknown. It is only used if the Type is OpPut.
+	ContentType string
+	// Flags are opaque flags kept along with the value, such as those of memcached clients. They are only used if the Type is OpPut.
+	Flags uint32
+	// ExpiresAt is only used if the Type is OpPut. Zero means that the key never expires.
+	ExpiresAt time.Time
+	// Cond, if not nil, must be satisfied by the version of the key for the transaction to be applied.
+	Cond Condition
+}
+
+// Txn atomically applies a list of operations in order. Either all of the operations
+// are applied, or none of them are: every operation is validated, and every condition is
+// checked against the state of the store before the transaction, prior to applying any of them.
+// It returns the new version of each key put, and 0 for each key deleted.
+func (s *Store) Txn(ops []Op) ([]uint64, error) {
+	versions, _, err := s.Apply(ops)
+	return versions, err
+}
+
+// Apply atomically applies a list of operations like Txn. It also returns a channel receiving the
+// result of recording the changes of the operations by the CommitFunc, which is nil if there is
+// no CommitFunc. If they could not be recorded, the operations are undone before it receives the error.
+func (s *Store) Apply(ops []Op) ([]uint64, <-chan error, error) {
+	volatile := false
+
+	for _, op := range ops {
+		if op.Type != OpPut && op.Type != OpDelete {
+			return nil, nil, ErrorInvalidOp
+		}
+		if len(op.Key) > s.maxKeySize {
+			return nil, nil, ErrorKeySizeTooLarge
+		}
+		if op.Type == OpPut && len(op.Value) > s.maxValueSize {
+			return nil, nil, ErrorValueSizeTooLarge
+		}
+		if op.Type == OpPut && !op.ExpiresAt.IsZero() {
+			volatile = true
+		}
+	}
+
+	now := time.Now()
+	versions := make([]uint64, len(ops))
+	changes := make([]Change, len(ops))
+
+	writes := make([]Write, len(ops))
+
+	s.mu.Lock()
+	for _, op := range ops {
+		if op.Cond == nil {
+			continue
+		}
+
+		version, err := s.currentVersion(op.Key, now)
+		if err != nil {
+			s.mu.Unlock()
+			return nil, nil, err
+		}
+		if !op.Cond(version) {
+			s.mu.Unlock()
+			return nil, nil, ErrorVersionMismatch
+		}
+	}
+
+	version := s.version
+	for i, op := range ops {
+		switch op.Type {
+		case OpPut:
+			version++
+			e := Entry{Value: copyBytes(op.Value), ContentType: op.ContentType, Flags: op.Flags, Version: version, ExpiresAt: op.ExpiresAt}
+			// a value which has already expired is not stored
+			writes[i] = Write{Key: op.Key, Entry: e, Delete: e.expired(now)}
+			versions[i] = version
+			changes[i] = Change{Type: ChangePut, Key: op.Key, Value: e.Value, ContentType: op.ContentType, Flags: op.Flags, ExpiresAt: op.ExpiresAt}
+		case OpDelete:
+			writes[i] = Write{Key: op.Key, Delete: true}
+			changes[i] = Change{Type: ChangeDelete, Key: op.Key}
+		}
+	}
+
+	evictions, err := s.makeRoom(writes)
+	if err != nil {
+		s.mu.Unlock()
+		return nil, nil, err
+	}
+	if len(evictions) > 0 {
+		// the keys are evicted before the writes which they make room for
+		evicted := make([]Change, len(evictions))
+		for i, w := range evictions {
+			evicted[i] = Change{Type: ChangeEvict, Key: w.Key}
+		}
+		writes = append(evictions, writes...)
+		changes = append(evicted, changes...)
+	}
+
+	undo, err := s.undo(writes)
+	if err != nil {
+		s.mu.Unlock()
+		return nil, nil, err
+	}
+
+	// nothing is logged unless the engine has applied the writes
+	if err := s.write(writes, version, now); err != nil {
+		s.mu.Unlock()
+		return nil, nil, err
+	}
+	done := s.commit(changes, undo)
+	s.mu.Unlock()
+
+	atomic.AddUint64(&s.evictions, uint64(len(evictions)))
+
+	if volatile {
+		s.startSweeper()
+	}
+
+	return versions, done, nil
+}
+
+// copyBytes returns a copy of b, which is never nil so that empty values are told apart from missing ones.
+func copyBytes(b []byte) []byte {
+	return append([]byte{}, b...)
+}
@@ -0,0 +1,64 @@
+package store
+
+import (
+	"testing"
+)
+
+func TestTxn(t *testing.T) {
+	s := New()
+	s.Put("testTxnKey1", []byte("value1"))
+	s.Put("testTxnKey2", []byte("value2"))
+	_, version, _ := s.GetWithVersion("testTxnKey1")
+
+	testCases := []struct {
+		name string
+		ops  []Op
+		err  error
+		want map[string]string // expected state after the transaction, "" if missing
+	}{
+		{"key too large", []Op{
+			{Type: OpPut, Key: "testTxnKey3", Value: []byte("value3")},
+			{Type: OpPut, Key: getALongString(), Value: []byte("value4")},
+		}, ErrorKeySizeTooLarge, map[string]string{"testTxnKey3": ""}},
+		{"value too large", []Op{
+			{Type: OpDelete, Key: "testTxnKey1"},
+			{Type: OpPut, Key: "testTxnKey3", Value: []byte(getALongString())},
+		}, ErrorValueSizeTooLarge, map[string]string{"testTxnKey1": "value1"}},
+		{"invalid operation", []Op{
+			{Type: OpDelete, Key: "testTxnKey1"},
+			{Type: OpType(42), Key: "testTxnKey2"},
+		}, ErrorInvalidOp, map[string]string{"testTxnKey1": "value1"}},
+		{"condition not met", []Op{
+			{Type: OpDelete, Key: "testTxnKey1"},
+			{Type: OpPut, Key: "testTxnKey2", Value: []byte("value3"), Cond: IfAbsent()},
+		}, ErrorVersionMismatch, map[string]string{"testTxnKey1": "value1", "testTxnKey2": "value2"}},
+		{"puts and deletes", []Op{
+			{Type: OpPut, Key: "testTxnKey1", Value: []byte("value3"), Cond: IfVersion(version)},
+			{Type: OpDelete, Key: "testTxnKey2"},
+			{Type: OpPut, Key: "testTxnKey3", Value: []byte("value4"), Cond: IfAbsent()},
+			{Type: OpPut, Key: "testTxnKey3", Value: []byte("value5")},
+		}, nil, map[string]string{"testTxnKey1": "value3", "testTxnKey2": "", "testTxnKey3": "value5"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			versions, err := s.Txn(tc.ops)
+			if err != tc.err {
+				t.Errorf("Expected err to be %v, got %v instead", tc.err, err)
+			}
+			if err == nil && len(versions) != len(tc.ops) {
+				t.Errorf("Expected %d versions, got %v", len(tc.ops), versions)
+			}
+
+			for k, want := range tc.want {
+				v, err := s.Get(k)
+				if want == "" && err != ErrorKeyNotFound {
+					t.Errorf("Expected %s to be missing, got %s", k, v)
+				}
+				if want != "" && string(v) != want {
+					t.Errorf("Value of %s was incorrect, expected: %s, got: %s", k, want, v)
+				}
+			}
+		})
+	}
+}
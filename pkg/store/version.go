@@ -0,0 +1,60 @@
+package store
+
+import (
+	"time"
+)
+
+// Condition is a predicate on the current version of a key which guards conditional operations.
+// Every put assigns a new version to the key which is greater than all the versions assigned before.
+// A key which does not exist has version 0.
+type Condition func(version uint64) bool
+
+// IfVersion is satisfied if the current version of the key is v.
+func IfVersion(v uint64) Condition {
+	return func(version uint64) bool {
+		return version == v
+	}
+}
+
+// IfAbsent is satisfied if the key does not exist.
+func IfAbsent() Condition {
+	return IfVersion(0)
+}
+
+// IfPresent is satisfied if the key exists.
+func IfPresent() Condition {
+	return func(version uint64) bool {
+		return version != 0
+	}
+}
+
+// GetWithVersion returns a value from the store associated with a key along with its version.
+// The value must not be modified. Returns ErrorKeyNotFound if key does not exist or has expired.
+func (s *Store) GetWithVersion(k string) ([]byte, uint64, error) {
+	e, err := s.GetEntry(k)
+	return e.Value, e.Version, err
+}
+
+// CompareAndSwap puts a value in the store against a key only if the current version
+// of the key is expectedVersion, and returns the new version.
+// Returns ErrorVersionMismatch if the key was modified in the meantime.
+func (s *Store) CompareAndSwap(k string, expectedVersion uint64, v []byte) (uint64, error) {
+	return s.PutIf(k, v, time.Time{}, IfVersion(expectedVersion))
+}
+
+// PutIfAbsent puts a value in the store against a key only if the key does not exist,
+// and returns the new version. Returns ErrorVersionMismatch if the key already exists.
+func (s *Store) PutIfAbsent(k string, v []byte) (uint64, error) {
+	return s.PutIf(k, v, time.Time{}, IfAbsent())
+}
+
+// currentVersion returns the version of a key at the given time, or 0 if it does not exist.
+// The caller must hold the lock.
+func (s *Store) currentVersion(k string, now time.Time) (uint64, error) {
+	e, ok, err := s.engine.Get(k)
+	if err != nil || !ok || e.expired(now) {
+		return 0, err
+	}
+
+	return e.Version, nil
+}
@@ -0,0 +1,71 @@
+package store
+
+import (
+	"testing"
+	"time"
+)
+
+func TestVersion(t *testing.T) {
+	s := New()
+
+	v1, err := s.PutIfAbsent("testVersionKey1", []byte("value1"))
+	if err != nil {
+		t.Fatalf("Expected err to be nil, got %v instead", err)
+	}
+
+	t.Run("put if absent on existing key", func(t *testing.T) {
+		_, err := s.PutIfAbsent("testVersionKey1", []byte("value2"))
+		if err != ErrorVersionMismatch {
+			t.Errorf("Expected to throw %v, got %v", ErrorVersionMismatch, err)
+		}
+	})
+
+	t.Run("get returns the version", func(t *testing.T) {
+		v, version, err := s.GetWithVersion("testVersionKey1")
+		if string(v) != "value1" || version != v1 || err != nil {
+			t.Errorf("Expected (value1, %d, nil), got (%s, %d, %v)", v1, v, version, err)
+		}
+	})
+
+	t.Run("compare and swap with a stale version", func(t *testing.T) {
+		_, err := s.CompareAndSwap("testVersionKey1", v1+1, []byte("value2"))
+		if err != ErrorVersionMismatch {
+			t.Errorf("Expected to throw %v, got %v", ErrorVersionMismatch, err)
+		}
+	})
+
+	t.Run("compare and swap with the current version", func(t *testing.T) {
+		v2, err := s.CompareAndSwap("testVersionKey1", v1, []byte("value2"))
+		if err != nil {
+			t.Fatalf("Expected err to be nil, got %v instead", err)
+		}
+		if v2 <= v1 {
+			t.Errorf("Expected version to increase from %d, got %d", v1, v2)
+		}
+
+		v, _ := s.Get("testVersionKey1")
+		if string(v) != "value2" {
+			t.Errorf("Value was incorrect, expected: value2, got: %s", v)
+		}
+	})
+
+	t.Run("versions increase across keys", func(t *testing.T) {
+		_, before, _ := s.GetWithVersion("testVersionKey1")
+		v3, _ := s.PutIf("testVersionKey2", []byte("value3"), time.Time{}, nil)
+		if v3 <= before {
+			t.Errorf("Expected version to be greater than %d, got %d", before, v3)
+		}
+	})
+
+	t.Run("delete if", func(t *testing.T) {
+		if err := s.DeleteIf("testVersionKey1", IfVersion(v1)); err != ErrorVersionMismatch {
+			t.Errorf("Expected to throw %v, got %v", ErrorVersionMismatch, err)
+		}
+		if err := s.DeleteIf("testVersionKey1", IfPresent()); err != nil {
+			t.Errorf("Expected err to be nil, got %v instead", err)
+		}
+		if _, err := s.Get("testVersionKey1"); err != ErrorKeyNotFound {
+			t.Errorf("Expected to throw %v, got %v", ErrorKeyNotFound, err)
+		}
+	})
+}
@@ -0,0 +1,142 @@
+package store
+
+import (
+	"errors"
+	"strings"
+	"sync"
+)
+
+// ErrorWatcherLagged is returned by Watcher.Err if the watcher was closed because it did not keep up with the changes.
+var ErrorWatcherLagged = errors.New("Watcher fell behind the changes")
+
+// watcherBuffer is the number of notifications a watcher can fall behind before it is closed.
+const watcherBuffer = 1024
+
+// Notification is a change published to the watchers, along with its sequence number in the
+// transaction log, so that a watcher can resume from it by reading the log.
+type Notification struct {
+	// Sequence number of the change in the transaction log.
+	Sequence uint64
+	Change
+}
+
+// Hub publishes the changes applied to the store to the watchers of their keys, in the order they
+// were applied. It is fed either by the store itself, see WithHub, or by the transaction log the
+// changes are persisted to, so that watchers only see changes which survive a restart and can
+// resume from their sequence numbers in the log.
+type Hub struct {
+	mu       sync.Mutex
+	watchers map[*Watcher]struct{}
+}
+
+// WithHub publishes the changes of every write to h as they are applied, numbered from 1 in that order.
+// A change may be undone afterwards if the CommitFunc fails to record it. To only publish the changes
+// once they are persisted, numbered as in the transaction log, the logger must feed h instead.
+func WithHub(h *Hub) Option {
+	return func(s *Store) {
+		s.hub = h
+	}
+}
+
+// NewHub returns a hub without any watcher.
+func NewHub() *Hub {
+	return &Hub{watchers: make(map[*Watcher]struct{})}
+}
+
+// Publish sends the notifications to the watchers of their keys in order. It never blocks:
+// a watcher which has fallen behind by more than watcherBuffer notifications is closed.
+func (h *Hub) Publish(ns []Notification) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for w := range h.watchers {
+		for _, n := range ns {
+			if !strings.HasPrefix(n.Key, w.prefix) {
+				continue
+			}
+
+			// notifications are only sent with the lock held, so a channel with room cannot fill up meanwhile
+			if len(w.ch) == cap(w.ch) {
+				w.err = ErrorWatcherLagged
+				h.remove(w)
+				break
+			}
+			w.ch <- n
+		}
+	}
+}
+
+// Watch returns a watcher receiving the notifications of the keys starting with prefix
+// published from now on. An empty prefix watches every key.
+func (h *Hub) Watch(prefix string) *Watcher {
+	w := &Watcher{hub: h, prefix: prefix, ch: make(chan Notification, watcherBuffer)}
+
+	h.mu.Lock()
+	h.watchers[w] = struct{}{}
+	h.mu.Unlock()
+
+	return w
+}
+
+// Len returns the number of watchers.
+func (h *Hub) Len() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return len(h.watchers)
+}
+
+// remove closes a watcher if it is still registered. The caller must hold the lock.
+func (h *Hub) remove(w *Watcher) {
+	if _, ok := h.watchers[w]; ok {
+		delete(h.watchers, w)
+		close(w.ch)
+	}
+}
+
+// Watcher receives the notifications of the keys starting with a prefix.
+type Watcher struct {
+	hub    *Hub
+	prefix string
+	ch     chan Notification
+	err    error // Reason why the hub closed the watcher, set before ch is closed
+}
+
+// Prefix returns the prefix of the keys watched.
+func (w *Watcher) Prefix() string {
+	return w.prefix
+}
+
+// Notifications returns the channel receiving the notifications in order.
+// It is closed once the watcher is closed.
+func (w *Watcher) Notifications() <-chan Notification {
+	return w.ch
+}
+
+// Err returns ErrorWatcherLagged if the hub closed the watcher because it fell behind, and nil otherwise.
+// It must only be called once the notifications channel is closed.
+func (w *Watcher) Err() error {
+	return w.err
+}
+
+// Close stops the watcher and closes its notifications channel. It can be called more than once.
+func (w *Watcher) Close() {
+	w.hub.mu.Lock()
+	defer w.hub.mu.Unlock()
+
+	w.hub.remove(w)
+}
+
+// publish sends the changes of a write to the hub of the store, if any. The caller must hold the lock.
+func (s *Store) publish(changes []Change) {
+	if s.hub == nil || len(changes) == 0 {
+		return
+	}
+
+	ns := make([]Notification, len(changes))
+	for i, c := range changes {
+		s.published++
+		ns[i] = Notification{Sequence: s.published, Change: c}
+	}
+	s.hub.Publish(ns)
+}
@@ -0,0 +1,127 @@
+package store
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// receive reads the notifications available on the watcher without blocking.
+func receive(w *Watcher) []Notification {
+	var got []Notification
+	for {
+		select {
+		case n, ok := <-w.Notifications():
+			if !ok {
+				return got
+			}
+			got = append(got, n)
+		default:
+			return got
+		}
+	}
+}
+
+func TestHub(t *testing.T) {
+	h := NewHub()
+
+	all := h.Watch("")
+	prefixed := h.Watch("a/")
+	defer all.Close()
+	defer prefixed.Close()
+
+	ns := []Notification{
+		{Sequence: 1, Change: Change{Type: ChangePut, Key: "a/1", Value: []byte("value1")}},
+		{Sequence: 2, Change: Change{Type: ChangePut, Key: "b/1", Value: []byte("value2")}},
+		{Sequence: 3, Change: Change{Type: ChangeDelete, Key: "a/1"}},
+	}
+	h.Publish(ns[:2])
+	h.Publish(ns[2:])
+
+	testCases := []struct {
+		name string
+		w    *Watcher
+		want []Notification
+	}{
+		{"every key", all, ns},
+		{"prefix", prefixed, []Notification{ns[0], ns[2]}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := receive(tc.w); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("expected notifications %v, got %v instead", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestStoreWithHub(t *testing.T) {
+	h := NewHub()
+	w := h.Watch("")
+	defer w.Close()
+
+	s := New(WithHub(h))
+	defer s.Close()
+
+	expiresAt := time.Now().Add(time.Hour)
+	s.Put("testKey1", []byte("value1"))
+	s.PutWithExpiry("testKey2", []byte("value2"), expiresAt)
+	s.Delete("testKey1")
+	s.expireAll(expiresAt)
+
+	want := []Notification{
+		{Sequence: 1, Change: Change{Type: ChangePut, Key: "testKey1", Value: []byte("value1")}},
+		{Sequence: 2, Change: Change{Type: ChangePut, Key: "testKey2", Value: []byte("value2"), ExpiresAt: expiresAt}},
+		{Sequence: 3, Change: Change{Type: ChangeDelete, Key: "testKey1"}},
+		{Sequence: 4, Change: Change{Type: ChangeExpire, Key: "testKey2"}},
+	}
+	if got := receive(w); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected notifications %v, got %v instead", want, got)
+	}
+}
+
+func TestHubLagged(t *testing.T) {
+	h := NewHub()
+
+	w := h.Watch("")
+	for i := 0; i <= watcherBuffer; i++ {
+		h.Publish([]Notification{{Sequence: uint64(i + 1), Change: Change{Key: "testKey" + strconv.Itoa(i)}}})
+	}
+
+	if got := receive(w); len(got) != watcherBuffer {
+		t.Errorf("expected %d notifications, got %d instead", watcherBuffer, len(got))
+	}
+	if _, ok := <-w.Notifications(); ok {
+		t.Errorf("expected the watcher to be closed")
+	}
+	if err := w.Err(); err != ErrorWatcherLagged {
+		t.Errorf("Expected err to be %v, got %v instead", ErrorWatcherLagged, err)
+	}
+	if n := h.Len(); n != 0 {
+		t.Errorf("expected no watcher, got %d instead", n)
+	}
+
+	// closing a watcher closed by the hub does nothing
+	w.Close()
+}
+
+func TestWatcherClose(t *testing.T) {
+	h := NewHub()
+
+	w := h.Watch("")
+	w.Close()
+	w.Close()
+	h.Publish([]Notification{{Sequence: 1, Change: Change{Key: "testKey"}}})
+
+	if _, ok := <-w.Notifications(); ok {
+		t.Errorf("expected the watcher to be closed")
+	}
+	if err := w.Err(); err != nil {
+		t.Errorf("Expected err to be %v, got %v instead", nil, err)
+	}
+	if n := h.Len(); n != 0 {
+		t.Errorf("expected no watcher, got %d instead", n)
+	}
+}